@@ -19,6 +19,7 @@ package v1alpha1
 import (
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 const (
@@ -31,6 +32,28 @@ const (
 	// ReadyCondition is the name of the Ready condition implemented by all toolkit
 	// resources.
 	ReadyCondition string = "Ready"
+
+	// AccessEntriesCompatibleCondition reports whether all the mappings of an
+	// AWSAuthItem can be expressed as EKS access entries.
+	AccessEntriesCompatibleCondition string = "AccessEntriesCompatible"
+
+	// ConflictedCondition reports that an AWSAuthItem maps an IAM ARN that is
+	// already mapped by another AWSAuthItem taking precedence.
+	ConflictedCondition string = "Conflicted"
+
+	// PolicyViolationCondition reports that some mappings of an AWSAuthItem are
+	// not allowed by the AWSAuthPolicies selecting its namespace.
+	PolicyViolationCondition string = "PolicyViolation"
+
+	// ConflictingManagerCondition reports that fields of the aws-auth
+	// ConfigMap written by the controller are also managed by another field
+	// manager, such as eksctl or Terraform.
+	ConflictingManagerCondition string = "ConflictingManager"
+
+	// SafetyCheckFailedCondition reports that the last rendering of the
+	// aws-auth ConfigMap was not written because it trips a safety guard,
+	// such as removing the last mapping of the nodes.
+	SafetyCheckFailedCondition string = "SafetyCheckFailed"
 )
 
 const (
@@ -49,6 +72,54 @@ const (
 	// SuspendedReason represents the fact that the reconciliation of a toolkit
 	// resource is suspended.
 	SuspendedReason string = "Suspended"
+
+	// MappingsSupportedReason represents the fact that all the mappings of an
+	// AWSAuthItem can be expressed as EKS access entries.
+	MappingsSupportedReason string = "MappingsSupported"
+
+	// UnsupportedMappingsReason represents the fact that some mappings of an
+	// AWSAuthItem cannot be expressed as EKS access entries.
+	UnsupportedMappingsReason string = "UnsupportedMappings"
+
+	// DuplicateARNReason represents the fact that an IAM ARN is mapped by more
+	// than one AWSAuthItem.
+	DuplicateARNReason string = "DuplicateARN"
+
+	// ForbiddenMappingsReason represents the fact that some mappings of an
+	// AWSAuthItem are excluded from aws-auth because an AWSAuthPolicy forbids them.
+	ForbiddenMappingsReason string = "ForbiddenMappings"
+
+	// FieldManagerConflictReason represents the fact that the server-side apply
+	// of the aws-auth ConfigMap conflicts with another field manager.
+	FieldManagerConflictReason string = "FieldManagerConflict"
+
+	// PinnedRevisionReason represents the fact that the aws-auth ConfigMap is
+	// pinned to a previous revision, so the mappings of the AWSAuthItems are
+	// not written.
+	PinnedRevisionReason string = "PinnedRevision"
+
+	// SafetyCheckFailedReason represents the fact that the rendered aws-auth
+	// ConfigMap was not written because it trips a safety guard.
+	SafetyCheckFailedReason string = "SafetyCheckFailed"
+
+	// DryRunReason represents the fact that the changes of the aws-auth
+	// ConfigMap rendered from an AWSAuthItem are not written because of a
+	// dry run.
+	DryRunReason string = "DryRun"
+
+	// TargetConflictReason represents the fact that a ConfigMap is already
+	// rendered by another target, so the items of the AWSAuthTarget are not
+	// written.
+	TargetConflictReason string = "TargetConflict"
+
+	// DriftDetectedReason represents the fact that the aws-auth ConfigMap was
+	// changed by another client since it was rendered, and the change is
+	// reported without being reverted.
+	DriftDetectedReason string = "DriftDetected"
+
+	// DriftCorrectedReason represents the fact that a change of the aws-auth
+	// ConfigMap by another client was reverted.
+	DriftCorrectedReason string = "DriftCorrected"
 )
 
 // AWSAuthItemSpec defines the desired state of AWSAuthItem.
@@ -60,6 +131,13 @@ type AWSAuthItemSpec struct {
 	// +kubebuilder:default=false
 	Suspend bool `json:"suspend,omitempty"`
 
+	// DryRun tells the controller to compute the changes of the aws-auth
+	// ConfigMap rendered from this AWSAuthItem without writing them. The
+	// mappings of the AWSAuthItem stay as they are in the aws-auth ConfigMap,
+	// and the changes are reported in status.pendingChanges.
+	// +kubebuilder:validation:Optional
+	DryRun bool `json:"dryRun,omitempty"`
+
 	// MapRoles holds a list of MapRoleItem
 	//+kubebuilder:validation:Optional
 	MapRoles []MapRoleItem `json:"mapRoles,omitempty"`
@@ -67,18 +145,27 @@ type AWSAuthItemSpec struct {
 	// MapUsers holds a list of MapUserItem
 	//+kubebuilder:validation:Optional
 	MapUsers []MapUserItem `json:"mapUsers,omitempty"`
+
+	// MapAccounts holds a list of AWS account IDs. Every IAM user and role in
+	// these accounts is automatically mapped to a Kubernetes username.
+	//+kubebuilder:validation:Optional
+	//+kubebuilder:validation:items:Pattern=`^\d{12}$`
+	MapAccounts []string `json:"mapAccounts,omitempty"`
 }
 
 type MapRoleItem struct {
 	// The ARN of the IAM role to add.
-	// Must be a valid IAM role ARN in the format: arn:aws:iam::<account-id>:role/<role-name>
+	// Must be a valid IAM role ARN in the format: arn:<partition>:iam::<account-id>:role/<role-name>
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:MinLength=25
-	// +kubebuilder:validation:Pattern=`^arn:aws:iam::\d{12}:role/.+$`
+	// +kubebuilder:validation:Pattern=`^arn:aws(-cn|-us-gov|-iso(-[bef])?)?:iam::\d{12}:role/.+$`
 	RoleArn string `json:"rolearn"`
 
 	// The user name within Kubernetes to map to the IAM role.
-	// Supports templating with {{EC2PrivateDNSName}} for node roles.
+	// Supports templating with {{AccountID}}, {{SessionName}}, {{SessionNameRaw}},
+	// {{EC2PrivateDNSName}} and {{AccessKeyID}}. The system: prefix is reserved
+	// for the node usernames system:node:{{EC2PrivateDNSName}} and
+	// system:node:{{SessionName}}.
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:MinLength=1
 	Username string `json:"username"`
@@ -91,13 +178,14 @@ type MapRoleItem struct {
 
 type MapUserItem struct {
 	// The ARN of the IAM user to add.
-	// Must be a valid IAM user ARN in the format: arn:aws:iam::<account-id>:user/<user-name>
+	// Must be a valid IAM user ARN in the format: arn:<partition>:iam::<account-id>:user/<user-name>
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:MinLength=25
-	// +kubebuilder:validation:Pattern=`^arn:aws:iam::\d{12}:user/.+$`
+	// +kubebuilder:validation:Pattern=`^arn:aws(-cn|-us-gov|-iso(-[bef])?)?:iam::\d{12}:user/.+$`
 	UserArn string `json:"userarn"`
 
 	// The user name within Kubernetes to map to the IAM user.
+	// Supports templating with {{AccountID}} and {{AccessKeyID}}.
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:MinLength=1
 	Username string `json:"username"`
@@ -117,6 +205,103 @@ type AWSAuthItemStatus struct {
 	// Conditions holds the conditions for the AWSAuthItem.
 	// +kubebuilder:validation:Optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// PendingChanges are the changes of the aws-auth ConfigMap entries of the
+	// AWSAuthItem not written because of a dry run.
+	// +kubebuilder:validation:Optional
+	PendingChanges []PendingChange `json:"pendingChanges,omitempty"`
+
+	// AppliedTargets are the ConfigMaps the mappings of the AWSAuthItem were
+	// last written to.
+	// +kubebuilder:validation:Optional
+	AppliedTargets []AppliedTarget `json:"appliedTargets,omitempty"`
+}
+
+// AppliedTarget is a ConfigMap the mappings of an item were written to.
+type AppliedTarget struct {
+	// Name is the AWSAuthTarget of the ConfigMap, unset for the aws-auth
+	// ConfigMap of the controller.
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+
+	// ConfigMap is the namespace/name of the ConfigMap.
+	ConfigMap string `json:"configMap"`
+
+	// Cluster is the namespace/name of the kubeconfig Secret of the remote
+	// cluster of the ConfigMap, unset for this cluster.
+	// +kubebuilder:validation:Optional
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// PendingChange is a change of an aws-auth ConfigMap entry not written
+// because of a dry run.
+type PendingChange struct {
+	// Type is the kind of change.
+	// +kubebuilder:validation:Enum=added;modified;removed
+	Type string `json:"type"`
+
+	// Key is the data key of the entry, one of mapRoles, mapUsers or
+	// mapAccounts.
+	Key string `json:"key"`
+
+	// ID is the rolearn or userarn of the entry, or the account ID for
+	// mapAccounts.
+	ID string `json:"id"`
+
+	// Live is the mapping of the entry in the aws-auth ConfigMap, unset when
+	// the entry is added or for mapAccounts.
+	// +kubebuilder:validation:Optional
+	Live *PendingMapping `json:"live,omitempty"`
+
+	// Desired is the mapping of the entry the controller would write, unset
+	// when the entry is removed or for mapAccounts.
+	// +kubebuilder:validation:Optional
+	Desired *PendingMapping `json:"desired,omitempty"`
+}
+
+// PendingMapping is the Kubernetes identity of a PendingChange.
+type PendingMapping struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// Item is implemented by AWSAuthItem and ClusterAWSAuthItem, which share the
+// same spec and status and are aggregated into the same aws-auth ConfigMap.
+// +kubebuilder:object:generate=false
+type Item interface {
+	metav1.Object
+	runtime.Object
+
+	GetSpec() *AWSAuthItemSpec
+	GetStatus() *AWSAuthItemStatus
+	GetStatusConditions() *[]metav1.Condition
+	SetResourceCondition(condition string, status metav1.ConditionStatus, reason, message string)
+
+	AWSAuthItemProgressing()
+	AWSAuthItemNotReady(reason, message string)
+	AWSAuthItemReady()
+	AWSAuthItemSuspended()
+	AWSAuthItemAccessEntriesCompatible()
+	AWSAuthItemAccessEntriesIncompatible(message string)
+	AWSAuthItemConflicted(message string)
+	AWSAuthItemNotConflicted()
+	AWSAuthItemConflictingManager(message string)
+	AWSAuthItemNoConflictingManager()
+	AWSAuthItemSafetyCheckFailed(message string)
+	AWSAuthItemSafetyCheckPassed()
+	AWSAuthItemDryRun(message string)
+
+	Validate(partition string) error
+}
+
+// GetSpec returns a pointer to the Spec.
+func (r *AWSAuthItem) GetSpec() *AWSAuthItemSpec {
+	return &r.Spec
+}
+
+// GetStatus returns a pointer to the Status.
+func (r *AWSAuthItem) GetStatus() *AWSAuthItemStatus {
+	return &r.Status
 }
 
 // AWSAuthItemProgressing registers progress toward
@@ -145,6 +330,71 @@ func (r *AWSAuthItem) AWSAuthItemSuspended() {
 		"Reconciliation is suspended")
 }
 
+// AWSAuthItemAccessEntriesCompatible registers that all the mappings of the
+// given AWSAuthItem can be expressed as EKS access entries.
+func (r *AWSAuthItem) AWSAuthItemAccessEntriesCompatible() {
+	r.SetResourceCondition(AccessEntriesCompatibleCondition, metav1.ConditionTrue, MappingsSupportedReason,
+		"All mappings can be expressed as EKS access entries")
+}
+
+// AWSAuthItemAccessEntriesIncompatible registers that some mappings of the
+// given AWSAuthItem cannot be expressed as EKS access entries.
+func (r *AWSAuthItem) AWSAuthItemAccessEntriesIncompatible(message string) {
+	r.SetResourceCondition(AccessEntriesCompatibleCondition, metav1.ConditionFalse, UnsupportedMappingsReason, message)
+}
+
+// AWSAuthItemConflicted registers that the given AWSAuthItem lost a conflict
+// over an IAM ARN to another AWSAuthItem.
+func (r *AWSAuthItem) AWSAuthItemConflicted(message string) {
+	r.SetResourceCondition(ConflictedCondition, metav1.ConditionTrue, DuplicateARNReason, message)
+}
+
+// AWSAuthItemNotConflicted removes the Conflicted condition from the given AWSAuthItem.
+func (r *AWSAuthItem) AWSAuthItemNotConflicted() {
+	apimeta.RemoveStatusCondition(r.GetStatusConditions(), ConflictedCondition)
+}
+
+// AWSAuthItemConflictingManager registers that the aws-auth ConfigMap the
+// mappings of the given AWSAuthItem are written to has fields managed by
+// another field manager.
+func (r *AWSAuthItem) AWSAuthItemConflictingManager(message string) {
+	r.SetResourceCondition(ConflictingManagerCondition, metav1.ConditionTrue, FieldManagerConflictReason, message)
+}
+
+// AWSAuthItemNoConflictingManager removes the ConflictingManager condition from the given AWSAuthItem.
+func (r *AWSAuthItem) AWSAuthItemNoConflictingManager() {
+	apimeta.RemoveStatusCondition(r.GetStatusConditions(), ConflictingManagerCondition)
+}
+
+// AWSAuthItemSafetyCheckFailed registers that the aws-auth ConfigMap the
+// mappings of the given AWSAuthItem are written to was not updated because
+// the change trips a safety guard.
+func (r *AWSAuthItem) AWSAuthItemSafetyCheckFailed(message string) {
+	r.SetResourceCondition(SafetyCheckFailedCondition, metav1.ConditionTrue, SafetyCheckFailedReason, message)
+}
+
+// AWSAuthItemSafetyCheckPassed removes the SafetyCheckFailed condition from the given AWSAuthItem.
+func (r *AWSAuthItem) AWSAuthItemSafetyCheckPassed() {
+	apimeta.RemoveStatusCondition(r.GetStatusConditions(), SafetyCheckFailedCondition)
+}
+
+// AWSAuthItemDryRun registers that the changes of the given AWSAuthItem are
+// not written to the aws-auth ConfigMap because of a dry run.
+func (r *AWSAuthItem) AWSAuthItemDryRun(message string) {
+	r.SetResourceCondition(ReadyCondition, metav1.ConditionFalse, DryRunReason, message)
+}
+
+// AWSAuthItemPolicyViolated registers that some mappings of the given
+// AWSAuthItem are not allowed by an AWSAuthPolicy and were excluded.
+func (r *AWSAuthItem) AWSAuthItemPolicyViolated(message string) {
+	r.SetResourceCondition(PolicyViolationCondition, metav1.ConditionTrue, ForbiddenMappingsReason, message)
+}
+
+// AWSAuthItemPolicyCompliant removes the PolicyViolation condition from the given AWSAuthItem.
+func (r *AWSAuthItem) AWSAuthItemPolicyCompliant() {
+	apimeta.RemoveStatusCondition(r.GetStatusConditions(), PolicyViolationCondition)
+}
+
 // SetResourceCondition sets the given condition with the given status,
 // reason and message on a resource.
 func (r *AWSAuthItem) SetResourceCondition(condition string, status metav1.ConditionStatus, reason, message string) {
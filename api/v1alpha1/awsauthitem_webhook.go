@@ -18,12 +18,19 @@ package v1alpha1
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
 
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
@@ -31,39 +38,166 @@ import (
 // log is for logging in this package.
 var awsauthitemlog = logf.Log.WithName("awsauthitem-resource")
 
-func (r *AWSAuthItem) SetupWebhookWithManager(mgr ctrl.Manager) error {
+// accountIDRegexp matches a 12-digit AWS account ID.
+var accountIDRegexp = regexp.MustCompile(`^\d{12}$`)
+
+// templateRegexp matches a username template placeholder such as
+// {{EC2PrivateDNSName}}, including an unterminated one.
+var templateRegexp = regexp.MustCompile(`{{[^{}]*(}})?`)
+
+// RolePlaceholders are the username placeholders the AWS IAM authenticator
+// expands for a role mapping.
+var RolePlaceholders = []string{"{{AccountID}}", "{{SessionName}}", "{{SessionNameRaw}}", "{{EC2PrivateDNSName}}", "{{AccessKeyID}}"}
+
+// UserPlaceholders are the username placeholders the AWS IAM authenticator
+// expands for a user mapping, which has no session.
+var UserPlaceholders = []string{"{{AccountID}}", "{{AccessKeyID}}"}
+
+// NodeUsernames are the only usernames with the reserved system: prefix that
+// can be mapped, to the roles of the EC2 and Fargate nodes.
+var NodeUsernames = []string{"system:node:{{EC2PrivateDNSName}}", "system:node:{{SessionName}}"}
+
+// Partitions are the AWS partitions of the IAM ARNs accepted in the mappings.
+var Partitions = []string{"aws", "aws-cn", "aws-us-gov", "aws-iso", "aws-iso-b", "aws-iso-e", "aws-iso-f"}
+
+// WebhookOptions configures the validation of the AWSAuthItem and
+// ClusterAWSAuthItem webhooks.
+type WebhookOptions struct {
+	// Partition is the AWS partition of the cluster. When not empty, only the
+	// IAM ARNs of that partition can be mapped.
+	Partition string
+
+	// AccountID is the AWS account of the cluster. When not empty, mapping
+	// an IAM ARN of another account returns a warning.
+	AccountID string
+}
+
+// SetupWebhookWithManager registers the AWSAuthItem webhooks.
+func (r *AWSAuthItem) SetupWebhookWithManager(mgr ctrl.Manager, opts WebhookOptions) error {
+	mgr.GetWebhookServer().Register("/mutate-aws-maruina-k8s-v1alpha1-awsauthitem", &admission.Webhook{
+		Handler: &roleARNNormalizer{
+			decoder: admission.NewDecoder(mgr.GetScheme()),
+			newItem: func() Item { return &AWSAuthItem{} },
+		},
+	})
+
 	return ctrl.NewWebhookManagedBy[*AWSAuthItem](mgr, r).
-		WithValidator(r).
+		WithValidator(&awsAuthItemValidator{
+			client:     mgr.GetClient(),
+			partition:  opts.Partition,
+			escalation: escalationChecker{client: mgr.GetClient()},
+			warner:     mappingWarner{client: mgr.GetClient(), accountID: opts.AccountID},
+		}).
 		Complete()
 }
 
 //+kubebuilder:webhook:path=/validate-aws-maruina-k8s-v1alpha1-awsauthitem,mutating=false,failurePolicy=fail,sideEffects=None,groups=aws.maruina.k8s,resources=awsauthitems,verbs=create;update,versions=v1alpha1,name=vawsauthitem.aws.maruina.k8s,admissionReviewVersions=v1
 
-var _ admission.Validator[*AWSAuthItem] = &AWSAuthItem{}
+// awsAuthItemValidator validates AWSAuthItems, and rejects the mappings not
+// allowed by the AWSAuthPolicies selecting their namespace or granting more
+// permissions than the requesting user holds. The risky mappings of a valid
+// AWSAuthItem are returned as warnings.
+type awsAuthItemValidator struct {
+	client     client.Reader
+	partition  string
+	escalation escalationChecker
+	warner     mappingWarner
+}
+
+var _ admission.Validator[*AWSAuthItem] = &awsAuthItemValidator{}
 
 // ValidateCreate implements admission.Validator so a webhook will be registered for the type.
-func (r *AWSAuthItem) ValidateCreate(_ context.Context, _ *AWSAuthItem) (admission.Warnings, error) {
-	awsauthitemlog.Info("validate create", "name", r.Name)
+func (v *awsAuthItemValidator) ValidateCreate(ctx context.Context, obj *AWSAuthItem) (admission.Warnings, error) {
+	awsauthitemlog.Info("validate create", "name", obj.Name)
 
-	return nil, r.validateAWSAuthItem()
+	if err := obj.Validate(v.partition); err != nil {
+		return nil, err
+	}
+
+	if err := v.validatePolicies(ctx, obj); err != nil {
+		return nil, err
+	}
+
+	if err := v.escalation.check(ctx, "awsauthitems", obj.Namespace, obj.Name, &obj.Spec, nil); err != nil {
+		return nil, err
+	}
+
+	if err := v.escalation.checkRemote(ctx, "awsauthitems", obj.Namespace, obj.Name, obj.Labels); err != nil {
+		return nil, err
+	}
+
+	return v.warner.warnings(ctx, obj), nil
 }
 
 // ValidateUpdate implements admission.Validator so a webhook will be registered for the type.
-func (r *AWSAuthItem) ValidateUpdate(_ context.Context, _, _ *AWSAuthItem) (admission.Warnings, error) {
-	awsauthitemlog.Info("validate update", "name", r.Name)
+func (v *awsAuthItemValidator) ValidateUpdate(ctx context.Context, oldObj, newObj *AWSAuthItem) (admission.Warnings, error) {
+	awsauthitemlog.Info("validate update", "name", newObj.Name)
+
+	// Only a spec or label change is validated, so that the finalizer of an
+	// item created before a policy or a validation rule can still be
+	// removed. The labels select the AWSAuthTargets the item is rendered to
+	if !newObj.DeletionTimestamp.IsZero() ||
+		equality.Semantic.DeepEqual(oldObj.Spec, newObj.Spec) && equality.Semantic.DeepEqual(oldObj.Labels, newObj.Labels) {
+		return nil, nil
+	}
+
+	if err := newObj.Validate(v.partition); err != nil {
+		return nil, err
+	}
+
+	if err := v.validatePolicies(ctx, newObj); err != nil {
+		return nil, err
+	}
+
+	if err := v.escalation.check(ctx, "awsauthitems", newObj.Namespace, newObj.Name, &newObj.Spec, &oldObj.Spec); err != nil {
+		return nil, err
+	}
+
+	if err := v.escalation.checkRemote(ctx, "awsauthitems", newObj.Namespace, newObj.Name, newObj.Labels); err != nil {
+		return nil, err
+	}
 
-	return nil, r.validateAWSAuthItem()
+	return v.warner.warnings(ctx, newObj), nil
 }
 
 // ValidateDelete implements admission.Validator so a webhook will be registered for the type.
-func (r *AWSAuthItem) ValidateDelete(_ context.Context, _ *AWSAuthItem) (admission.Warnings, error) {
+func (v *awsAuthItemValidator) ValidateDelete(_ context.Context, _ *AWSAuthItem) (admission.Warnings, error) {
 	return nil, nil
 }
 
-func (r *AWSAuthItem) validateAWSAuthItem() error {
+// validatePolicies returns an error when obj maps entries that are not
+// allowed by the AWSAuthPolicies selecting its namespace.
+func (v *awsAuthItemValidator) validatePolicies(ctx context.Context, obj *AWSAuthItem) error {
+	policies, err := PoliciesForNamespace(ctx, v.client, obj.Namespace)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+
+	_, violations := EnforcePolicies(policies, &obj.Spec)
+
+	return PolicyViolationError(obj.Name, violations)
+}
+
+// Validate returns the validation errors of the AWSAuthItem enforced by the
+// webhook, or nil when it is valid. When partition is not empty, the IAM ARNs
+// must belong to it.
+func (r *AWSAuthItem) Validate(partition string) error {
+	return validateSpec("AWSAuthItem", r.Name, &r.Spec, partition)
+}
+
+// validateSpec validates the spec shared by AWSAuthItem and ClusterAWSAuthItem.
+func validateSpec(kind, name string, spec *AWSAuthItemSpec, partition string) error {
 	var allErrs field.ErrorList
 
-	if errs := r.validateArns(); errs != nil {
+	if errs := validateArns(spec, partition); errs != nil {
+		allErrs = append(allErrs, errs...)
+	}
+
+	if errs := validateMappings(spec); errs != nil {
+		allErrs = append(allErrs, errs...)
+	}
+
+	if errs := validateAccounts(spec); errs != nil {
 		allErrs = append(allErrs, errs...)
 	}
 
@@ -72,22 +206,131 @@ func (r *AWSAuthItem) validateAWSAuthItem() error {
 	}
 
 	return apierrors.NewInvalid(
-		schema.GroupKind{Group: "aws.maruina.k8s", Kind: "AWSAuthItem"},
-		r.Name, allErrs)
+		schema.GroupKind{Group: "aws.maruina.k8s", Kind: kind},
+		name, allErrs)
 }
 
-func (r *AWSAuthItem) validateArns() field.ErrorList {
+func validateArns(spec *AWSAuthItemSpec, partition string) field.ErrorList {
 	var errList field.ErrorList
 
-	for _, mapRole := range r.Spec.MapRoles {
-		if !arn.IsARN(mapRole.RoleArn) {
-			errList = append(errList, field.Invalid(field.NewPath("spec").Child("MapRoles"), mapRole.RoleArn, "invalid role ARN"))
+	for i, mapRole := range spec.MapRoles {
+		path := field.NewPath("spec").Child("mapRoles").Index(i).Child("rolearn")
+		errList = append(errList, validateIAMArn(path, mapRole.RoleArn, "role", partition)...)
+	}
+
+	for i, mapUser := range spec.MapUsers {
+		path := field.NewPath("spec").Child("mapUsers").Index(i).Child("userarn")
+		errList = append(errList, validateIAMArn(path, mapUser.UserArn, "user", partition)...)
+	}
+
+	return errList
+}
+
+// validateIAMArn validates an IAM ARN of the given resource type, such as
+// role or user, in any known partition or in partition when not empty.
+func validateIAMArn(path *field.Path, value, resourceType, partition string) field.ErrorList {
+	parsed, err := arn.Parse(value)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, value, fmt.Sprintf("invalid %s ARN", resourceType))}
+	}
+
+	var errList field.ErrorList
+	switch {
+	case !slices.Contains(Partitions, parsed.Partition):
+		errList = append(errList, field.Invalid(path, value,
+			fmt.Sprintf("unknown partition %q, must be one of: %s", parsed.Partition, strings.Join(Partitions, ", "))))
+	case partition != "" && parsed.Partition != partition:
+		errList = append(errList, field.Invalid(path, value,
+			fmt.Sprintf("partition %q does not match the %q partition of the cluster", parsed.Partition, partition)))
+	}
+
+	if parsed.Service != "iam" {
+		errList = append(errList, field.Invalid(path, value, fmt.Sprintf("service %q is not iam", parsed.Service)))
+	}
+
+	if !accountIDRegexp.MatchString(parsed.AccountID) {
+		errList = append(errList, field.Invalid(path, value, "invalid AWS account ID, must be 12 digits"))
+	}
+
+	if kind, name, _ := strings.Cut(parsed.Resource, "/"); kind != resourceType || name == "" {
+		errList = append(errList, field.Invalid(path, value,
+			fmt.Sprintf("resource %q is not an IAM %s, must be %s/<name>", parsed.Resource, resourceType, resourceType)))
+	}
+
+	return errList
+}
+
+func validateMappings(spec *AWSAuthItemSpec) field.ErrorList {
+	var errList field.ErrorList
+
+	for i, mapRole := range spec.MapRoles {
+		path := field.NewPath("spec").Child("mapRoles").Index(i)
+		errList = append(errList, validateUsername(path.Child("username"), mapRole.Username, RolePlaceholders, NodeUsernames)...)
+		errList = append(errList, validateGroups(path.Child("groups"), mapRole.Groups)...)
+	}
+
+	for i, mapUser := range spec.MapUsers {
+		path := field.NewPath("spec").Child("mapUsers").Index(i)
+		errList = append(errList, validateUsername(path.Child("username"), mapUser.Username, UserPlaceholders, nil)...)
+		errList = append(errList, validateGroups(path.Child("groups"), mapUser.Groups)...)
+	}
+
+	return errList
+}
+
+// validateUsername validates that a username only uses the given template
+// placeholders, and that it only uses the reserved system: prefix when it is
+// one of systemUsernames.
+func validateUsername(path *field.Path, username string, placeholders, systemUsernames []string) field.ErrorList {
+	var errList field.ErrorList
+
+	for _, placeholder := range templateRegexp.FindAllString(username, -1) {
+		if !slices.Contains(placeholders, placeholder) {
+			errList = append(errList, field.Invalid(path, username,
+				fmt.Sprintf("unsupported template %s, must be one of: %s", placeholder, strings.Join(placeholders, ", "))))
+		}
+	}
+
+	if strings.HasPrefix(username, "system:") && !slices.Contains(systemUsernames, username) {
+		detail := "the system: prefix is reserved"
+		if len(systemUsernames) > 0 {
+			detail += ", except for the node usernames " + strings.Join(systemUsernames, ", ")
+		}
+		errList = append(errList, field.Invalid(path, username, detail))
+	}
+
+	return errList
+}
+
+// validateGroups validates that groups are unique, non-empty names without
+// whitespace or template placeholders, which are not expanded in groups.
+func validateGroups(path *field.Path, groups []string) field.ErrorList {
+	var errList field.ErrorList
+
+	seen := map[string]bool{}
+	for i, group := range groups {
+		switch {
+		case group == "":
+			errList = append(errList, field.Required(path.Index(i), "group must not be empty"))
+		case strings.ContainsFunc(group, unicode.IsSpace):
+			errList = append(errList, field.Invalid(path.Index(i), group, "group must not contain whitespace"))
+		case strings.Contains(group, "{{"):
+			errList = append(errList, field.Invalid(path.Index(i), group, "templates are not supported in groups"))
+		case seen[group]:
+			errList = append(errList, field.Duplicate(path.Index(i), group))
 		}
+		seen[group] = true
 	}
 
-	for _, mapUser := range r.Spec.MapUsers {
-		if !arn.IsARN(mapUser.UserArn) {
-			errList = append(errList, field.Invalid(field.NewPath("spec").Child("MapUsers"), mapUser.UserArn, "invalid user ARN"))
+	return errList
+}
+
+func validateAccounts(spec *AWSAuthItemSpec) field.ErrorList {
+	var errList field.ErrorList
+
+	for i, account := range spec.MapAccounts {
+		if !accountIDRegexp.MatchString(account) {
+			errList = append(errList, field.Invalid(field.NewPath("spec").Child("mapAccounts").Index(i), account, "invalid AWS account ID, must be 12 digits"))
 		}
 	}
 
@@ -0,0 +1,220 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("AWSAuthItem validation", func() {
+	DescribeTable("IAM ARNs",
+		func(roleARN, userARN, partition, message string) {
+			item := &AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{Name: "partitions", Namespace: "default"},
+				Spec: AWSAuthItemSpec{
+					MapRoles: []MapRoleItem{{RoleArn: roleARN, Username: "admin", Groups: []string{"view"}}},
+					MapUsers: []MapUserItem{{UserArn: userARN, Username: "ops", Groups: []string{"view"}}},
+				},
+			}
+
+			err := item.Validate(partition)
+			if message == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			}
+		},
+		Entry("commercial partition",
+			"arn:aws:iam::111122223333:role/admin", "arn:aws:iam::111122223333:user/ops", "", ""),
+		Entry("China partition",
+			"arn:aws-cn:iam::111122223333:role/admin", "arn:aws-cn:iam::111122223333:user/ops", "", ""),
+		Entry("GovCloud partition",
+			"arn:aws-us-gov:iam::111122223333:role/admin", "arn:aws-us-gov:iam::111122223333:user/ops", "aws-us-gov", ""),
+		Entry("ISO partition",
+			"arn:aws-iso-b:iam::111122223333:role/admin", "arn:aws-iso-b:iam::111122223333:user/ops", "", ""),
+		Entry("unknown partition",
+			"arn:aws-mars:iam::111122223333:role/admin", "arn:aws:iam::111122223333:user/ops", "",
+			`spec.mapRoles[0].rolearn: Invalid value: "arn:aws-mars:iam::111122223333:role/admin": unknown partition "aws-mars"`),
+		Entry("partition not matching the cluster",
+			"arn:aws-us-gov:iam::111122223333:role/admin", "arn:aws:iam::111122223333:user/ops", "aws-us-gov",
+			`spec.mapUsers[0].userarn: Invalid value: "arn:aws:iam::111122223333:user/ops": partition "aws" does not match`),
+		Entry("service other than iam",
+			"arn:aws:sts::111122223333:assumed-role/admin/session", "arn:aws:iam::111122223333:user/ops", "",
+			`service "sts" is not iam`),
+		Entry("user ARN mapped as a role",
+			"arn:aws:iam::111122223333:user/admin", "arn:aws:iam::111122223333:user/ops", "",
+			`resource "user/admin" is not an IAM role`),
+		Entry("role ARN mapped as a user",
+			"arn:aws:iam::111122223333:role/admin", "arn:aws:iam::111122223333:role/ops", "",
+			`resource "role/ops" is not an IAM user`),
+		Entry("invalid account ID",
+			"arn:aws:iam::1111:role/admin", "arn:aws:iam::111122223333:user/ops", "",
+			"invalid AWS account ID"),
+		Entry("not an ARN",
+			"admin", "arn:aws:iam::111122223333:user/ops", "",
+			"invalid role ARN"),
+	)
+
+	It("should remove the finalizer of an item in another partition", func() {
+		deleted := metav1.Now()
+		spec := AWSAuthItemSpec{
+			MapRoles: []MapRoleItem{{RoleArn: "arn:aws:iam::111122223333:role/admin", Username: "admin", Groups: []string{"view"}}},
+		}
+		oldItem := &AWSAuthItem{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "partitions", Namespace: "default", DeletionTimestamp: &deleted, Finalizers: []string{AWSAuthFinalizer},
+			},
+			Spec: spec,
+		}
+		newItem := oldItem.DeepCopy()
+		newItem.Finalizers = nil
+
+		_, err := (&awsAuthItemValidator{partition: "aws-us-gov"}).ValidateUpdate(ctx, oldItem, newItem)
+		Expect(err).NotTo(HaveOccurred())
+
+		oldClusterItem := &ClusterAWSAuthItem{ObjectMeta: oldItem.ObjectMeta, Spec: spec}
+		oldClusterItem.Namespace = ""
+		newClusterItem := oldClusterItem.DeepCopy()
+		newClusterItem.Finalizers = nil
+
+		_, err = (&clusterAWSAuthItemValidator{partition: "aws-us-gov"}).ValidateUpdate(ctx, oldClusterItem, newClusterItem)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("validating a spec change")
+		oldItem.DeletionTimestamp = nil
+		newItem = oldItem.DeepCopy()
+		newItem.Spec.MapRoles[0].Username = "ops"
+		_, err = (&awsAuthItemValidator{partition: "aws-us-gov"}).ValidateUpdate(ctx, oldItem, newItem)
+		Expect(err).To(MatchError(ContainSubstring(`partition "aws" does not match`)))
+	})
+
+	DescribeTable("usernames and groups",
+		func(mapRole MapRoleItem, mapUser MapUserItem, message string) {
+			item := &AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{Name: "usernames", Namespace: "default"},
+				Spec: AWSAuthItemSpec{
+					MapRoles: []MapRoleItem{mapRole},
+					MapUsers: []MapUserItem{mapUser},
+				},
+			}
+			item.Spec.MapRoles[0].RoleArn = "arn:aws:iam::111122223333:role/admin"
+			item.Spec.MapUsers[0].UserArn = "arn:aws:iam::111122223333:user/ops"
+
+			err := item.Validate("")
+			if message == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			}
+		},
+		Entry("templated usernames",
+			MapRoleItem{Username: "admin:{{AccountID}}:{{SessionName}}", Groups: []string{"view"}},
+			MapUserItem{Username: "ops:{{AccessKeyID}}", Groups: []string{"view"}}, ""),
+		Entry("EC2 node username",
+			MapRoleItem{Username: "system:node:{{EC2PrivateDNSName}}", Groups: []string{"system:bootstrappers", "system:nodes"}},
+			MapUserItem{Username: "ops", Groups: []string{"view"}}, ""),
+		Entry("Fargate node username",
+			MapRoleItem{Username: "system:node:{{SessionName}}", Groups: []string{"system:node-proxier"}},
+			MapUserItem{Username: "ops", Groups: []string{"view"}}, ""),
+		Entry("misspelled placeholder",
+			MapRoleItem{Username: "system:node:{{EC2PrivateDnsName}}", Groups: []string{"system:nodes"}},
+			MapUserItem{Username: "ops", Groups: []string{"view"}},
+			`spec.mapRoles[0].username: Invalid value: "system:node:{{EC2PrivateDnsName}}": unsupported template {{EC2PrivateDnsName}}`),
+		Entry("unterminated placeholder",
+			MapRoleItem{Username: "admin:{{SessionName}", Groups: []string{"view"}},
+			MapUserItem{Username: "ops", Groups: []string{"view"}},
+			"unsupported template {{SessionName"),
+		Entry("session placeholder in a user mapping",
+			MapRoleItem{Username: "admin", Groups: []string{"view"}},
+			MapUserItem{Username: "ops:{{SessionName}}", Groups: []string{"view"}},
+			`spec.mapUsers[0].username: Invalid value: "ops:{{SessionName}}": unsupported template {{SessionName}}`),
+		Entry("reserved system: username",
+			MapRoleItem{Username: "system:admin", Groups: []string{"view"}},
+			MapUserItem{Username: "ops", Groups: []string{"view"}},
+			`spec.mapRoles[0].username: Invalid value: "system:admin": the system: prefix is reserved`),
+		Entry("node username in a user mapping",
+			MapRoleItem{Username: "admin", Groups: []string{"view"}},
+			MapUserItem{Username: "system:node:{{EC2PrivateDNSName}}", Groups: []string{"view"}},
+			"spec.mapUsers[0].username"),
+		Entry("empty group",
+			MapRoleItem{Username: "admin", Groups: []string{"view", ""}},
+			MapUserItem{Username: "ops", Groups: []string{"view"}},
+			"spec.mapRoles[0].groups[1]: Required value"),
+		Entry("group with whitespace",
+			MapRoleItem{Username: "admin", Groups: []string{"view"}},
+			MapUserItem{Username: "ops", Groups: []string{"platform admins"}},
+			`spec.mapUsers[0].groups[0]: Invalid value: "platform admins": group must not contain whitespace`),
+		Entry("templated group",
+			MapRoleItem{Username: "admin", Groups: []string{"{{SessionName}}"}},
+			MapUserItem{Username: "ops", Groups: []string{"view"}},
+			"templates are not supported in groups"),
+		Entry("duplicated group",
+			MapRoleItem{Username: "admin", Groups: []string{"view", "view"}},
+			MapUserItem{Username: "ops", Groups: []string{"view"}},
+			`spec.mapRoles[0].groups[1]: Duplicate value: "view"`),
+	)
+
+	It("should validate a label change", func() {
+		oldItem := &AWSAuthItem{
+			ObjectMeta: metav1.ObjectMeta{Name: "labels", Namespace: "default"},
+			Spec: AWSAuthItemSpec{
+				MapRoles: []MapRoleItem{{RoleArn: "arn:aws:iam::111122223333:role/admin", Username: "admin", Groups: []string{"view"}}},
+			},
+		}
+		newItem := oldItem.DeepCopy()
+		newItem.Labels = map[string]string{"cluster": "prod"}
+
+		_, err := (&awsAuthItemValidator{partition: "aws-us-gov"}).ValidateUpdate(ctx, oldItem, newItem)
+		Expect(err).To(MatchError(ContainSubstring(`partition "aws" does not match`)))
+	})
+
+	It("should remove the finalizer of an item with a reserved username", func() {
+		deleted := metav1.Now()
+		spec := AWSAuthItemSpec{
+			MapRoles: []MapRoleItem{{RoleArn: "arn:aws:iam::111122223333:role/admin", Username: "system:admin", Groups: []string{"view"}}},
+			MapUsers: []MapUserItem{{UserArn: "arn:aws:iam::111122223333:user/ops", Username: "ops:{{SessionName}}", Groups: []string{"view"}}},
+		}
+		oldItem := &AWSAuthItem{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "usernames", Namespace: "default", DeletionTimestamp: &deleted, Finalizers: []string{AWSAuthFinalizer},
+			},
+			Spec: spec,
+		}
+		newItem := oldItem.DeepCopy()
+		newItem.Finalizers = nil
+
+		_, err := (&awsAuthItemValidator{}).ValidateUpdate(ctx, oldItem, newItem)
+		Expect(err).NotTo(HaveOccurred())
+
+		oldClusterItem := &ClusterAWSAuthItem{ObjectMeta: oldItem.ObjectMeta, Spec: spec}
+		oldClusterItem.Namespace = ""
+		newClusterItem := oldClusterItem.DeepCopy()
+		newClusterItem.Finalizers = nil
+
+		_, err = (&clusterAWSAuthItemValidator{}).ValidateUpdate(ctx, oldClusterItem, newClusterItem)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("validating a spec change")
+		oldClusterItem.DeletionTimestamp = nil
+		newClusterItem = oldClusterItem.DeepCopy()
+		newClusterItem.Spec.MapRoles[0].Groups = []string{"edit"}
+		_, err = (&clusterAWSAuthItemValidator{}).ValidateUpdate(ctx, oldClusterItem, newClusterItem)
+		Expect(err).To(MatchError(ContainSubstring("the system: prefix is reserved")))
+	})
+})
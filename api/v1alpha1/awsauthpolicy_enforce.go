@@ -0,0 +1,195 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PoliciesForNamespace returns the AWSAuthPolicies selecting a namespace. A
+// namespace that does not exist is only selected by the policies with an
+// empty selector.
+func PoliciesForNamespace(ctx context.Context, c client.Reader, namespace string) ([]AWSAuthPolicy, error) {
+	var policyList AWSAuthPolicyList
+	if err := c.List(ctx, &policyList); err != nil {
+		return nil, fmt.Errorf("listing AWSAuthPolicies: %w", err)
+	}
+	if len(policyList.Items) == 0 {
+		return nil, nil
+	}
+
+	var ns corev1.Namespace
+	if err := c.Get(ctx, client.ObjectKey{Name: namespace}, &ns); client.IgnoreNotFound(err) != nil {
+		return nil, fmt.Errorf("fetching namespace %s: %w", namespace, err)
+	}
+
+	return SelectPolicies(policyList.Items, ns.Labels)
+}
+
+// SelectPolicies returns the policies selecting a namespace with the given labels.
+func SelectPolicies(policies []AWSAuthPolicy, namespaceLabels map[string]string) ([]AWSAuthPolicy, error) {
+	var selected []AWSAuthPolicy
+	for _, policy := range policies {
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("parsing namespaceSelector of AWSAuthPolicy %s: %w", policy.Name, err)
+		}
+		if selector.Matches(labels.Set(namespaceLabels)) {
+			selected = append(selected, policy)
+		}
+	}
+
+	return selected, nil
+}
+
+// EnforcePolicies returns a copy of spec without the mappings that are not
+// allowed by every policy, and the violations of the removed mappings.
+func EnforcePolicies(policies []AWSAuthPolicy, spec *AWSAuthItemSpec) (AWSAuthItemSpec, field.ErrorList) {
+	allowed := *spec.DeepCopy()
+	allowed.MapRoles, allowed.MapUsers, allowed.MapAccounts = nil, nil, nil
+	var violations field.ErrorList
+
+	for i, mapRole := range spec.MapRoles {
+		path := field.NewPath("spec").Child("mapRoles").Index(i)
+		var errs field.ErrorList
+		for _, policy := range policies {
+			errs = append(errs, policy.checkMapping(path, "rolearn", mapRole.RoleArn, mapRole.Username, mapRole.Groups)...)
+		}
+		if len(errs) == 0 {
+			allowed.MapRoles = append(allowed.MapRoles, mapRole)
+		}
+		violations = append(violations, errs...)
+	}
+
+	for i, mapUser := range spec.MapUsers {
+		path := field.NewPath("spec").Child("mapUsers").Index(i)
+		var errs field.ErrorList
+		for _, policy := range policies {
+			errs = append(errs, policy.checkMapping(path, "userarn", mapUser.UserArn, mapUser.Username, mapUser.Groups)...)
+		}
+		if len(errs) == 0 {
+			allowed.MapUsers = append(allowed.MapUsers, mapUser)
+		}
+		violations = append(violations, errs...)
+	}
+
+	for i, account := range spec.MapAccounts {
+		path := field.NewPath("spec").Child("mapAccounts").Index(i)
+		var errs field.ErrorList
+		for _, policy := range policies {
+			if len(policy.Spec.AllowedAccounts) > 0 && !slices.Contains(policy.Spec.AllowedAccounts, account) {
+				errs = append(errs, field.Forbidden(path, policy.forbidden("account %s", account)))
+			}
+		}
+		if len(errs) == 0 {
+			allowed.MapAccounts = append(allowed.MapAccounts, account)
+		}
+		violations = append(violations, errs...)
+	}
+
+	return allowed, violations
+}
+
+// PolicyViolationError returns the error rejecting an AWSAuthItem with the
+// given policy violations, or nil when there are none.
+func PolicyViolationError(name string, violations field.ErrorList) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("AWSAuthItem").GroupKind(), name, violations)
+}
+
+// checkMapping returns the violations of the policy by a role or user mapping.
+func (p *AWSAuthPolicy) checkMapping(path *field.Path, arnField, arnValue, username string, groups []string) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(p.Spec.AllowedAccounts) > 0 {
+		parsed, err := arn.Parse(arnValue)
+		if err != nil || !slices.Contains(p.Spec.AllowedAccounts, parsed.AccountID) {
+			errs = append(errs, field.Forbidden(path.Child(arnField), p.forbidden("the account of %s", arnValue)))
+		}
+	}
+
+	if len(p.Spec.AllowedARNs) > 0 && !matchAnyGlob(p.Spec.AllowedARNs, arnValue) {
+		errs = append(errs, field.Forbidden(path.Child(arnField), p.forbidden("ARN %s", arnValue)))
+	}
+
+	if len(p.Spec.AllowedUsernames) > 0 && !matchAnyGlob(p.Spec.AllowedUsernames, username) {
+		errs = append(errs, field.Forbidden(path.Child("username"), p.forbidden("username %s", username)))
+	}
+
+	for i, group := range groups {
+		if matchAnyGlob(p.Spec.ForbiddenGroups, group) ||
+			(len(p.Spec.AllowedGroups) > 0 && !matchAnyGlob(p.Spec.AllowedGroups, group)) {
+			errs = append(errs, field.Forbidden(path.Child("groups").Index(i), p.forbidden("group %s", group)))
+		}
+	}
+
+	return errs
+}
+
+// forbidden returns the detail of a violation of the policy.
+func (p *AWSAuthPolicy) forbidden(format string, args ...any) string {
+	return fmt.Sprintf(format, args...) + " is not allowed by AWSAuthPolicy " + p.Name
+}
+
+// matchAnyGlob reports whether s matches any of the patterns.
+func matchAnyGlob(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchGlob reports whether s matches pattern, where '*' matches any
+// sequence of characters, including '/' and ':'.
+func matchGlob(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("AWSAuthPolicy", func() {
+	var policy AWSAuthPolicy
+
+	BeforeEach(func() {
+		policy = AWSAuthPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "team"},
+			Spec: AWSAuthPolicySpec{
+				NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+				AllowedAccounts:   []string{"111122223333"},
+				AllowedARNs:       []string{"arn:aws:iam::*:role/team-a/*"},
+				ForbiddenGroups:   []string{"system:*"},
+			},
+		}
+	})
+
+	It("should select namespaces by label", func() {
+		Expect(SelectPolicies([]AWSAuthPolicy{policy}, map[string]string{"team": "a"})).To(HaveLen(1))
+		Expect(SelectPolicies([]AWSAuthPolicy{policy}, map[string]string{"team": "b"})).To(BeEmpty())
+	})
+
+	It("should exclude the mappings not allowed by the policy", func() {
+		spec := AWSAuthItemSpec{
+			MapRoles: []MapRoleItem{
+				{RoleArn: "arn:aws:iam::111122223333:role/team-a/deployer", Username: "deployer", Groups: []string{"edit"}},
+				{RoleArn: "arn:aws:iam::111122223333:role/team-a/admin", Username: "admin", Groups: []string{"system:masters"}},
+				{RoleArn: "arn:aws:iam::444455556666:role/team-a/deployer", Username: "deployer", Groups: []string{"edit"}},
+			},
+			MapUsers: []MapUserItem{
+				{UserArn: "arn:aws:iam::111122223333:user/ops", Username: "ops", Groups: []string{"view"}},
+			},
+			MapAccounts: []string{"111122223333", "444455556666"},
+		}
+
+		allowed, violations := EnforcePolicies([]AWSAuthPolicy{policy}, &spec)
+		Expect(allowed.MapRoles).To(Equal(spec.MapRoles[:1]))
+		Expect(allowed.MapUsers).To(BeEmpty())
+		Expect(allowed.MapAccounts).To(Equal([]string{"111122223333"}))
+
+		var fields []string
+		for _, violation := range violations {
+			fields = append(fields, violation.Field)
+		}
+		Expect(fields).To(ConsistOf(
+			"spec.mapRoles[1].groups[0]",
+			"spec.mapRoles[2].rolearn",
+			"spec.mapUsers[0].userarn",
+			"spec.mapAccounts[1]",
+		))
+	})
+
+	It("should reject an AWSAuthItem violating a policy of its namespace", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "team-a-",
+			Labels:       map[string]string{"team": "a"},
+		}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		Expect(k8sClient.Create(ctx, &policy)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, &policy)
+
+		item := &AWSAuthItem{
+			ObjectMeta: metav1.ObjectMeta{Name: "admin", Namespace: ns.Name},
+			Spec: AWSAuthItemSpec{
+				MapRoles: []MapRoleItem{
+					{RoleArn: "arn:aws:iam::111122223333:role/team-a/admin", Username: "admin", Groups: []string{"system:masters"}},
+				},
+			},
+		}
+		Eventually(func() bool {
+			return apierrors.IsInvalid(k8sClient.Create(ctx, item))
+		}).Should(BeTrue())
+
+		item.Spec.MapRoles[0].Groups = []string{"edit"}
+		Expect(k8sClient.Create(ctx, item)).To(Succeed())
+	})
+})
@@ -0,0 +1,83 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AWSAuthPolicySpec defines the mappings the AWSAuthItems of the selected
+// namespaces are allowed to grant. An empty list does not restrict the
+// corresponding field. Patterns are globs where '*' matches any sequence of
+// characters.
+type AWSAuthPolicySpec struct {
+	// NamespaceSelector selects the namespaces whose AWSAuthItems are
+	// restricted by the policy. An empty selector selects every namespace.
+	// +kubebuilder:validation:Optional
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// AllowedAccounts lists the AWS account IDs that can be mapped, either in
+	// mapAccounts or as the account of a role or user ARN.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:items:Pattern=`^\d{12}$`
+	AllowedAccounts []string `json:"allowedAccounts,omitempty"`
+
+	// AllowedARNs lists the patterns the role and user ARNs must match.
+	// +kubebuilder:validation:Optional
+	AllowedARNs []string `json:"allowedARNs,omitempty"`
+
+	// AllowedGroups lists the patterns the Kubernetes groups must match.
+	// +kubebuilder:validation:Optional
+	AllowedGroups []string `json:"allowedGroups,omitempty"`
+
+	// ForbiddenGroups lists the patterns no Kubernetes group can match, such as
+	// system:masters. It takes precedence over AllowedGroups.
+	// +kubebuilder:validation:Optional
+	ForbiddenGroups []string `json:"forbiddenGroups,omitempty"`
+
+	// AllowedUsernames lists the patterns the Kubernetes usernames must match.
+	// +kubebuilder:validation:Optional
+	AllowedUsernames []string `json:"allowedUsernames,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster,shortName=aap
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// AWSAuthPolicy is the Schema for the awsauthpolicies API. It restricts the
+// accounts, ARNs, groups and usernames the AWSAuthItems of the selected
+// namespaces can map. A mapping must be allowed by every policy selecting the
+// namespace of its AWSAuthItem, and ClusterAWSAuthItems are never restricted.
+type AWSAuthPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AWSAuthPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AWSAuthPolicyList contains a list of AWSAuthPolicy.
+type AWSAuthPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AWSAuthPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AWSAuthPolicy{}, &AWSAuthPolicyList{})
+}
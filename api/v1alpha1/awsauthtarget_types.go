@@ -0,0 +1,166 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// AWSAuthTargetSpec defines the ConfigMap the mappings of the selected items
+// are rendered to.
+type AWSAuthTargetSpec struct {
+	// ConfigMap is the ConfigMap the mappings are rendered to, in the format
+	// of the aws-auth ConfigMap.
+	ConfigMap ConfigMapReference `json:"configMap"`
+
+	// Keys lists the data keys of the ConfigMap rendered from the mappings of
+	// the items. The other keys are rendered empty. An empty list renders
+	// every key.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:items:Enum=mapRoles;mapUsers;mapAccounts
+	Keys []string `json:"keys,omitempty"`
+
+	// ItemSelector selects, by label, the AWSAuthItems and
+	// ClusterAWSAuthItems rendered to the ConfigMap. An empty selector
+	// selects no item, so that a target without selector doesn't take every
+	// mapping out of the aws-auth ConfigMap.
+	// +kubebuilder:validation:Optional
+	ItemSelector metav1.LabelSelector `json:"itemSelector,omitempty"`
+
+	// KubeConfig references the kubeconfig of the remote cluster the
+	// ConfigMap is written to, such as an EKS cluster managed from this
+	// cluster. The ConfigMap is written to this cluster when unset. The
+	// mappings are reviewed against the RBAC of this cluster, not of the
+	// remote cluster, so only the users with the bypass verb on an item can
+	// render it to a remote cluster.
+	// +kubebuilder:validation:Optional
+	KubeConfig *KubeConfigReference `json:"kubeConfig,omitempty"`
+}
+
+// KubeConfigReference references the kubeconfig of a remote cluster.
+type KubeConfigReference struct {
+	// SecretRef is the Secret key holding the kubeconfig.
+	SecretRef SecretKeyReference `json:"secretRef"`
+}
+
+// SecretKeyReference names a key of a Secret.
+type SecretKeyReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+
+	// Key is the data key of the Secret.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=value
+	Key string `json:"key,omitempty"`
+}
+
+// AWSAuthTargetStatus defines the observed state of AWSAuthTarget.
+type AWSAuthTargetStatus struct {
+	// ObservedGeneration is the last observed generation.
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions holds the conditions for the AWSAuthTarget. The Ready
+	// condition reports whether the ConfigMap is in sync with the mappings of
+	// the selected items.
+	// +kubebuilder:validation:Optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ConfigMapReference names a ConfigMap.
+type ConfigMapReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster,shortName=aat
+//+kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".spec.configMap.namespace"
+//+kubebuilder:printcolumn:name="ConfigMap",type="string",JSONPath=".spec.configMap.name"
+//+kubebuilder:printcolumn:name="KubeConfig",type="string",JSONPath=".spec.kubeConfig.secretRef.name"
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+//+kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].reason"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// AWSAuthTarget is the Schema for the awsauthtargets API. It renders the
+// mappings of the AWSAuthItems and ClusterAWSAuthItems it selects to another
+// ConfigMap than the aws-auth ConfigMap of the controller, such as the
+// configuration of a staging authenticator. The items selected by at least
+// one AWSAuthTarget are only rendered to the ConfigMaps of their targets.
+// With a kubeConfig, the ConfigMap is written to a remote cluster.
+type AWSAuthTarget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AWSAuthTargetSpec   `json:"spec,omitempty"`
+	Status AWSAuthTargetStatus `json:"status,omitempty"`
+}
+
+// AWSAuthTargetReady sets the ReadyCondition of the AWSAuthTarget to 'True'
+// with the message describing the last write of its ConfigMap.
+func (r *AWSAuthTarget) AWSAuthTargetReady(message string) {
+	apimeta.SetStatusCondition(&r.Status.Conditions, metav1.Condition{
+		Type:    ReadyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReconciliationSucceededReason,
+		Message: message,
+	})
+}
+
+// AWSAuthTargetNotReady sets the ReadyCondition of the AWSAuthTarget to
+// 'False', with the given reason and message.
+func (r *AWSAuthTarget) AWSAuthTargetNotReady(reason, message string) {
+	apimeta.SetStatusCondition(&r.Status.Conditions, metav1.Condition{
+		Type:    ReadyCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// Selector returns the selector of the items of the AWSAuthTarget, which
+// selects no item when its itemSelector is empty.
+func (r *AWSAuthTarget) Selector() (labels.Selector, error) {
+	if len(r.Spec.ItemSelector.MatchLabels) == 0 && len(r.Spec.ItemSelector.MatchExpressions) == 0 {
+		return labels.Nothing(), nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&r.Spec.ItemSelector)
+	if err != nil {
+		return nil, fmt.Errorf("parsing itemSelector: %w", err)
+	}
+
+	return selector, nil
+}
+
+//+kubebuilder:object:root=true
+
+// AWSAuthTargetList contains a list of AWSAuthTarget.
+type AWSAuthTargetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AWSAuthTarget `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AWSAuthTarget{}, &AWSAuthTargetList{})
+}
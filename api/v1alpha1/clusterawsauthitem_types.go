@@ -0,0 +1,167 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetSpec returns a pointer to the Spec.
+func (r *ClusterAWSAuthItem) GetSpec() *AWSAuthItemSpec {
+	return &r.Spec
+}
+
+// GetStatus returns a pointer to the Status.
+func (r *ClusterAWSAuthItem) GetStatus() *AWSAuthItemStatus {
+	return &r.Status
+}
+
+// AWSAuthItemProgressing registers progress toward
+// reconciling the given ClusterAWSAuthItem by setting the meta.ReadyCondition to
+// 'Unknown' for meta.ProgressingReason.
+func (r *ClusterAWSAuthItem) AWSAuthItemProgressing() {
+	r.Status.Conditions = []metav1.Condition{}
+	r.SetResourceCondition(ReadyCondition, metav1.ConditionUnknown, ProgressingReason,
+		"Reconciliation in progress")
+}
+
+// AWSAuthItemNotReady registers a failed reconciliation of the given ClusterAWSAuthItem.
+func (r *ClusterAWSAuthItem) AWSAuthItemNotReady(reason, message string) {
+	r.SetResourceCondition(ReadyCondition, metav1.ConditionFalse, reason, message)
+}
+
+// AWSAuthItemReady registers a successful reconciliation of the given ClusterAWSAuthItem.
+func (r *ClusterAWSAuthItem) AWSAuthItemReady() {
+	r.SetResourceCondition(ReadyCondition, metav1.ConditionTrue, ReconciliationSucceededReason,
+		"Item reconciliation succeeded")
+}
+
+// AWSAuthItemSuspended registers a suspended reconciliation of the given ClusterAWSAuthItem.
+func (r *ClusterAWSAuthItem) AWSAuthItemSuspended() {
+	r.SetResourceCondition(ReadyCondition, metav1.ConditionFalse, SuspendedReason,
+		"Reconciliation is suspended")
+}
+
+// AWSAuthItemAccessEntriesCompatible registers that all the mappings of the
+// given ClusterAWSAuthItem can be expressed as EKS access entries.
+func (r *ClusterAWSAuthItem) AWSAuthItemAccessEntriesCompatible() {
+	r.SetResourceCondition(AccessEntriesCompatibleCondition, metav1.ConditionTrue, MappingsSupportedReason,
+		"All mappings can be expressed as EKS access entries")
+}
+
+// AWSAuthItemAccessEntriesIncompatible registers that some mappings of the
+// given ClusterAWSAuthItem cannot be expressed as EKS access entries.
+func (r *ClusterAWSAuthItem) AWSAuthItemAccessEntriesIncompatible(message string) {
+	r.SetResourceCondition(AccessEntriesCompatibleCondition, metav1.ConditionFalse, UnsupportedMappingsReason, message)
+}
+
+// AWSAuthItemConflicted registers that the given ClusterAWSAuthItem lost a
+// conflict over an IAM ARN to another item.
+func (r *ClusterAWSAuthItem) AWSAuthItemConflicted(message string) {
+	r.SetResourceCondition(ConflictedCondition, metav1.ConditionTrue, DuplicateARNReason, message)
+}
+
+// AWSAuthItemNotConflicted removes the Conflicted condition from the given ClusterAWSAuthItem.
+func (r *ClusterAWSAuthItem) AWSAuthItemNotConflicted() {
+	apimeta.RemoveStatusCondition(r.GetStatusConditions(), ConflictedCondition)
+}
+
+// AWSAuthItemConflictingManager registers that the aws-auth ConfigMap the
+// mappings of the given ClusterAWSAuthItem are written to has fields managed
+// by another field manager.
+func (r *ClusterAWSAuthItem) AWSAuthItemConflictingManager(message string) {
+	r.SetResourceCondition(ConflictingManagerCondition, metav1.ConditionTrue, FieldManagerConflictReason, message)
+}
+
+// AWSAuthItemNoConflictingManager removes the ConflictingManager condition from the given ClusterAWSAuthItem.
+func (r *ClusterAWSAuthItem) AWSAuthItemNoConflictingManager() {
+	apimeta.RemoveStatusCondition(r.GetStatusConditions(), ConflictingManagerCondition)
+}
+
+// AWSAuthItemSafetyCheckFailed registers that the aws-auth ConfigMap the
+// mappings of the given ClusterAWSAuthItem are written to was not updated
+// because the change trips a safety guard.
+func (r *ClusterAWSAuthItem) AWSAuthItemSafetyCheckFailed(message string) {
+	r.SetResourceCondition(SafetyCheckFailedCondition, metav1.ConditionTrue, SafetyCheckFailedReason, message)
+}
+
+// AWSAuthItemSafetyCheckPassed removes the SafetyCheckFailed condition from the given ClusterAWSAuthItem.
+func (r *ClusterAWSAuthItem) AWSAuthItemSafetyCheckPassed() {
+	apimeta.RemoveStatusCondition(r.GetStatusConditions(), SafetyCheckFailedCondition)
+}
+
+// AWSAuthItemDryRun registers that the changes of the given
+// ClusterAWSAuthItem are not written to the aws-auth ConfigMap because of a
+// dry run.
+func (r *ClusterAWSAuthItem) AWSAuthItemDryRun(message string) {
+	r.SetResourceCondition(ReadyCondition, metav1.ConditionFalse, DryRunReason, message)
+}
+
+// SetResourceCondition sets the given condition with the given status,
+// reason and message on a resource.
+func (r *ClusterAWSAuthItem) SetResourceCondition(condition string, status metav1.ConditionStatus, reason, message string) {
+	conditions := r.GetStatusConditions()
+
+	newCondition := metav1.Condition{
+		Type:    condition,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+
+	apimeta.SetStatusCondition(conditions, newCondition)
+}
+
+// GetStatusConditions returns a pointer to the Status.Conditions slice.
+func (r *ClusterAWSAuthItem) GetStatusConditions() *[]metav1.Condition {
+	return &r.Status.Conditions
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster,shortName=caai
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+//+kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].reason"
+//+kubebuilder:printcolumn:name="Suspended",type="boolean",JSONPath=".spec.suspend"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterAWSAuthItem is the Schema for the clusterawsauthitems API. It is the
+// cluster-scoped counterpart of AWSAuthItem, meant for the mappings owned by
+// the cluster administrators such as node roles and admins. Its mappings are
+// aggregated into the same aws-auth ConfigMap, and take precedence over the
+// mappings of AWSAuthItems.
+type ClusterAWSAuthItem struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AWSAuthItemSpec   `json:"spec,omitempty"`
+	Status AWSAuthItemStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterAWSAuthItemList contains a list of ClusterAWSAuthItem.
+type ClusterAWSAuthItemList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterAWSAuthItem `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterAWSAuthItem{}, &ClusterAWSAuthItemList{})
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var clusterawsauthitemlog = logf.Log.WithName("clusterawsauthitem-resource")
+
+// SetupWebhookWithManager registers the ClusterAWSAuthItem webhooks.
+func (r *ClusterAWSAuthItem) SetupWebhookWithManager(mgr ctrl.Manager, opts WebhookOptions) error {
+	mgr.GetWebhookServer().Register("/mutate-aws-maruina-k8s-v1alpha1-clusterawsauthitem", &admission.Webhook{
+		Handler: &roleARNNormalizer{
+			decoder: admission.NewDecoder(mgr.GetScheme()),
+			newItem: func() Item { return &ClusterAWSAuthItem{} },
+		},
+	})
+
+	return ctrl.NewWebhookManagedBy[*ClusterAWSAuthItem](mgr, r).
+		WithValidator(&clusterAWSAuthItemValidator{
+			partition:  opts.Partition,
+			escalation: escalationChecker{client: mgr.GetClient()},
+			warner:     mappingWarner{client: mgr.GetClient(), accountID: opts.AccountID},
+		}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-aws-maruina-k8s-v1alpha1-clusterawsauthitem,mutating=false,failurePolicy=fail,sideEffects=None,groups=aws.maruina.k8s,resources=clusterawsauthitems,verbs=create;update,versions=v1alpha1,name=vclusterawsauthitem.aws.maruina.k8s,admissionReviewVersions=v1
+
+// clusterAWSAuthItemValidator validates ClusterAWSAuthItems, and rejects the
+// mappings granting more permissions than the requesting user holds. The
+// risky mappings of a valid ClusterAWSAuthItem are returned as warnings.
+type clusterAWSAuthItemValidator struct {
+	partition  string
+	escalation escalationChecker
+	warner     mappingWarner
+}
+
+var _ admission.Validator[*ClusterAWSAuthItem] = &clusterAWSAuthItemValidator{}
+
+// ValidateCreate implements admission.Validator so a webhook will be registered for the type.
+func (v *clusterAWSAuthItemValidator) ValidateCreate(ctx context.Context, obj *ClusterAWSAuthItem) (admission.Warnings, error) {
+	clusterawsauthitemlog.Info("validate create", "name", obj.Name)
+
+	if err := obj.Validate(v.partition); err != nil {
+		return nil, err
+	}
+
+	if err := v.escalation.check(ctx, "clusterawsauthitems", "", obj.Name, &obj.Spec, nil); err != nil {
+		return nil, err
+	}
+
+	if err := v.escalation.checkRemote(ctx, "clusterawsauthitems", "", obj.Name, obj.Labels); err != nil {
+		return nil, err
+	}
+
+	return v.warner.warnings(ctx, obj), nil
+}
+
+// ValidateUpdate implements admission.Validator so a webhook will be registered for the type.
+func (v *clusterAWSAuthItemValidator) ValidateUpdate(ctx context.Context, oldObj, newObj *ClusterAWSAuthItem) (admission.Warnings, error) {
+	clusterawsauthitemlog.Info("validate update", "name", newObj.Name)
+
+	// Only a spec or label change is validated, so that the finalizer of an
+	// item created before a validation rule can still be removed. The labels
+	// select the AWSAuthTargets the item is rendered to
+	if !newObj.DeletionTimestamp.IsZero() ||
+		equality.Semantic.DeepEqual(oldObj.Spec, newObj.Spec) && equality.Semantic.DeepEqual(oldObj.Labels, newObj.Labels) {
+		return nil, nil
+	}
+
+	if err := newObj.Validate(v.partition); err != nil {
+		return nil, err
+	}
+
+	if err := v.escalation.check(ctx, "clusterawsauthitems", "", newObj.Name, &newObj.Spec, &oldObj.Spec); err != nil {
+		return nil, err
+	}
+
+	if err := v.escalation.checkRemote(ctx, "clusterawsauthitems", "", newObj.Name, newObj.Labels); err != nil {
+		return nil, err
+	}
+
+	return v.warner.warnings(ctx, newObj), nil
+}
+
+// ValidateDelete implements admission.Validator so a webhook will be registered for the type.
+func (v *clusterAWSAuthItemValidator) ValidateDelete(_ context.Context, _ *ClusterAWSAuthItem) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// Validate returns the validation errors of the ClusterAWSAuthItem enforced by
+// the webhook, or nil when it is valid. When partition is not empty, the IAM
+// ARNs must belong to it.
+func (r *ClusterAWSAuthItem) Validate(partition string) error {
+	return validateSpec("ClusterAWSAuthItem", r.Name, &r.Spec, partition)
+}
@@ -7,4 +7,12 @@ const (
 	ListAWSAuthItemFailedReason        = "ListAWSAuthItemFailed"
 	MarshalMapRolesFailedReason        = "MarshalMapRolesFailed"
 	MarshalMapUsersFailedReason        = "MarshalMapUsersFailed"
+	MarshalMapAccountsFailedReason     = "MarshalMapAccountsFailed"
+	ApplyAccessEntriesFailedReason     = "ApplyAccessEntriesFailed"
+	ParseAwsAuthConfigMapFailedReason  = "ParseAWSAuthConfigMapFailed"
+	GetPinnedRevisionFailedReason      = "GetPinnedRevisionFailed"
+	ListAWSAuthTargetFailedReason      = "ListAWSAuthTargetFailed"
+	GetKubeConfigFailedReason          = "GetKubeConfigFailed"
+	ConnectRemoteClusterFailedReason   = "ConnectRemoteClusterFailed"
+	InvalidItemSelectorReason          = "InvalidItemSelector"
 )
@@ -0,0 +1,506 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// BypassVerb is the verb on awsauthitems or clusterawsauthitems allowing a
+// user to map groups and usernames holding more permissions than their own,
+// and to render items to remote clusters.
+const BypassVerb = "bypass"
+
+// SystemMastersGroup is the Kubernetes group bypassing every authorization
+// check, without any RBAC binding.
+const SystemMastersGroup = "system:masters"
+
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterrolebindings;clusterroles;rolebindings;roles,verbs=get;list;watch
+
+// escalationChecker prevents privilege escalation through the aws-auth
+// ConfigMap, mirroring the RBAC escalation rule: a user can only map a group
+// or a username bound to RBAC rules that the user already holds, unless the
+// user can bypass the check.
+type escalationChecker struct {
+	client client.Client
+}
+
+// permission is a request attribute checked with a SubjectAccessReview.
+type permission struct {
+	namespace      string
+	verb           string
+	group          string
+	resource       string
+	subresource    string
+	name           string
+	nonResourceURL string
+	source         string
+}
+
+// String returns a human readable description of the permission.
+func (p permission) String() string {
+	if p.nonResourceURL != "" {
+		return fmt.Sprintf("%s %s", p.verb, p.nonResourceURL)
+	}
+
+	resource := p.resource
+	if p.group != "" {
+		resource += "." + p.group
+	}
+	if p.subresource != "" {
+		resource += "/" + p.subresource
+	}
+	if p.name != "" {
+		resource += " " + p.name
+	}
+	if p.namespace != "" {
+		resource += " in namespace " + p.namespace
+	}
+
+	return fmt.Sprintf("%s %s", p.verb, resource)
+}
+
+// check returns a Forbidden error when a mapping of spec that is new or
+// changed since oldSpec maps a group or a username bound to permissions the
+// requesting user does not hold. A mapping moved to another ARN is new, as
+// the ARN gains the permissions of its groups. resource, namespace and name
+// identify the item for the bypass check.
+func (c *escalationChecker) check(ctx context.Context, resource, namespace, name string, spec, oldSpec *AWSAuthItemSpec) error {
+	groups, usernames := principals(spec, oldSpec)
+	if groups.Len() == 0 && usernames.Len() == 0 {
+		return nil
+	}
+
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	user := req.UserInfo
+
+	bypass, err := c.allowed(ctx, user, permission{
+		namespace: namespace, verb: BypassVerb, group: GroupVersion.Group, resource: resource, name: name,
+	})
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if bypass {
+		return nil
+	}
+
+	required, err := c.requiredPermissions(ctx, groups, usernames)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+
+	deniedPermissions, err := c.denied(ctx, user, required)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if len(deniedPermissions) == 0 {
+		return nil
+	}
+	denied := make([]string, len(deniedPermissions))
+	for i, p := range deniedPermissions {
+		denied[i] = fmt.Sprintf("%s (granted to %s)", p, p.source)
+	}
+
+	return apierrors.NewForbidden(GroupVersion.WithResource(resource).GroupResource(), name,
+		fmt.Errorf("user %q cannot grant permissions it does not hold: %s; the %q verb on %s allows it",
+			user.Username, strings.Join(denied, ", "), BypassVerb, resource))
+}
+
+// checkRemote returns a Forbidden error when an AWSAuthTarget writing to a
+// remote cluster selects the item of resource, namespace and name with
+// itemLabels, unless the requesting user holds the bypass verb on it. The
+// mappings are reviewed against the RBAC of this cluster, which doesn't bind
+// the groups and usernames of the remote cluster.
+func (c *escalationChecker) checkRemote(ctx context.Context, resource, namespace, name string, itemLabels map[string]string) error {
+	var targets AWSAuthTargetList
+	if err := c.client.List(ctx, &targets); err != nil {
+		return apierrors.NewInternalError(fmt.Errorf("listing AWSAuthTargets: %w", err))
+	}
+
+	var remote []string
+	for _, t := range targets.Items {
+		if t.Spec.KubeConfig == nil {
+			continue
+		}
+		// A target with an invalid selector renders no item
+		selector, err := t.Selector()
+		if err == nil && selector.Matches(labels.Set(itemLabels)) {
+			remote = append(remote, t.Name)
+		}
+	}
+	if len(remote) == 0 {
+		return nil
+	}
+
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	user := req.UserInfo
+
+	bypass, err := c.allowed(ctx, user, permission{
+		namespace: namespace, verb: BypassVerb, group: GroupVersion.Group, resource: resource, name: name,
+	})
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if bypass {
+		return nil
+	}
+
+	return apierrors.NewForbidden(GroupVersion.WithResource(resource).GroupResource(), name,
+		fmt.Errorf("user %q cannot render items to the remote clusters of AWSAuthTargets %s, whose RBAC is not reviewed; the %q verb on %s allows it",
+			user.Username, strings.Join(remote, ", "), BypassVerb, resource))
+}
+
+// maxConcurrentReviews bounds the SubjectAccessReviews sent at once for an
+// admission request.
+const maxConcurrentReviews = 10
+
+// errDenied stops the reviews of the permissions at the first denial.
+var errDenied = errors.New("permission denied")
+
+// denied returns the permissions of required that user does not hold. The
+// permissions covered by another required one are not reviewed, and none is
+// when user holds every permission. The reviews are sent concurrently and
+// stop at the first denial, so only the denials reviewed until then are
+// returned.
+func (c *escalationChecker) denied(ctx context.Context, user authenticationv1.UserInfo, required []permission) ([]permission, error) {
+	required = collapse(required)
+	if len(required) > 1 {
+		all := []permission{{verb: "*", group: "*", resource: "*"}}
+		if slices.ContainsFunc(required, func(p permission) bool { return p.nonResourceURL != "" }) {
+			all = append(all, permission{verb: "*", nonResourceURL: "*"})
+		}
+		holdsAll := true
+		for _, p := range all {
+			ok, err := c.allowed(ctx, user, p)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				holdsAll = false
+				break
+			}
+		}
+		if holdsAll {
+			return nil, nil
+		}
+	}
+
+	var mu sync.Mutex
+	var denied []permission
+	g, reviewCtx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentReviews)
+	for _, p := range required {
+		if reviewCtx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			ok, err := c.allowed(reviewCtx, user, p)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				mu.Lock()
+				defer mu.Unlock()
+				denied = append(denied, p)
+				return errDenied
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil && !errors.Is(err, errDenied) {
+		return nil, err
+	}
+	sort.Slice(denied, func(i, j int) bool {
+		return denied[i].String() < denied[j].String()
+	})
+
+	return denied, nil
+}
+
+// collapse returns the permissions not covered by another one of permissions,
+// such as the verbs of a resource whose "*" verb is also required, in their
+// order. Holding the covering permission implies holding the covered ones, so
+// they don't need to be reviewed.
+func collapse(permissions []permission) []permission {
+	var collapsed []permission
+	for i, p := range permissions {
+		covered := false
+		for j, other := range permissions {
+			// Of two identical permissions, only the first is kept
+			if i != j && other.covers(p) && (!p.covers(other) || j < i) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			collapsed = append(collapsed, p)
+		}
+	}
+
+	return collapsed
+}
+
+// covers reports whether holding p implies holding other, following the
+// matching of the RBAC rules: a "*" verb, API group or resource matches any,
+// a permission without name matches every name, and a permission without
+// namespace matches every namespace.
+func (p permission) covers(other permission) bool {
+	if (p.nonResourceURL == "") != (other.nonResourceURL == "") || (p.verb != "*" && p.verb != other.verb) {
+		return false
+	}
+	if p.nonResourceURL != "" {
+		prefix, wildcard := strings.CutSuffix(p.nonResourceURL, "*")
+		return p.nonResourceURL == other.nonResourceURL || wildcard && strings.HasPrefix(other.nonResourceURL, prefix)
+	}
+
+	resource := p.resource == other.resource && p.subresource == other.subresource ||
+		p.resource == "*" && (p.subresource == "" || p.subresource == other.subresource)
+
+	return resource &&
+		(p.group == "*" || p.group == other.group) &&
+		(p.name == "" || p.name == other.name) &&
+		(p.namespace == "" || p.namespace == other.namespace)
+}
+
+// requiredPermissions returns the permissions bound to groups and usernames
+// by the RoleBindings and ClusterRoleBindings. system:masters requires every
+// permission.
+func (c *escalationChecker) requiredPermissions(ctx context.Context, groups, usernames sets.Set[string]) ([]permission, error) {
+	if groups.Has(SystemMastersGroup) {
+		source := "group " + SystemMastersGroup
+		return []permission{
+			{verb: "*", group: "*", resource: "*", source: source},
+			{verb: "*", nonResourceURL: "*", source: source},
+		}, nil
+	}
+
+	seen := map[permission]bool{}
+	var required []permission
+	add := func(namespace string, rules []rbacv1.PolicyRule, source string) {
+		for _, p := range expandRules(namespace, rules) {
+			key := p
+			key.source = ""
+			if !seen[key] {
+				seen[key] = true
+				p.source = source
+				required = append(required, p)
+			}
+		}
+	}
+
+	var clusterRoleBindings rbacv1.ClusterRoleBindingList
+	if err := c.client.List(ctx, &clusterRoleBindings); err != nil {
+		return nil, fmt.Errorf("listing ClusterRoleBindings: %w", err)
+	}
+	for _, binding := range clusterRoleBindings.Items {
+		subject, ok := boundSubject(binding.Subjects, groups, usernames)
+		if !ok {
+			continue
+		}
+		rules, err := c.roleRules(ctx, "", binding.RoleRef)
+		if err != nil {
+			return nil, err
+		}
+		add("", rules, fmt.Sprintf("%s by ClusterRoleBinding %s", subject, binding.Name))
+	}
+
+	var roleBindings rbacv1.RoleBindingList
+	if err := c.client.List(ctx, &roleBindings); err != nil {
+		return nil, fmt.Errorf("listing RoleBindings: %w", err)
+	}
+	for _, binding := range roleBindings.Items {
+		subject, ok := boundSubject(binding.Subjects, groups, usernames)
+		if !ok {
+			continue
+		}
+		rules, err := c.roleRules(ctx, binding.Namespace, binding.RoleRef)
+		if err != nil {
+			return nil, err
+		}
+		add(binding.Namespace, rules, fmt.Sprintf("%s by RoleBinding %s/%s", subject, binding.Namespace, binding.Name))
+	}
+
+	return required, nil
+}
+
+// roleRules returns the rules of the Role or ClusterRole referenced by a
+// binding. A missing role grants nothing.
+func (c *escalationChecker) roleRules(ctx context.Context, namespace string, ref rbacv1.RoleRef) ([]rbacv1.PolicyRule, error) {
+	if ref.Kind == "ClusterRole" {
+		var role rbacv1.ClusterRole
+		if err := c.client.Get(ctx, client.ObjectKey{Name: ref.Name}, &role); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		return role.Rules, nil
+	}
+
+	var role rbacv1.Role
+	if err := c.client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &role); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+
+	return role.Rules, nil
+}
+
+// allowed reports whether user holds permission p.
+func (c *escalationChecker) allowed(ctx context.Context, user authenticationv1.UserInfo, p permission) (bool, error) {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+		},
+	}
+	if p.nonResourceURL != "" {
+		review.Spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{Path: p.nonResourceURL, Verb: p.verb}
+	} else {
+		review.Spec.ResourceAttributes = &authorizationv1.ResourceAttributes{
+			Namespace:   p.namespace,
+			Verb:        p.verb,
+			Group:       p.group,
+			Resource:    p.resource,
+			Subresource: p.subresource,
+			Name:        p.name,
+		}
+	}
+
+	if err := c.client.Create(ctx, review); err != nil {
+		return false, fmt.Errorf("creating SubjectAccessReview: %w", err)
+	}
+
+	return review.Status.Allowed, nil
+}
+
+// principals returns the groups and the usernames of the mappings of spec
+// that oldSpec, when not nil, doesn't map with the same ARN, username and
+// groups. Templated usernames cannot be bound by RBAC, and are ignored.
+func principals(spec, oldSpec *AWSAuthItemSpec) (groups, usernames sets.Set[string]) {
+	key := func(arn, username string, groups []string) string {
+		return strings.Join(append([]string{arn, username}, slices.Sorted(slices.Values(groups))...), "\x00")
+	}
+	unchanged := sets.New[string]()
+	if oldSpec != nil {
+		for _, mapRole := range oldSpec.MapRoles {
+			unchanged.Insert(key(mapRole.RoleArn, mapRole.Username, mapRole.Groups))
+		}
+		for _, mapUser := range oldSpec.MapUsers {
+			unchanged.Insert(key(mapUser.UserArn, mapUser.Username, mapUser.Groups))
+		}
+	}
+
+	groups, usernames = sets.New[string](), sets.New[string]()
+	add := func(arn, username string, mappedGroups []string) {
+		if unchanged.Has(key(arn, username, mappedGroups)) {
+			return
+		}
+		groups.Insert(mappedGroups...)
+		if username != "" && !strings.Contains(username, "{{") {
+			usernames.Insert(username)
+		}
+	}
+
+	for _, mapRole := range spec.MapRoles {
+		add(mapRole.RoleArn, mapRole.Username, mapRole.Groups)
+	}
+	for _, mapUser := range spec.MapUsers {
+		add(mapUser.UserArn, mapUser.Username, mapUser.Groups)
+	}
+
+	return groups, usernames
+}
+
+// boundSubject returns the first of groups and usernames bound by subjects.
+func boundSubject(subjects []rbacv1.Subject, groups, usernames sets.Set[string]) (string, bool) {
+	for _, subject := range subjects {
+		switch {
+		case subject.Kind == rbacv1.GroupKind && groups.Has(subject.Name):
+			return "group " + subject.Name, true
+		case subject.Kind == rbacv1.UserKind && usernames.Has(subject.Name):
+			return "user " + subject.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// expandRules returns a permission for every combination of the verbs,
+// groups, resources, names and non-resource URLs of rules, in namespace.
+func expandRules(namespace string, rules []rbacv1.PolicyRule) []permission {
+	var permissions []permission
+	for _, rule := range rules {
+		for _, verb := range rule.Verbs {
+			for _, url := range rule.NonResourceURLs {
+				permissions = append(permissions, permission{verb: verb, nonResourceURL: url})
+			}
+
+			names := rule.ResourceNames
+			if len(names) == 0 {
+				names = []string{""}
+			}
+			for _, group := range rule.APIGroups {
+				for _, resource := range rule.Resources {
+					resource, subresource, _ := strings.Cut(resource, "/")
+					for _, name := range names {
+						permissions = append(permissions, permission{
+							namespace:   namespace,
+							verb:        verb,
+							group:       group,
+							resource:    resource,
+							subresource: subresource,
+							name:        name,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(permissions, func(i, j int) bool {
+		return permissions[i].String() < permissions[j].String()
+	})
+
+	return permissions
+}
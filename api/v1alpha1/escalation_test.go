@@ -0,0 +1,353 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apimachineryruntime "k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Privilege escalation", func() {
+	It("should expand RBAC rules into permissions", func() {
+		permissions := expandRules("team-a", []rbacv1.PolicyRule{
+			{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods/log"}},
+			{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz"}},
+		})
+		Expect(permissions).To(ConsistOf(
+			permission{namespace: "team-a", verb: "get", resource: "pods", subresource: "log"},
+			permission{namespace: "team-a", verb: "list", resource: "pods", subresource: "log"},
+			permission{verb: "get", nonResourceURL: "/healthz"},
+		))
+	})
+
+	It("should collapse the permissions covered by wildcards", func() {
+		Expect(collapse([]permission{
+			{verb: "get", group: "apps", resource: "deployments", namespace: "team-a"},
+			{verb: "*", group: "apps", resource: "deployments"},
+			{verb: "get", group: "apps", resource: "deployments", subresource: "scale"},
+			{verb: "get", resource: "pods", name: "web"},
+			{verb: "get", resource: "pods"},
+			{verb: "get", nonResourceURL: "/healthz/ready"},
+			{verb: "get", nonResourceURL: "/healthz/*"},
+		})).To(Equal([]permission{
+			{verb: "*", group: "apps", resource: "deployments"},
+			{verb: "get", group: "apps", resource: "deployments", subresource: "scale"},
+			{verb: "get", resource: "pods"},
+			{verb: "get", nonResourceURL: "/healthz/*"},
+		}))
+	})
+
+	It("should bound the reviews of a realistic ClusterRole", func() {
+		writeVerbs := []string{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"}
+		edit := &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "edit"},
+			Rules: []rbacv1.PolicyRule{
+				{Verbs: writeVerbs, APIGroups: []string{""}, Resources: []string{
+					"configmaps", "persistentvolumeclaims", "pods", "pods/attach", "pods/exec", "pods/log",
+					"secrets", "serviceaccounts", "services", "services/proxy",
+				}},
+				{Verbs: []string{"get", "list", "watch"}, APIGroups: []string{""}, Resources: []string{
+					"configmaps", "events", "pods", "pods/status", "resourcequotas", "services",
+				}},
+				{Verbs: []string{"*"}, APIGroups: []string{"apps"}, Resources: []string{
+					"daemonsets", "deployments", "deployments/scale", "replicasets", "statefulsets",
+				}},
+				{Verbs: []string{"get", "list", "watch"}, APIGroups: []string{"apps"}, Resources: []string{
+					"deployments", "statefulsets",
+				}},
+				{Verbs: writeVerbs, APIGroups: []string{"batch"}, Resources: []string{"cronjobs", "jobs"}},
+				{Verbs: writeVerbs, APIGroups: []string{"networking.k8s.io"}, Resources: []string{"ingresses", "networkpolicies"}},
+			},
+		}
+		binding := &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "deployers"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: edit.Name},
+			Subjects:   []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: rbacv1.GroupKind, Name: "deployers"}},
+		}
+		spec := &AWSAuthItemSpec{MapRoles: []MapRoleItem{{
+			RoleArn: "arn:aws:iam::111122223333:role/deployers", Username: "deployers", Groups: []string{"deployers"},
+		}}}
+		reviewCtx := admission.NewContextWithRequest(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			UserInfo: authenticationv1.UserInfo{Username: "alice"},
+		}})
+
+		// check counts the reviews of spec, and the reviews sent at once, with
+		// alice holding the permissions allowed by holds
+		check := func(holds func(*authorizationv1.ResourceAttributes) bool) (err error, reviews, concurrent int32) {
+			var inFlight, maxInFlight atomic.Int32
+			var count atomic.Int32
+			c := fake.NewClientBuilder().WithObjects(edit, binding).WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					review, ok := obj.(*authorizationv1.SubjectAccessReview)
+					if !ok {
+						return c.Create(ctx, obj, opts...)
+					}
+					count.Add(1)
+					n := inFlight.Add(1)
+					defer inFlight.Add(-1)
+					for {
+						m := maxInFlight.Load()
+						if n <= m || maxInFlight.CompareAndSwap(m, n) {
+							break
+						}
+					}
+					time.Sleep(time.Millisecond)
+					attrs := review.Spec.ResourceAttributes
+					review.Status.Allowed = attrs != nil && attrs.Verb != BypassVerb && holds(attrs)
+					return nil
+				},
+			}).Build()
+
+			err = (&escalationChecker{client: c}).check(reviewCtx, "awsauthitems", "default", "deployers", spec, nil)
+			return err, count.Load(), maxInFlight.Load()
+		}
+
+		required := expandRules("", edit.Rules)
+		collapsed := collapse(required)
+		Expect(required).To(HaveLen(141))
+		Expect(collapsed).To(HaveLen(126))
+
+		By("sending two reviews for a user holding every permission")
+		err, reviews, _ := check(func(*authorizationv1.ResourceAttributes) bool { return true })
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews).To(BeEquivalentTo(2))
+
+		By("reviewing the collapsed permissions concurrently for a user holding them")
+		err, reviews, concurrent := check(func(attrs *authorizationv1.ResourceAttributes) bool {
+			return attrs.Resource != "*"
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews).To(BeEquivalentTo(2 + len(collapsed)))
+		Expect(concurrent).To(BeNumerically("<=", maxConcurrentReviews))
+
+		By("stopping at the first denial")
+		err, reviews, _ = check(func(attrs *authorizationv1.ResourceAttributes) bool {
+			return attrs.Resource != "*" && attrs.Resource != "secrets"
+		})
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("secrets (granted to group deployers by ClusterRoleBinding deployers)")))
+		Expect(reviews).To(BeNumerically("<", 2+len(collapsed)))
+	})
+
+	It("should ignore templated usernames", func() {
+		groups, usernames := principals(&AWSAuthItemSpec{
+			MapRoles: []MapRoleItem{{Username: "system:node:{{EC2PrivateDNSName}}", Groups: []string{"system:nodes"}}},
+			MapUsers: []MapUserItem{{Username: "ops", Groups: []string{"view"}}},
+		}, nil)
+		Expect(groups.UnsortedList()).To(ConsistOf("system:nodes", "view"))
+		Expect(usernames.UnsortedList()).To(ConsistOf("ops"))
+	})
+
+	DescribeTable("updates of the mappings",
+		func(spec *AWSAuthItemSpec, forbidden bool) {
+			oldSpec := &AWSAuthItemSpec{
+				MapRoles: []MapRoleItem{{
+					RoleArn: "arn:aws:iam::111122223333:role/admin", Username: "admin", Groups: []string{SystemMastersGroup, "view"},
+				}},
+				MapUsers: []MapUserItem{{UserArn: "arn:aws:iam::111122223333:user/ops", Username: "ops", Groups: []string{"view"}}},
+			}
+			reviewCtx := admission.NewContextWithRequest(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				UserInfo: authenticationv1.UserInfo{Username: "alice"},
+			}})
+			c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					if _, ok := obj.(*authorizationv1.SubjectAccessReview); ok {
+						return nil
+					}
+					return c.Create(ctx, obj, opts...)
+				},
+			}).Build()
+
+			err := (&escalationChecker{client: c}).check(reviewCtx, "awsauthitems", "default", "admins", spec, oldSpec)
+			if forbidden {
+				Expect(apierrors.IsForbidden(err)).To(BeTrue())
+				Expect(err).To(MatchError(ContainSubstring("granted to group " + SystemMastersGroup)))
+			} else {
+				Expect(err).NotTo(HaveOccurred())
+			}
+		},
+		Entry("unchanged mappings in another order", &AWSAuthItemSpec{
+			MapRoles: []MapRoleItem{{
+				RoleArn: "arn:aws:iam::111122223333:role/admin", Username: "admin", Groups: []string{"view", SystemMastersGroup},
+			}},
+			MapUsers: []MapUserItem{{UserArn: "arn:aws:iam::111122223333:user/ops", Username: "ops", Groups: []string{"view"}}},
+		}, false),
+		Entry("removed privileged mapping", &AWSAuthItemSpec{
+			MapUsers: []MapUserItem{{UserArn: "arn:aws:iam::111122223333:user/ops", Username: "ops", Groups: []string{"view"}}},
+		}, false),
+		Entry("new ARN under an existing privileged group", &AWSAuthItemSpec{
+			MapRoles: []MapRoleItem{
+				{RoleArn: "arn:aws:iam::111122223333:role/admin", Username: "admin", Groups: []string{SystemMastersGroup, "view"}},
+				{RoleArn: "arn:aws:iam::111122223333:role/alice", Username: "alice", Groups: []string{SystemMastersGroup}},
+			},
+			MapUsers: []MapUserItem{{UserArn: "arn:aws:iam::111122223333:user/ops", Username: "ops", Groups: []string{"view"}}},
+		}, true),
+		Entry("existing privileged mapping moved to a new ARN", &AWSAuthItemSpec{
+			MapRoles: []MapRoleItem{{
+				RoleArn: "arn:aws:iam::111122223333:role/alice", Username: "admin", Groups: []string{SystemMastersGroup, "view"},
+			}},
+			MapUsers: []MapUserItem{{UserArn: "arn:aws:iam::111122223333:user/ops", Username: "ops", Groups: []string{"view"}}},
+		}, true),
+		Entry("existing user mapping moved to a privileged group", &AWSAuthItemSpec{
+			MapRoles: []MapRoleItem{{
+				RoleArn: "arn:aws:iam::111122223333:role/admin", Username: "admin", Groups: []string{SystemMastersGroup, "view"},
+			}},
+			MapUsers: []MapUserItem{{
+				UserArn: "arn:aws:iam::111122223333:user/ops", Username: "ops", Groups: []string{"view", SystemMastersGroup},
+			}},
+		}, true),
+	)
+
+	It("should require the bypass verb to render items to remote clusters", func() {
+		scheme := apimachineryruntime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(AddToScheme(scheme)).To(Succeed())
+		local := &AWSAuthTarget{
+			ObjectMeta: metav1.ObjectMeta{Name: "local"},
+			Spec: AWSAuthTargetSpec{
+				ConfigMap:    ConfigMapReference{Name: "aws-auth", Namespace: "team-a"},
+				ItemSelector: metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+			},
+		}
+		remote := &AWSAuthTarget{
+			ObjectMeta: metav1.ObjectMeta{Name: "prod"},
+			Spec: AWSAuthTargetSpec{
+				ConfigMap:    ConfigMapReference{Name: "aws-auth", Namespace: "kube-system"},
+				ItemSelector: metav1.LabelSelector{MatchLabels: map[string]string{"cluster": "prod"}},
+				KubeConfig:   &KubeConfigReference{SecretRef: SecretKeyReference{Name: "prod", Namespace: "default"}},
+			},
+		}
+		reviewCtx := admission.NewContextWithRequest(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			UserInfo: authenticationv1.UserInfo{Username: "alice"},
+		}})
+
+		// checkRemote checks the item with itemLabels, with alice holding the
+		// bypass verb when bypass is set
+		checkRemote := func(itemLabels map[string]string, bypass bool) error {
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(local, remote).WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					review, ok := obj.(*authorizationv1.SubjectAccessReview)
+					if !ok {
+						return c.Create(ctx, obj, opts...)
+					}
+					Expect(review.Spec.ResourceAttributes.Verb).To(Equal(BypassVerb))
+					review.Status.Allowed = bypass
+					return nil
+				},
+			}).Build()
+
+			return (&escalationChecker{client: c}).checkRemote(reviewCtx, "awsauthitems", "default", "prod-admins", itemLabels)
+		}
+
+		Expect(checkRemote(map[string]string{"team": "a"}, false)).To(Succeed())
+		err := checkRemote(map[string]string{"team": "a", "cluster": "prod"}, false)
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("remote clusters of AWSAuthTargets prod")))
+		Expect(checkRemote(map[string]string{"cluster": "prod"}, true)).To(Succeed())
+	})
+
+	It("should reject mappings granting permissions the user does not hold", func() {
+		creator := &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "escalation-creator"},
+			Rules: []rbacv1.PolicyRule{{
+				Verbs: []string{"create"}, APIGroups: []string{GroupVersion.Group}, Resources: []string{"awsauthitems"},
+			}},
+		}
+		pods := &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "escalation-pods"},
+			Rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+		}
+		bypass := &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "escalation-bypass"},
+			Rules: []rbacv1.PolicyRule{{
+				Verbs: []string{BypassVerb}, APIGroups: []string{GroupVersion.Group}, Resources: []string{"awsauthitems"},
+			}},
+		}
+		for _, role := range []*rbacv1.ClusterRole{creator, pods, bypass} {
+			Expect(k8sClient.Create(ctx, role)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, role)
+		}
+
+		bind := func(name, role string, subject rbacv1.Subject) {
+			binding := &rbacv1.ClusterRoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: role},
+				Subjects:   []rbacv1.Subject{subject},
+			}
+			Expect(k8sClient.Create(ctx, binding)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, binding)
+		}
+		alice := rbacv1.Subject{APIGroup: rbacv1.GroupName, Kind: rbacv1.UserKind, Name: "alice"}
+		bind("escalation-creator", creator.Name, alice)
+		bind("escalation-pods", pods.Name, rbacv1.Subject{APIGroup: rbacv1.GroupName, Kind: rbacv1.GroupKind, Name: "pod-readers"})
+
+		aliceCfg := rest.CopyConfig(cfg)
+		aliceCfg.Impersonate = rest.ImpersonationConfig{UserName: "alice"}
+		aliceClient, err := client.New(aliceCfg, client.Options{Scheme: k8sClient.Scheme()})
+		Expect(err).NotTo(HaveOccurred())
+
+		newItem := func(name, group string) *AWSAuthItem {
+			return &AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: AWSAuthItemSpec{
+					MapRoles: []MapRoleItem{{
+						RoleArn: "arn:aws:iam::111122223333:role/" + name, Username: name, Groups: []string{group},
+					}},
+				},
+			}
+		}
+
+		By("denying a group bound to permissions alice does not hold")
+		Eventually(func() error {
+			return aliceClient.Create(ctx, newItem("escalation-pods", "pod-readers"))
+		}).Should(MatchError(ContainSubstring("get pods (granted to group pod-readers")))
+
+		By("denying system:masters")
+		err = aliceClient.Create(ctx, newItem("escalation-masters", SystemMastersGroup))
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("cannot grant permissions")))
+
+		By("allowing a group bound to permissions alice holds")
+		bind("escalation-alice-pods", pods.Name, alice)
+		Eventually(func() error {
+			return aliceClient.Create(ctx, newItem("escalation-pods", "pod-readers"))
+		}).Should(Succeed())
+
+		By("allowing any group with the bypass verb")
+		bind("escalation-bypass", bypass.Name, alice)
+		Eventually(func() error {
+			return aliceClient.Create(ctx, newItem("escalation-masters", SystemMastersGroup))
+		}).Should(Succeed())
+	})
+})
@@ -0,0 +1,118 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/mutate-aws-maruina-k8s-v1alpha1-awsauthitem,mutating=true,failurePolicy=fail,sideEffects=None,groups=aws.maruina.k8s,resources=awsauthitems,verbs=create;update,versions=v1alpha1,name=mawsauthitem.aws.maruina.k8s,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/mutate-aws-maruina-k8s-v1alpha1-clusterawsauthitem,mutating=true,failurePolicy=fail,sideEffects=None,groups=aws.maruina.k8s,resources=clusterawsauthitems,verbs=create;update,versions=v1alpha1,name=mclusterawsauthitem.aws.maruina.k8s,admissionReviewVersions=v1
+
+// roleARNNormalizer is a mutating admission handler rewriting the role ARNs
+// of an AWSAuthItem or a ClusterAWSAuthItem to the form matched by the AWS
+// IAM authenticator, with a warning describing each rewrite.
+type roleARNNormalizer struct {
+	decoder admission.Decoder
+	newItem func() Item
+}
+
+var _ admission.Handler = &roleARNNormalizer{}
+
+// Handle implements admission.Handler.
+func (h *roleARNNormalizer) Handle(_ context.Context, req admission.Request) admission.Response {
+	if req.Operation == admissionv1.Delete {
+		return admission.Allowed("")
+	}
+
+	item := h.newItem()
+	if err := h.decoder.Decode(req, item); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	warnings := NormalizeRoleARNs(item.GetSpec())
+	if len(warnings) == 0 {
+		return admission.Allowed("")
+	}
+
+	marshalled, err := json.Marshal(item)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshalled).WithWarnings(warnings...)
+}
+
+// NormalizeRoleARNs rewrites the role ARNs of spec with NormalizeRoleARN, and
+// returns a description of each rewrite.
+func NormalizeRoleARNs(spec *AWSAuthItemSpec) []string {
+	var rewrites []string
+	for i, mapRole := range spec.MapRoles {
+		normalized, ok := NormalizeRoleARN(mapRole.RoleArn)
+		if !ok {
+			continue
+		}
+		spec.MapRoles[i].RoleArn = normalized
+		rewrites = append(rewrites, fmt.Sprintf("spec.mapRoles[%d].rolearn: rewrote %s to %s", i, mapRole.RoleArn, normalized))
+	}
+
+	return rewrites
+}
+
+// NormalizeRoleARN returns the IAM role ARN the AWS IAM authenticator matches
+// for a role ARN, and whether it differs. The authenticator identifies a role
+// by the ARN of its assumed-role session, which has no path, so the path of
+// an IAM role ARN is removed and an STS assumed-role ARN is converted to the
+// IAM role ARN.
+func NormalizeRoleARN(roleARN string) (string, bool) {
+	parsed, err := arn.Parse(roleARN)
+	if err != nil {
+		return roleARN, false
+	}
+
+	var name string
+	switch {
+	case parsed.Service == "iam" && strings.HasPrefix(parsed.Resource, "role/"):
+		parts := strings.Split(parsed.Resource, "/")
+		name = parts[len(parts)-1]
+	case parsed.Service == "sts" && strings.HasPrefix(parsed.Resource, "assumed-role/"):
+		parts := strings.Split(parsed.Resource, "/")
+		if len(parts) < 2 {
+			return roleARN, false
+		}
+		name = parts[1]
+	default:
+		return roleARN, false
+	}
+
+	normalized := arn.ARN{
+		Partition: parsed.Partition,
+		Service:   "iam",
+		AccountID: parsed.AccountID,
+		Resource:  "role/" + name,
+	}.String()
+
+	return normalized, normalized != roleARN
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Role ARN normalization", func() {
+	DescribeTable("NormalizeRoleARN",
+		func(roleARN, expected string, changed bool) {
+			normalized, ok := NormalizeRoleARN(roleARN)
+			Expect(normalized).To(Equal(expected))
+			Expect(ok).To(Equal(changed))
+		},
+		Entry("role without path",
+			"arn:aws:iam::111122223333:role/admin",
+			"arn:aws:iam::111122223333:role/admin", false),
+		Entry("role with an SSO path",
+			"arn:aws:iam::111122223333:role/aws-reserved/sso.amazonaws.com/eu-west-1/AWSReservedSSO_Admin_0123456789abcdef",
+			"arn:aws:iam::111122223333:role/AWSReservedSSO_Admin_0123456789abcdef", true),
+		Entry("assumed role",
+			"arn:aws:sts::111122223333:assumed-role/admin/jane@example.com",
+			"arn:aws:iam::111122223333:role/admin", true),
+		Entry("assumed role in another partition",
+			"arn:aws-cn:sts::111122223333:assumed-role/admin/session",
+			"arn:aws-cn:iam::111122223333:role/admin", true),
+		Entry("user",
+			"arn:aws:iam::111122223333:user/admin",
+			"arn:aws:iam::111122223333:user/admin", false),
+		Entry("invalid ARN", "admin", "admin", false),
+	)
+
+	It("should rewrite the role ARNs of created items", func() {
+		item := &AWSAuthItem{
+			ObjectMeta: metav1.ObjectMeta{Name: "normalized", Namespace: "default"},
+			Spec: AWSAuthItemSpec{
+				MapRoles: []MapRoleItem{{
+					RoleArn:  "arn:aws:sts::111122223333:assumed-role/normalized/session",
+					Username: "normalized",
+					Groups:   []string{"view"},
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, item)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, item)
+
+		var fetched AWSAuthItem
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+		Expect(fetched.Spec.MapRoles[0].RoleArn).To(Equal("arn:aws:iam::111122223333:role/normalized"))
+	})
+})
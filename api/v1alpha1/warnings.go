@@ -0,0 +1,226 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// mappingWarner returns admission warnings for the risky but valid mappings
+// of an AWSAuthItem or a ClusterAWSAuthItem.
+type mappingWarner struct {
+	client client.Reader
+
+	// accountID is the AWS account of the cluster. When not empty, the ARNs
+	// of any other account are reported as cross-account.
+	accountID string
+}
+
+// mappedARN is an IAM ARN mapped by an item, with its field path.
+type mappedARN struct {
+	path  *field.Path
+	value string
+}
+
+// warnings returns the admission warnings for the mappings of item. The
+// warnings needing the other objects of the cluster are skipped, and logged,
+// when they cannot be listed, so that they never block the admission.
+func (w *mappingWarner) warnings(ctx context.Context, item Item) admission.Warnings {
+	spec := item.GetSpec()
+	var warnings admission.Warnings
+
+	arns := mappedARNs(spec)
+	if w.accountID != "" {
+		for _, mapped := range arns {
+			parsed, err := arn.Parse(mapped.value)
+			if err == nil && parsed.AccountID != w.accountID {
+				warnings = append(warnings, fmt.Sprintf("%s: %s is in account %s, not in the account %s of the cluster",
+					mapped.path, mapped.value, parsed.AccountID, w.accountID))
+			}
+		}
+	}
+
+	for i, mapUser := range spec.MapUsers {
+		warnings = append(warnings, fmt.Sprintf("%s: IAM user %s has long-lived credentials, prefer an IAM role",
+			field.NewPath("spec").Child("mapUsers").Index(i).Child("userarn"), mapUser.UserArn))
+	}
+
+	groupPaths := mappedGroups(spec)
+	if path, ok := groupPaths[SystemMastersGroup]; ok {
+		warnings = append(warnings, fmt.Sprintf("%s: %s grants unrestricted access to the cluster, bypassing RBAC",
+			path, SystemMastersGroup))
+	}
+
+	unbound, err := w.unboundGroups(ctx, sets.KeySet(groupPaths))
+	if err != nil {
+		awsauthitemlog.Error(err, "unable to check the bindings of the mapped groups", "name", item.GetName())
+	}
+	for _, group := range unbound {
+		warnings = append(warnings, fmt.Sprintf("%s: group %s is not bound by any RoleBinding or ClusterRoleBinding",
+			groupPaths[group], group))
+	}
+
+	duplicates, err := w.duplicateARNs(ctx, item, arns)
+	if err != nil {
+		awsauthitemlog.Error(err, "unable to check the ARNs mapped by other items", "name", item.GetName())
+	}
+
+	return append(warnings, duplicates...)
+}
+
+// unboundGroups returns the sorted groups that no RoleBinding or
+// ClusterRoleBinding binds. The system: groups, such as system:nodes, are
+// authorized without RBAC bindings and are never returned.
+func (w *mappingWarner) unboundGroups(ctx context.Context, groups sets.Set[string]) ([]string, error) {
+	unbound := sets.New[string]()
+	for group := range groups {
+		if !strings.HasPrefix(group, "system:") {
+			unbound.Insert(group)
+		}
+	}
+	if unbound.Len() == 0 {
+		return nil, nil
+	}
+
+	var clusterRoleBindings rbacv1.ClusterRoleBindingList
+	if err := w.client.List(ctx, &clusterRoleBindings); err != nil {
+		return nil, fmt.Errorf("listing ClusterRoleBindings: %w", err)
+	}
+	for _, binding := range clusterRoleBindings.Items {
+		unbound.Delete(boundGroups(binding.Subjects)...)
+	}
+
+	var roleBindings rbacv1.RoleBindingList
+	if err := w.client.List(ctx, &roleBindings); err != nil {
+		return nil, fmt.Errorf("listing RoleBindings: %w", err)
+	}
+	for _, binding := range roleBindings.Items {
+		unbound.Delete(boundGroups(binding.Subjects)...)
+	}
+
+	return sets.List(unbound), nil
+}
+
+// duplicateARNs returns a warning for each ARN of arns that another
+// AWSAuthItem or ClusterAWSAuthItem already maps.
+func (w *mappingWarner) duplicateARNs(ctx context.Context, item Item, arns []mappedARN) (admission.Warnings, error) {
+	if len(arns) == 0 {
+		return nil, nil
+	}
+
+	var others []Item
+	var itemList AWSAuthItemList
+	if err := w.client.List(ctx, &itemList); err != nil {
+		return nil, fmt.Errorf("listing AWSAuthItems: %w", err)
+	}
+	for i := range itemList.Items {
+		others = append(others, &itemList.Items[i])
+	}
+	var clusterItemList ClusterAWSAuthItemList
+	if err := w.client.List(ctx, &clusterItemList); err != nil {
+		return nil, fmt.Errorf("listing ClusterAWSAuthItems: %w", err)
+	}
+	for i := range clusterItemList.Items {
+		others = append(others, &clusterItemList.Items[i])
+	}
+
+	owners := map[string][]string{}
+	for _, other := range others {
+		if other.GetNamespace() == item.GetNamespace() && other.GetName() == item.GetName() {
+			continue
+		}
+		for _, mapped := range mappedARNs(other.GetSpec()) {
+			owners[mapped.value] = append(owners[mapped.value], itemName(other))
+		}
+	}
+
+	var warnings admission.Warnings
+	for _, mapped := range arns {
+		if names := owners[mapped.value]; len(names) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: %s is already mapped by %s",
+				mapped.path, mapped.value, strings.Join(names, ", ")))
+		}
+	}
+
+	return warnings, nil
+}
+
+// mappedARNs returns the role and user ARNs mapped by spec.
+func mappedARNs(spec *AWSAuthItemSpec) []mappedARN {
+	var arns []mappedARN
+	for i, mapRole := range spec.MapRoles {
+		arns = append(arns, mappedARN{path: field.NewPath("spec").Child("mapRoles").Index(i).Child("rolearn"), value: mapRole.RoleArn})
+	}
+	for i, mapUser := range spec.MapUsers {
+		arns = append(arns, mappedARN{path: field.NewPath("spec").Child("mapUsers").Index(i).Child("userarn"), value: mapUser.UserArn})
+	}
+
+	return arns
+}
+
+// mappedGroups returns the groups mapped by spec, with the path of their
+// first occurrence.
+func mappedGroups(spec *AWSAuthItemSpec) map[string]*field.Path {
+	paths := map[string]*field.Path{}
+	add := func(path *field.Path, groups []string) {
+		for i, group := range groups {
+			if _, ok := paths[group]; !ok {
+				paths[group] = path.Child("groups").Index(i)
+			}
+		}
+	}
+
+	for i, mapRole := range spec.MapRoles {
+		add(field.NewPath("spec").Child("mapRoles").Index(i), mapRole.Groups)
+	}
+	for i, mapUser := range spec.MapUsers {
+		add(field.NewPath("spec").Child("mapUsers").Index(i), mapUser.Groups)
+	}
+
+	return paths
+}
+
+// boundGroups returns the groups among subjects.
+func boundGroups(subjects []rbacv1.Subject) []string {
+	var groups []string
+	for _, subject := range subjects {
+		if subject.Kind == rbacv1.GroupKind {
+			groups = append(groups, subject.Name)
+		}
+	}
+
+	return groups
+}
+
+// itemName returns the kind and the name of an item, such as
+// "AWSAuthItem team-a/deployers" or "ClusterAWSAuthItem nodes".
+func itemName(item Item) string {
+	if item.GetNamespace() == "" {
+		return "ClusterAWSAuthItem " + item.GetName()
+	}
+
+	return "AWSAuthItem " + item.GetNamespace() + "/" + item.GetName()
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Mapping warnings", func() {
+	It("should warn about risky mappings", func() {
+		binding := &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "warnings-view"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"},
+			Subjects:   []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: rbacv1.GroupKind, Name: "warnings-viewers"}},
+		}
+		Expect(k8sClient.Create(ctx, binding)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, binding)
+
+		existing := &ClusterAWSAuthItem{
+			ObjectMeta: metav1.ObjectMeta{Name: "warnings-existing"},
+			Spec: AWSAuthItemSpec{
+				MapRoles: []MapRoleItem{{
+					RoleArn: "arn:aws:iam::111122223333:role/warnings-shared", Username: "shared", Groups: []string{"warnings-viewers"},
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, existing)
+
+		item := &AWSAuthItem{
+			ObjectMeta: metav1.ObjectMeta{Name: "warnings", Namespace: "default"},
+			Spec: AWSAuthItemSpec{
+				MapRoles: []MapRoleItem{
+					{RoleArn: "arn:aws:iam::111122223333:role/warnings-shared", Username: "shared", Groups: []string{"warnings-viewers"}},
+					{RoleArn: "arn:aws:iam::444455556666:role/warnings-admin", Username: "admin", Groups: []string{SystemMastersGroup}},
+				},
+				MapUsers: []MapUserItem{
+					{UserArn: "arn:aws:iam::111122223333:user/warnings-ops", Username: "ops", Groups: []string{"warnings-unbound"}},
+				},
+			},
+		}
+
+		warner := mappingWarner{client: k8sClient, accountID: "111122223333"}
+		Eventually(func() []string {
+			return warner.warnings(ctx, item)
+		}).Should(ConsistOf(
+			"spec.mapRoles[1].rolearn: arn:aws:iam::444455556666:role/warnings-admin is in account 444455556666, not in the account 111122223333 of the cluster",
+			"spec.mapUsers[0].userarn: IAM user arn:aws:iam::111122223333:user/warnings-ops has long-lived credentials, prefer an IAM role",
+			"spec.mapRoles[1].groups[0]: system:masters grants unrestricted access to the cluster, bypassing RBAC",
+			"spec.mapUsers[0].groups[0]: group warnings-unbound is not bound by any RoleBinding or ClusterRoleBinding",
+			"spec.mapRoles[0].rolearn: arn:aws:iam::111122223333:role/warnings-shared is already mapped by ClusterAWSAuthItem warnings-existing",
+		))
+	})
+
+	It("should not warn about the mappings of the item itself", func() {
+		item := &ClusterAWSAuthItem{
+			ObjectMeta: metav1.ObjectMeta{Name: "warnings-self"},
+			Spec: AWSAuthItemSpec{
+				MapRoles: []MapRoleItem{{
+					RoleArn: "arn:aws:iam::111122223333:role/warnings-self", Username: "self", Groups: []string{"system:nodes"},
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, item)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, item)
+
+		warner := mappingWarner{client: k8sClient}
+		Expect(warner.warnings(ctx, item)).To(BeEmpty())
+	})
+})
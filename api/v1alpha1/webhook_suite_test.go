@@ -32,6 +32,8 @@ import (
 	//+kubebuilder:scaffold:imports
 	admissionv1 "k8s.io/api/admission/v1"
 	apimachineryruntime "k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
@@ -45,6 +47,7 @@ import (
 // http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
 
 var (
+	cfg       *rest.Config
 	k8sClient client.Client
 	testEnv   *envtest.Environment
 	ctx       context.Context
@@ -80,11 +83,15 @@ var _ = BeforeSuite(func(suiteCtx SpecContext) {
 		},
 	}
 
-	cfg, err := testEnv.Start()
+	var err error
+	cfg, err = testEnv.Start()
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
 	scheme := apimachineryruntime.NewScheme()
+	err = clientgoscheme.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	err = AddToScheme(scheme)
 	Expect(err).NotTo(HaveOccurred())
 
@@ -111,7 +118,10 @@ var _ = BeforeSuite(func(suiteCtx SpecContext) {
 	})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = (&AWSAuthItem{}).SetupWebhookWithManager(mgr)
+	err = (&AWSAuthItem{}).SetupWebhookWithManager(mgr, WebhookOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&ClusterAWSAuthItem{}).SetupWebhookWithManager(mgr, WebhookOptions{})
 	Expect(err).NotTo(HaveOccurred())
 
 	//+kubebuilder:scaffold:webhook
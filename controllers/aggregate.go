@@ -0,0 +1,855 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/util/csaupgrade"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/render"
+)
+
+// DefaultAggregateDebounce is the default delay between the first event
+// changing the aggregated mappings and their rendering.
+const DefaultAggregateDebounce = time.Second
+
+// aggregateResult is the outcome of the last rendering of the aggregated
+// mappings, from which the status of every item is computed.
+type aggregateResult struct {
+	// generations are the generations of the items, not being deleted, whose
+	// mappings were rendered.
+	generations map[client.ObjectKey]int64
+
+	violations map[client.ObjectKey]field.ErrorList
+
+	// frozen are the items with spec.dryRun, whose mappings are rendered as
+	// they are in the ConfigMaps of their targets.
+	frozen map[client.ObjectKey]bool
+
+	// targets are the outcomes of the rendering of every target, starting
+	// with the aws-auth ConfigMap of the controller.
+	targets []*targetResult
+
+	// failure is set when the items could not be listed, so that no target
+	// was rendered.
+	failure *aggregateFailure
+}
+
+// targetResult is the outcome of the rendering of the mappings of the items
+// routed to a target.
+type targetResult struct {
+	target target
+
+	// client reads and writes the ConfigMap of target, on the remote cluster
+	// of an AWSAuthTarget with a kubeconfig.
+	client client.Client
+
+	// routed are the items rendered to target, including the ones being
+	// deleted.
+	routed map[client.ObjectKey]bool
+
+	agg render.Aggregation
+
+	// message describes the successful rendering.
+	message string
+
+	// conflicts are the field managers conflicting with the apply of the
+	// ConfigMap, and forced whether their fields were taken over.
+	conflicts []string
+	forced    bool
+
+	// safetyCheck describes the safety guards tripped by the rendering, which
+	// was not written.
+	safetyCheck string
+
+	// items name the items whose mappings were rendered, recorded in the
+	// revisions of the ConfigMap.
+	items []string
+
+	// pinned is the revision the ConfigMap is pinned to, whose mappings were
+	// written instead of the aggregated ones.
+	pinned string
+
+	// pending are the changes of the ConfigMap not written because of a dry
+	// run.
+	pending []render.Change
+
+	// drift describes the changes of the ConfigMap by another client since it
+	// was rendered, reverted by the rendering unless reported only.
+	drift string
+
+	// failure is set when the aggregated mappings could not be written.
+	failure *aggregateFailure
+}
+
+// aggregateFailure describes why the aggregated mappings could not be written.
+type aggregateFailure struct {
+	// reason is the reason of the Ready condition of the items.
+	reason string
+
+	// action and note are the action and the note of the warning event
+	// emitted on the items.
+	action string
+	note   string
+
+	err error
+}
+
+// aggregateReconciler renders the mappings of all the AWSAuthItems and
+// ClusterAWSAuthItems at once. All its events are enqueued as the same
+// request, so that a burst of events is rendered once.
+type aggregateReconciler struct {
+	*AWSAuthItemReconciler
+}
+
+// Reconcile renders the aggregated mappings of every target, then triggers
+// the status pass of every item.
+func (r *aggregateReconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("aggregate reconciliation started")
+
+	// Get all the AWSAuthItem and ClusterAWSAuthItem
+	items, violations, err := r.listItems(ctx)
+	if err != nil {
+		r.setResult(&aggregateResult{failure: &aggregateFailure{
+			reason: awsauthv1alpha1.ListAWSAuthItemFailedReason,
+			action: "ListFailed",
+			note:   "Failed to list AWSAuthItems",
+			err:    err,
+		}})
+
+		return ctrl.Result{}, err
+	}
+
+	targets, err := r.listTargets(ctx)
+	if err != nil {
+		r.setResult(&aggregateResult{failure: &aggregateFailure{
+			reason: awsauthv1alpha1.ListAWSAuthTargetFailedReason,
+			action: "ListFailed",
+			note:   "Failed to list AWSAuthTargets",
+			err:    err,
+		}})
+
+		return ctrl.Result{}, err
+	}
+
+	result := &aggregateResult{
+		generations: map[client.ObjectKey]int64{},
+		violations:  violations,
+		frozen:      map[client.ObjectKey]bool{},
+	}
+	for _, item := range items {
+		key := client.ObjectKeyFromObject(item)
+		if item.GetDeletionTimestamp().IsZero() {
+			result.generations[key] = item.GetGeneration()
+			if item.GetSpec().DryRun {
+				result.frozen[key] = true
+			}
+		}
+	}
+
+	// Render every target, refusing the ConfigMaps already rendered by a
+	// previous target
+	r.pruneRemotes(ctx, targets)
+	forgetTargets(r.lastResult(), targets)
+	var errs []error
+	var rendered []*targetResult
+	renderedBy := map[configMapKey]target{}
+	for i, routed := range routeItems(targets, items) {
+		t := &targetResult{
+			target: targets[i],
+			routed: map[client.ObjectKey]bool{},
+			agg:    render.Aggregate(routed, r.conflictPolicy()),
+		}
+		for _, item := range routed {
+			key := client.ObjectKeyFromObject(item)
+			t.routed[key] = true
+			if item.GetDeletionTimestamp().IsZero() && !t.agg.Rejected[key] {
+				t.items = append(t.items, render.ItemName(key))
+			}
+		}
+		sort.Strings(t.items)
+		result.targets = append(result.targets, t)
+
+		if t.target.selectorErr != nil {
+			t.failure = &aggregateFailure{
+				reason: awsauthv1alpha1.InvalidItemSelectorReason,
+				action: "RenderFailed",
+				note:   "Refused to render ConfigMap",
+				err:    t.target.selectorErr,
+			}
+		} else if other, ok := renderedBy[t.target.key()]; ok {
+			t.failure = &aggregateFailure{
+				reason: awsauthv1alpha1.TargetConflictReason,
+				action: "RenderFailed",
+				note:   "Refused to render ConfigMap",
+				err:    fmt.Errorf("ConfigMap %s is already rendered by %s", t.target.configMap, other),
+			}
+		} else {
+			renderedBy[t.target.key()] = t.target
+			t.client = r.Client
+			if t.target.kubeConfig != nil {
+				t.client, t.failure = r.remoteClient(ctx, t.target)
+			}
+			if t.failure == nil {
+				t.message, t.failure = r.write(ctx, result, t)
+			}
+			rendered = append(rendered, t)
+			recordConflicts(t)
+		}
+		if err := r.setTargetStatus(ctx, t); err != nil {
+			log.Error(err, "unable to update the AWSAuthTarget status")
+			errs = append(errs, err)
+		}
+
+		if t.target.name != "" {
+			if t.failure != nil {
+				t.failure.err = fmt.Errorf("%s: %w", t.target, t.failure.err)
+			} else {
+				t.message = fmt.Sprintf("%s: %s", t.target, t.message)
+			}
+		}
+		if t.failure != nil {
+			errs = append(errs, t.failure.err)
+		}
+	}
+
+	recordMappings(rendered)
+	r.setResult(result)
+	r.notifyItems(ctx, items)
+
+	// Render again after the resync interval, so that the ConfigMaps are
+	// verified and their last write metric stays current without events
+	if err := errors.Join(errs...); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+}
+
+// write writes the aggregated mappings of t to its ConfigMap or, for the
+// aws-auth ConfigMap of the controller, to the configured backend, and
+// returns the message describing the update or the failure.
+func (r *aggregateReconciler) write(ctx context.Context, result *aggregateResult, t *targetResult) (string, *aggregateFailure) {
+	agg := render.SelectKeys(t.agg, t.target.keys)
+	backend := r.Backend
+	if t.target.name != "" {
+		backend = BackendConfigMap
+	}
+
+	if backend == BackendAccessEntries {
+		if r.DryRun {
+			return "Dry run, EKS access entries not updated", nil
+		}
+		if err := r.applyAccessEntries(ctx, agg); err != nil {
+			return "", &aggregateFailure{
+				reason: awsauthv1alpha1.ApplyAccessEntriesFailedReason,
+				action: "UpdateFailed",
+				note:   "Failed to update EKS access entries",
+				err:    fmt.Errorf("applying EKS access entries: %w", err),
+			}
+		}
+
+		return "EKS access entries updated successfully", nil
+	}
+
+	if failure := r.writeConfigMap(ctx, agg, t, result.frozen); failure != nil {
+		return "", failure
+	}
+	if r.DryRun {
+		return "Dry run, aws-auth ConfigMap not updated", nil
+	}
+
+	// Write the same mappings as EKS access entries when migrating
+	if backend == BackendDualWrite {
+		if err := r.applyAccessEntries(ctx, agg); err != nil {
+			return "", &aggregateFailure{
+				reason: awsauthv1alpha1.ApplyAccessEntriesFailedReason,
+				action: "UpdateFailed",
+				note:   "Failed to update EKS access entries",
+				err:    fmt.Errorf("applying EKS access entries: %w", err),
+			}
+		}
+
+		return "aws-auth ConfigMap and EKS access entries updated successfully", nil
+	}
+
+	return "aws-auth ConfigMap updated successfully", nil
+}
+
+// writeConfigMap renders agg to the ConfigMap of t with a server-side apply,
+// creating it if it doesn't exist. The mappings of the frozen items are kept
+// as they are. The field managers conflicting with the apply are recorded in
+// t.
+func (r *aggregateReconciler) writeConfigMap(ctx context.Context, agg render.Aggregation, t *targetResult, frozen map[client.ObjectKey]bool) *aggregateFailure {
+	log := log.FromContext(ctx).WithValues("configMap", t.target.configMap)
+
+	// Get the aws-auth configMap, starting from an empty one if it doesn't
+	// exist, as the apply creates it
+	var authCm corev1.ConfigMap
+	err := t.client.Get(ctx, t.target.configMap, &authCm)
+	exists := err == nil
+	if apierrors.IsNotFound(err) {
+		authCm = *render.NewConfigMap(t.target.configMap.Name, t.target.configMap.Namespace)
+	} else if err != nil {
+		return &aggregateFailure{
+			reason: awsauthv1alpha1.GetAwsAuthConfigMapFailedReason,
+			action: "GetFailed",
+			note:   "Failed to fetch aws-auth ConfigMap",
+			err:    fmt.Errorf("fetching aws-auth ConfigMap: %w", err),
+		}
+	}
+
+	writeFailure := func(err error) *aggregateFailure {
+		if !exists {
+			return &aggregateFailure{
+				reason: awsauthv1alpha1.CreateAwsAuthConfigMapFailedReason,
+				action: "CreateFailed",
+				note:   "Failed to create aws-auth ConfigMap",
+				err:    fmt.Errorf("creating aws-auth ConfigMap: %w", err),
+			}
+		}
+
+		return &aggregateFailure{
+			reason: awsauthv1alpha1.UpdateAwsAuthConfigMapFailedReason,
+			action: "UpdateFailed",
+			note:   "Failed to update aws-auth ConfigMap",
+			err:    fmt.Errorf("applying aws-auth ConfigMap: %w", err),
+		}
+	}
+
+	// Move the fields patched by the previous versions to the field manager
+	// of the apply, so that they don't conflict with it
+	if exists {
+		patch, err := csaupgrade.UpgradeManagedFieldsPatch(&authCm, sets.New(legacyFieldManager), FieldManager)
+		if err != nil {
+			return writeFailure(fmt.Errorf("upgrading managed fields: %w", err))
+		}
+		if patch != nil {
+			if err := t.client.Patch(ctx, authCm.DeepCopy(), client.RawPatch(types.JSONPatchType, patch)); err != nil {
+				return writeFailure(fmt.Errorf("upgrading managed fields: %w", err))
+			}
+			log.Info("moved the aws-auth ConfigMap fields to the field manager", "from", legacyFieldManager, "to", FieldManager)
+		}
+	}
+
+	// Render the aggregated mappings, keeping the entries created by other
+	// tools in merge mode, or the mappings of the pinned revision, and apply
+	// them unless the configmap already holds the rendered content
+	live := authCm.DeepCopy()
+	if t.pinned = live.Annotations[render.PinnedRevisionAnnotation]; t.pinned != "" {
+		var revision corev1.ConfigMap
+		if err := t.client.Get(ctx, types.NamespacedName{Name: t.pinned, Namespace: r.revisionNamespace(t.target)}, &revision); err != nil {
+			return &aggregateFailure{
+				reason: awsauthv1alpha1.GetPinnedRevisionFailedReason,
+				action: "GetFailed",
+				note:   "Failed to fetch pinned revision",
+				err:    fmt.Errorf("fetching revision %s pinned by the aws-auth ConfigMap: %w", t.pinned, err),
+			}
+		}
+		render.Restore(&authCm, &revision)
+	} else {
+		// Keep the mappings of the items with spec.dryRun as they are
+		applied := agg
+		if len(frozen) > 0 {
+			liveAgg, err := render.ParseConfigMap(live)
+			if err != nil {
+				return parseFailure(err)
+			}
+			applied = render.Freeze(agg, liveAgg, frozen)
+		}
+		if err := render.ConfigMap(&authCm, applied, r.ConfigMapMode); err != nil {
+			return renderFailure(err)
+		}
+		if failure := r.plan(ctx, live, &authCm, agg, t, len(frozen) > 0); failure != nil {
+			return failure
+		}
+	}
+
+	if r.DryRun {
+		log.V(1).Info("dry run, skipping apply")
+		return nil
+	}
+
+	if exists && render.Unchanged(live, &authCm) {
+		log.V(1).Info("aws-auth ConfigMap is up to date, skipping apply")
+		recordWrite(t, &authCm)
+		r.recordRevision(ctx, &authCm, t)
+		return nil
+	}
+
+	if exists {
+		if failure := r.checkDrift(ctx, live, &authCm, t); failure != nil {
+			return failure
+		}
+		if failure := r.checkSafety(ctx, live, &authCm, t); failure != nil {
+			return failure
+		}
+	}
+
+	applied := render.ApplyConfiguration(&authCm)
+	err = t.client.Apply(ctx, applied, client.FieldOwner(FieldManager))
+	if t.conflicts = applyConflicts(err); len(t.conflicts) > 0 {
+		message := "aws-auth ConfigMap fields are managed by other field managers: " + strings.Join(t.conflicts, ", ")
+		if !r.ForceOwnership {
+			r.Recorder.Eventf(t.eventObject(&authCm), nil, corev1.EventTypeWarning, awsauthv1alpha1.FieldManagerConflictReason,
+				"Apply", "%s; not applied, run the controller with --force-ownership to take them over", message)
+
+			return &aggregateFailure{
+				reason: awsauthv1alpha1.FieldManagerConflictReason,
+				action: "ApplyFailed",
+				note:   "Failed to apply aws-auth ConfigMap",
+				err:    errors.New(message),
+			}
+		}
+
+		r.Recorder.Eventf(t.eventObject(&authCm), nil, corev1.EventTypeWarning, awsauthv1alpha1.FieldManagerConflictReason,
+			"Apply", "%s; taking them over", message)
+		t.forced = true
+		err = t.client.Apply(ctx, applied, client.FieldOwner(FieldManager), client.ForceOwnership)
+	}
+	if err != nil {
+		return writeFailure(err)
+	}
+	log.Info("aws-auth ConfigMap applied")
+	if t.drift != "" {
+		r.Recorder.Eventf(t.eventObject(&authCm), nil, corev1.EventTypeNormal, awsauthv1alpha1.DriftCorrectedReason,
+			"Apply", "Reverted %s", t.drift)
+		log.Info("aws-auth ConfigMap changes by another client reverted")
+		driftCorrectionsTotal.WithLabelValues(t.target.configMap.String(), t.target.cluster()).Inc()
+	}
+	recordWrite(t, &authCm)
+	r.recordRevision(ctx, &authCm, t)
+
+	return nil
+}
+
+// checkDrift records in t the changes of live, the ConfigMap of t, by another
+// client since it was rendered that writing desired reverts, and emits a
+// warning event naming the field managers of the changed keys. With
+// DriftPolicyReport, it returns a failure so that they are not reverted.
+func (r *aggregateReconciler) checkDrift(ctx context.Context, live, desired *corev1.ConfigMap, t *targetResult) *aggregateFailure {
+	log := log.FromContext(ctx)
+
+	keys := render.DriftedKeys(live)
+	if len(keys) == 0 {
+		return nil
+	}
+	drift, err := render.Drift(live, desired)
+	switch {
+	case err != nil:
+		// The entries of a key that can't be parsed are replaced as a whole
+		t.drift = fmt.Sprintf("%s, which can't be parsed (%s)", strings.Join(keys, ", "), err)
+	case len(drift) == 0:
+		// Only the formatting changed, or entries kept by the rendering
+		return nil
+	default:
+		t.drift = fmt.Sprintf("%d change(s): %s", len(drift), describeChanges(drift))
+	}
+
+	managers, err := render.DataManagers(live, keys, FieldManager, legacyFieldManager)
+	if err != nil {
+		log.Info("unable to find the field managers of the aws-auth ConfigMap changes", "reason", err.Error())
+	}
+	by := "an unknown field manager"
+	if len(managers) > 0 {
+		by = strings.Join(managers, ", ")
+	}
+	message := fmt.Sprintf("aws-auth ConfigMap changed by %s since it was rendered, %s", by, t.drift)
+
+	// Report the drift once while it can't be reverted
+	if previous := r.lastResult().targetOf(t.target); previous == nil || previous.failure == nil || previous.drift != t.drift {
+		r.Recorder.Eventf(t.eventObject(live), nil, corev1.EventTypeWarning, awsauthv1alpha1.DriftDetectedReason,
+			"Apply", "%s", message)
+		log.Info("aws-auth ConfigMap changed by another client", "configMap", t.target.configMap, "managers", managers)
+	}
+
+	if r.DriftPolicy != DriftPolicyReport {
+		return nil
+	}
+
+	return &aggregateFailure{
+		reason: awsauthv1alpha1.DriftDetectedReason,
+		action: "ApplyFailed",
+		note:   "Refused to revert aws-auth ConfigMap changes",
+		err: fmt.Errorf("%s; not reverted with the %s drift policy, revert them or map them with an item",
+			message, DriftPolicyReport),
+	}
+}
+
+// plan records in t the changes of the aws-auth ConfigMap not written because
+// of a dry run: with --dry-run, every change from live to the rendering of
+// agg, otherwise the changes of the frozen items with spec.dryRun from
+// applied, the rendering written instead.
+func (r *aggregateReconciler) plan(ctx context.Context, live, applied *corev1.ConfigMap, agg render.Aggregation, t *targetResult, frozen bool) *aggregateFailure {
+	if !r.DryRun && !frozen {
+		return nil
+	}
+
+	desired := live.DeepCopy()
+	if err := render.ConfigMap(desired, agg, r.ConfigMapMode); err != nil {
+		return renderFailure(err)
+	}
+
+	base := applied
+	if r.DryRun {
+		base = live
+	}
+	changes, err := render.Diff(base, desired)
+	if err != nil {
+		return parseFailure(err)
+	}
+	t.pending = changes
+
+	if previous := r.lastResult().targetOf(t.target); r.DryRun && len(changes) > 0 &&
+		(previous == nil || !equality.Semantic.DeepEqual(previous.pending, changes)) {
+		r.Recorder.Eventf(t.eventObject(live), nil, corev1.EventTypeNormal, awsauthv1alpha1.DryRunReason,
+			"Plan", "Dry run, %d change(s) not applied: %s", len(changes), describeChanges(changes))
+		log.FromContext(ctx).Info("dry run, aws-auth ConfigMap changes not applied",
+			"configMap", t.target.configMap, "changes", len(changes))
+	}
+
+	return nil
+}
+
+// pendingOf returns the pending changes of the entries owned by the item
+// with the given key.
+func (t *targetResult) pendingOf(key client.ObjectKey) []render.Change {
+	var changes []render.Change
+	for _, change := range t.pending {
+		if change.Owner == key {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// targetOf returns the outcome of the rendering of the ConfigMap of target,
+// or nil if r is nil or the ConfigMap was not rendered.
+func (r *aggregateResult) targetOf(target target) *targetResult {
+	if r == nil {
+		return nil
+	}
+	for _, t := range r.targets {
+		if t.target.key() == target.key() {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// eventObject returns the object the events about cm, the ConfigMap of t, are
+// recorded on: cm itself, or the AWSAuthTarget when cm is on a remote
+// cluster.
+func (t *targetResult) eventObject(cm *corev1.ConfigMap) runtime.Object {
+	if t.target.kubeConfig != nil {
+		return t.target.object
+	}
+
+	return cm
+}
+
+// of returns the outcome of the rendering of the targets of the item with the
+// given key, merged: the first failure and pinned revision, and all the
+// conflicts, tripped safety guards and pending changes of the item.
+func (r *aggregateResult) of(key client.ObjectKey) *targetResult {
+	merged := &targetResult{
+		agg:     render.Aggregation{Rejected: map[client.ObjectKey]bool{}},
+		failure: r.failure,
+	}
+
+	var messages, safetyChecks []string
+	conflicts := map[render.Conflict]bool{}
+	for _, t := range r.targets {
+		if !t.routed[key] {
+			continue
+		}
+		if merged.failure == nil {
+			merged.failure = t.failure
+		}
+		if merged.pinned == "" {
+			merged.pinned = t.pinned
+		}
+		if t.message != "" && !slices.Contains(messages, t.message) {
+			messages = append(messages, t.message)
+		}
+		if t.safetyCheck != "" {
+			safetyChecks = append(safetyChecks, t.safetyCheck)
+		}
+		merged.conflicts = append(merged.conflicts, t.conflicts...)
+		merged.forced = merged.forced || t.forced
+		merged.pending = append(merged.pending, t.pendingOf(key)...)
+
+		for _, conflict := range t.agg.ConflictsOf(key) {
+			if !conflicts[conflict] {
+				conflicts[conflict] = true
+				merged.agg.Conflicts = append(merged.agg.Conflicts, conflict)
+			}
+		}
+		if t.agg.Rejected[key] {
+			merged.agg.Rejected[key] = true
+		}
+	}
+	merged.message = strings.Join(messages, "; ")
+	merged.safetyCheck = strings.Join(safetyChecks, "; ")
+	sort.Strings(merged.conflicts)
+	merged.conflicts = slices.Compact(merged.conflicts)
+
+	return merged
+}
+
+// describeChanges returns the changes as a single line.
+func describeChanges(changes []render.Change) string {
+	descriptions := make([]string, len(changes))
+	for i, change := range changes {
+		descriptions[i] = change.String()
+	}
+
+	return strings.Join(descriptions, "; ")
+}
+
+// renderFailure returns the failure of an error returned by render.ConfigMap.
+func renderFailure(err error) *aggregateFailure {
+	return &aggregateFailure{
+		reason: renderFailedReason(err),
+		action: "RenderFailed",
+		note:   "Failed to render aws-auth ConfigMap",
+		err:    fmt.Errorf("rendering aws-auth ConfigMap: %w", err),
+	}
+}
+
+// parseFailure returns the failure of an error parsing the aws-auth
+// ConfigMap.
+func parseFailure(err error) *aggregateFailure {
+	return &aggregateFailure{
+		reason: awsauthv1alpha1.ParseAwsAuthConfigMapFailedReason,
+		action: "ParseFailed",
+		note:   "Failed to parse aws-auth ConfigMap",
+		err:    fmt.Errorf("parsing aws-auth ConfigMap: %w", err),
+	}
+}
+
+// recordRevision records the mappings of cm, the ConfigMap of t as applied,
+// as its latest revision unless they already are, and deletes the revisions
+// beyond the history limit. Nothing is recorded while cm is pinned to a
+// revision. A failure to record the revision doesn't fail the rendering, so it
+// is only reported.
+func (r *aggregateReconciler) recordRevision(ctx context.Context, cm *corev1.ConfigMap, t *targetResult) {
+	if r.RevisionHistoryLimit <= 0 || t.pinned != "" {
+		return
+	}
+
+	log := log.FromContext(ctx)
+	if err := r.writeRevision(ctx, t.client, cm, r.revisionNamespace(t.target), t.items); err != nil {
+		log.Error(err, "unable to record the aws-auth ConfigMap revision")
+		r.Recorder.Eventf(t.eventObject(cm), nil, corev1.EventTypeWarning, "RecordRevisionFailed",
+			"RecordRevision", "Failed to record aws-auth ConfigMap revision: %s", err.Error())
+	}
+}
+
+// writeRevision applies the revision of cm, rendered from items, in
+// namespace with c and prunes the oldest revisions.
+func (r *aggregateReconciler) writeRevision(ctx context.Context, c client.Client, cm *corev1.ConfigMap, namespace string, items []string) error {
+	log := log.FromContext(ctx)
+
+	var revisions corev1.ConfigMapList
+	if err := c.List(ctx, &revisions, client.InNamespace(namespace),
+		client.MatchingLabels{render.RevisionLabel: cm.Name}); err != nil {
+		return fmt.Errorf("listing revisions: %w", err)
+	}
+
+	render.SortRevisions(revisions.Items)
+	hash := render.RevisionHash(cm)
+	if len(revisions.Items) > 0 && revisions.Items[0].Annotations[render.RevisionHashAnnotation] == hash {
+		return nil
+	}
+
+	revision, err := render.NewRevision(cm, namespace, items, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := c.Apply(ctx, revision, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+		return fmt.Errorf("applying revision %s: %w", *revision.Name, err)
+	}
+	log.Info("aws-auth ConfigMap revision recorded", "revision", *revision.Name)
+
+	// The revision rendered again replaces the previous one with its name
+	kept := []corev1.ConfigMap{{ObjectMeta: metav1.ObjectMeta{
+		Name:        *revision.Name,
+		Annotations: revision.Annotations,
+	}}}
+	for _, existing := range revisions.Items {
+		if existing.Name != *revision.Name {
+			kept = append(kept, existing)
+		}
+	}
+	for _, pruned := range render.PruneRevisions(kept, r.RevisionHistoryLimit) {
+		pruned.Namespace = namespace
+		if err := c.Delete(ctx, &pruned); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("deleting revision %s: %w", pruned.Name, err)
+		}
+		log.Info("aws-auth ConfigMap revision pruned", "revision", pruned.Name)
+	}
+
+	return nil
+}
+
+// checkSafety returns a failure when replacing the live aws-auth ConfigMap
+// with the desired one trips a safety guard, unless the
+// render.OverrideSafetyChecksAnnotation of live approves this rendering.
+func (r *aggregateReconciler) checkSafety(ctx context.Context, live, desired *corev1.ConfigMap, t *targetResult) *aggregateFailure {
+	log := log.FromContext(ctx)
+
+	tripped, err := render.CheckSafety(live, desired, r.SafetyGuards)
+	if err != nil {
+		// The mappings of a ConfigMap that can't be parsed are already lost
+		log.Info("skipping the safety checks", "reason", err.Error())
+		return nil
+	}
+	if len(tripped) == 0 {
+		return nil
+	}
+
+	message := "aws-auth ConfigMap change " + strings.Join(tripped, ", ")
+	hash := render.RevisionHash(desired)
+	if live.Annotations[render.OverrideSafetyChecksAnnotation] == hash {
+		r.Recorder.Eventf(t.eventObject(live), nil, corev1.EventTypeWarning, "SafetyCheckOverridden",
+			"Apply", "%s; applied as approved by the %s annotation", message, render.OverrideSafetyChecksAnnotation)
+		return nil
+	}
+
+	t.safetyCheck = fmt.Sprintf("%s; set the %s annotation of the aws-auth ConfigMap to %s to apply it anyway",
+		message, render.OverrideSafetyChecksAnnotation, hash)
+	r.Recorder.Eventf(t.eventObject(live), nil, corev1.EventTypeWarning, awsauthv1alpha1.SafetyCheckFailedReason,
+		"Apply", "%s", t.safetyCheck)
+
+	return &aggregateFailure{
+		reason: awsauthv1alpha1.SafetyCheckFailedReason,
+		action: "ApplyFailed",
+		note:   "Refused to apply aws-auth ConfigMap",
+		err:    errors.New(t.safetyCheck),
+	}
+}
+
+// applyConflicts returns the sorted field managers, with their field,
+// conflicting with a server-side apply that failed with err, such as
+// `"eksctl" using v1 (.data.mapRoles)`.
+func applyConflicts(err error) []string {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return nil
+	}
+
+	var conflicts []string
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type == metav1.CauseTypeFieldManagerConflict {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%s)", strings.TrimPrefix(cause.Message, "conflict with "), cause.Field))
+		}
+	}
+	sort.Strings(conflicts)
+
+	return conflicts
+}
+
+// notifyItems triggers the status pass of items.
+func (r *aggregateReconciler) notifyItems(ctx context.Context, items []awsauthv1alpha1.Item) {
+	for _, item := range items {
+		events := r.itemEvents
+		if item.GetNamespace() == "" {
+			events = r.clusterItemEvents
+		}
+
+		select {
+		case events <- event.GenericEvent{Object: item}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// setResult records the outcome of the last aggregate reconciliation.
+func (r *AWSAuthItemReconciler) setResult(result *aggregateResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.result = result
+}
+
+// lastResult returns the outcome of the last aggregate reconciliation, or nil
+// if none completed yet.
+func (r *AWSAuthItemReconciler) lastResult() *aggregateResult {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.result
+}
+
+// enqueueAggregate returns an event handler enqueueing the aggregate request
+// after the configured debounce. The events received while the request is
+// waiting are merged into it.
+func (r *AWSAuthItemReconciler) enqueueAggregate() handler.EventHandler {
+	enqueue := func(q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+		debounce := r.AggregateDebounce
+		if debounce == 0 {
+			debounce = DefaultAggregateDebounce
+		}
+		q.AddAfter(reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      r.AWSAuthConfigMapName,
+			Namespace: r.AWSAuthConfigMapNamespace,
+		}}, debounce)
+	}
+
+	return handler.Funcs{
+		CreateFunc: func(_ context.Context, _ event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(q)
+		},
+		UpdateFunc: func(_ context.Context, _ event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(q)
+		},
+		DeleteFunc: func(_ context.Context, _ event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(q)
+		},
+		GenericFunc: func(_ context.Context, _ event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(q)
+		},
+	}
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gmeasure"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+)
+
+// benchmarkItems is the number of AWSAuthItems created by the benchmarks.
+const benchmarkItems = 100
+
+// createBenchmarkItems creates benchmarkItems AWSAuthItems mapping a role each,
+// deleted when the spec completes.
+func createBenchmarkItems(prefix string) []*awsauthv1alpha1.AWSAuthItem {
+	items := make([]*awsauthv1alpha1.AWSAuthItem, benchmarkItems)
+	for i := range items {
+		name := uniqueName(prefix)
+		items[i] = &awsauthv1alpha1.AWSAuthItem{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: reconciler.AWSAuthConfigMapNamespace,
+			},
+			Spec: awsauthv1alpha1.AWSAuthItemSpec{
+				MapRoles: []awsauthv1alpha1.MapRoleItem{
+					{
+						RoleArn:  fmt.Sprintf("arn:aws:iam::111122223333:role/%s", name),
+						Username: name,
+						Groups:   []string{"view"},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, items[i])).To(Succeed())
+	}
+
+	DeferCleanup(func() {
+		for _, item := range items {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, item))).To(Succeed())
+		}
+		Eventually(func(g Gomega) {
+			for _, item := range items {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			}
+		}).Should(Succeed())
+	})
+
+	return items
+}
+
+// waitForReady waits until the current generation of every item is Ready.
+func waitForReady(items []*awsauthv1alpha1.AWSAuthItem) {
+	Eventually(func(g Gomega) {
+		for _, item := range items {
+			var fetched awsauthv1alpha1.AWSAuthItem
+			g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+			g.Expect(fetched.Status.ObservedGeneration).To(Equal(fetched.Generation))
+			g.Expect(apimeta.IsStatusConditionTrue(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)).To(BeTrue())
+		}
+	}).Should(Succeed())
+}
+
+// waitForIdle waits until the manager stops sending requests to the API
+// server, so that the requests of a previous change are not counted.
+func waitForIdle() {
+	Eventually(func() map[string]int {
+		snapshot := apiRequests.snapshot()
+		time.Sleep(2 * reconciler.AggregateDebounce)
+		return apiRequests.since(snapshot)
+	}).Should(BeEmpty())
+}
+
+// recordRequests records in experiment the requests sent by the manager.
+func recordRequests(experiment *gmeasure.Experiment, requests map[string]int) {
+	experiment.RecordValue("API requests", float64(totalRequests(requests)))
+	experiment.RecordValue("aws-auth ConfigMap writes", float64(configMapWrites(requests)))
+	experiment.RecordValue("status patches", float64(requests["PATCH awsauthitems/status"]))
+}
+
+// totalRequests returns the number of requests among requests.
+func totalRequests(requests map[string]int) int {
+	var total int
+	for _, count := range requests {
+		total += count
+	}
+	return total
+}
+
+// configMapWrites returns the number of ConfigMap writes among requests.
+func configMapWrites(requests map[string]int) int {
+	var writes int
+	for key, count := range requests {
+		method, resource, _ := strings.Cut(key, " ")
+		if resource == "configmaps" && method != "GET" {
+			writes += count
+		}
+	}
+	return writes
+}
+
+var _ = Describe("Aggregate reconciliation", Label("benchmark"), func() {
+	SetDefaultEventuallyTimeout(eventuallyTimeout)
+	SetDefaultEventuallyPollingInterval(eventuallyInterval)
+
+	BeforeEach(func() {
+		// The items emit more events than the fake recorder buffers
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-fakeRecorder.Events:
+				case <-done:
+					return
+				}
+			}
+		}()
+		DeferCleanup(func() { close(done) })
+
+		waitForIdle()
+	})
+
+	It("should render a burst of items with a few ConfigMap writes", func() {
+		experiment := gmeasure.NewExperiment("burst of AWSAuthItems")
+		AddReportEntry(experiment.Name, experiment)
+
+		before := apiRequests.snapshot()
+		experiment.MeasureDuration("time to ready", func() {
+			waitForReady(createBenchmarkItems("burst"))
+		})
+		requests := apiRequests.since(before)
+		recordRequests(experiment, requests)
+
+		// Rendering on every item reconciliation writes the ConfigMap once
+		// per item. Every write also records a revision and prunes the
+		// oldest one
+		Expect(configMapWrites(requests)).To(BeNumerically("<", 3*benchmarkItems/10))
+	})
+
+	It("should render an external change of the aws-auth ConfigMap once", func() {
+		items := createBenchmarkItems("external")
+		waitForReady(items)
+		waitForIdle()
+
+		experiment := gmeasure.NewExperiment("external change of the aws-auth ConfigMap")
+		AddReportEntry(experiment.Name, experiment)
+
+		before := apiRequests.snapshot()
+		experiment.MeasureDuration("time to restore", func() {
+			cm, err := getAWSAuthConfigMap()
+			Expect(err).NotTo(HaveOccurred())
+			cm.Data["mapRoles"] = ""
+			Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				cm, err := getAWSAuthConfigMap()
+				g.Expect(err).NotTo(HaveOccurred())
+				roles, err := getMapRolesFromConfigMap(cm)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(len(roles)).To(BeNumerically(">=", benchmarkItems))
+			}).Should(Succeed())
+		})
+		waitForIdle()
+		requests := apiRequests.since(before)
+		recordRequests(experiment, requests)
+
+		// Reconciling every item on a ConfigMap event sends at least one
+		// request per item
+		Expect(configMapWrites(requests)).To(Equal(1))
+		Expect(requests).NotTo(HaveKey("PATCH awsauthitems/status"))
+		Expect(totalRequests(requests)).To(BeNumerically("<", benchmarkItems/10))
+	})
+})
@@ -19,27 +19,65 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
-	"sigs.k8s.io/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/accessentry"
+	"github.com/maruina/aws-auth-manager/pkg/render"
 )
 
+// Output backends the AWSAuthItemReconciler can write the aggregated mappings to.
+const (
+	// BackendConfigMap writes the mappings to the aws-auth ConfigMap.
+	BackendConfigMap = "configmap"
+
+	// BackendAccessEntries writes the mappings as EKS access entries.
+	BackendAccessEntries = "access-entries"
+
+	// BackendDualWrite writes the mappings to both the aws-auth ConfigMap and
+	// EKS access entries, to migrate a cluster without a flag day.
+	BackendDualWrite = "dual-write"
+)
+
+// Policies applied to a ConfigMap changed by another client since it was
+// rendered.
+const (
+	// DriftPolicyCorrect reverts the change, reporting it with a DriftCorrected
+	// event.
+	DriftPolicyCorrect = "correct"
+
+	// DriftPolicyReport reports the change without reverting it, so that
+	// nothing is written to the ConfigMap until the drift is resolved.
+	DriftPolicyReport = "report"
+)
+
+// AccessEntryBackend applies the desired EKS access entries of a cluster.
+type AccessEntryBackend interface {
+	Apply(ctx context.Context, entries []accessentry.Entry) error
+}
+
 // AWSAuthItemReconciler reconciles a AWSAuthItem object.
 type AWSAuthItemReconciler struct {
 	client.Client
@@ -47,17 +85,104 @@ type AWSAuthItemReconciler struct {
 	Recorder                  events.EventRecorder
 	AWSAuthConfigMapName      string
 	AWSAuthConfigMapNamespace string
+
+	// Backend selects where the aggregated mappings are written to.
+	// Defaults to BackendConfigMap when empty.
+	Backend string
+
+	// AccessEntries is the EKS access entries backend, required when Backend
+	// is BackendAccessEntries or BackendDualWrite.
+	AccessEntries AccessEntryBackend
+
+	// ConflictPolicy selects how an ARN mapped by more than one AWSAuthItem is
+	// resolved. Defaults to render.ConflictPolicyOldestWins when empty.
+	ConflictPolicy string
+
+	// ConfigMapMode selects whether the aws-auth ConfigMap is fully replaced
+	// or merged with entries created by other tools. Defaults to
+	// render.ConfigMapModeStrict when empty.
+	ConfigMapMode string
+
+	// ForceOwnership takes over the fields of the aws-auth ConfigMap managed
+	// by another field manager when applying it. The conflicts are reported
+	// either way, but the ConfigMap is not written when false.
+	ForceOwnership bool
+
+	// DriftPolicy selects whether a change of a ConfigMap by another client
+	// is reverted or only reported. Defaults to DriftPolicyCorrect when empty.
+	DriftPolicy string
+
+	// AggregateDebounce is the delay between the first event changing the
+	// aggregated mappings and their rendering, so that a burst of events is
+	// rendered once. Defaults to DefaultAggregateDebounce when zero.
+	AggregateDebounce time.Duration
+
+	// DryRun computes the changes of the aws-auth ConfigMap without writing
+	// them, and reports them in the status of the items.
+	DryRun bool
+
+	// SafetyGuards are the checks a rendering of the aws-auth ConfigMap must
+	// pass to be written, unless overridden by the
+	// render.OverrideSafetyChecksAnnotation of the ConfigMap.
+	SafetyGuards render.SafetyGuards
+
+	// RevisionHistoryLimit is the number of revisions of the aws-auth
+	// ConfigMap kept, to roll it back. No revision is recorded when zero.
+	RevisionHistoryLimit int
+
+	// RevisionNamespace is the namespace of the revisions of the aws-auth
+	// ConfigMap. Defaults to AWSAuthConfigMapNamespace when empty.
+	RevisionNamespace string
+
+	// ResyncInterval is the delay after which the aggregated mappings are
+	// rendered again without any event, to revert the changes missed by the
+	// watches and keep the last write metric current. Disabled when zero.
+	ResyncInterval time.Duration
+
+	// mu guards result, the outcome of the last aggregate reconciliation.
+	mu     sync.RWMutex
+	result *aggregateResult
+
+	// apiReader reads the kubeconfig Secrets of the remote clusters, which
+	// are not cached.
+	apiReader client.Reader
+
+	// remotesMu guards remotes, the connections to the remote clusters of the
+	// AWSAuthTargets by name.
+	remotesMu sync.Mutex
+	remotes   map[string]*remoteCluster
+
+	// itemEvents and clusterItemEvents trigger the status pass of the
+	// AWSAuthItems and ClusterAWSAuthItems.
+	itemEvents        chan event.GenericEvent
+	clusterItemEvents chan event.GenericEvent
+
+	// remoteEvents triggers a rendering on the changes of the ConfigMaps of
+	// the remote clusters, whose informers come and go with the connections.
+	remoteEvents chan event.GenericEvent
 }
 
+// Annotations recording the SHA-256 of the mapRoles and mapUsers written to
+// the aws-auth ConfigMap.
 const (
-	MapRolesAnnotation = "aws-auth-manager.maruina.k8s/map-roles-sha256"
-	MapUsersAnnotation = "aws-auth-manager.maruina.k8s/map-users-sha256"
+	MapRolesAnnotation = render.MapRolesAnnotation
+	MapUsersAnnotation = render.MapUsersAnnotation
 )
 
+// FieldManager is the field manager of the server-side apply of the aws-auth
+// ConfigMap.
+const FieldManager = "aws-auth-manager"
+
+// legacyFieldManager is the field manager of the aws-auth ConfigMap patches
+// of the previous versions, named after the controller binary.
+const legacyFieldManager = "manager"
+
 //+kubebuilder:rbac:groups=aws.maruina.k8s,resources=awsauthitems,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=aws.maruina.k8s,resources=awsauthitems/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=aws.maruina.k8s,resources=awsauthitems/finalizers,verbs=update
+//+kubebuilder:rbac:groups=aws.maruina.k8s,resources=awsauthpolicies,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -75,267 +200,536 @@ func (r *AWSAuthItemReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	return r.reconcileItem(ctx, &item)
+}
+
+// clusterItemReconciler reconciles a ClusterAWSAuthItem object, sharing the
+// configuration and the logic of the AWSAuthItemReconciler.
+type clusterItemReconciler struct {
+	*AWSAuthItemReconciler
+}
+
+//+kubebuilder:rbac:groups=aws.maruina.k8s,resources=clusterawsauthitems,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aws.maruina.k8s,resources=clusterawsauthitems/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aws.maruina.k8s,resources=clusterawsauthitems/finalizers,verbs=update
+
+// Reconcile reconciles a ClusterAWSAuthItem like an AWSAuthItem.
+func (r *clusterItemReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("reconciliation started")
+
+	// Get the ClusterAWSAuthItem
+	var item awsauthv1alpha1.ClusterAWSAuthItem
+	if err := r.Get(ctx, req.NamespacedName, &item); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	return r.reconcileItem(ctx, &item)
+}
+
+// reconcileItem updates the status of an AWSAuthItem or a ClusterAWSAuthItem
+// from the last aggregate reconciliation.
+func (r *AWSAuthItemReconciler) reconcileItem(ctx context.Context, item awsauthv1alpha1.Item) (ctrl.Result, error) {
 	// Add finalizer if it doesn't exist
-	if !controllerutil.ContainsFinalizer(&item, awsauthv1alpha1.AWSAuthFinalizer) {
-		controllerutil.AddFinalizer(&item, awsauthv1alpha1.AWSAuthFinalizer)
-		if err := r.Update(ctx, &item); err != nil {
+	if !controllerutil.ContainsFinalizer(item, awsauthv1alpha1.AWSAuthFinalizer) {
+		controllerutil.AddFinalizer(item, awsauthv1alpha1.AWSAuthFinalizer)
+		if err := r.Update(ctx, item); err != nil {
 			return ctrl.Result{}, fmt.Errorf("adding finalizer: %w", err)
 		}
 	}
 
-	// If the object is being deleted, cleanup and remove the finalizer
-	if !item.DeletionTimestamp.IsZero() {
+	// If the object is being deleted, remove the finalizer once its mappings
+	// are no longer rendered
+	if !item.GetDeletionTimestamp().IsZero() {
 		return r.reconcileDelete(ctx, item)
 	}
 
-	// Reconcile
-	return r.reconcile(ctx, item)
+	// Update the status
+	return r.reconcileStatus(ctx, item)
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controllers of AWSAuthItem and
+// ClusterAWSAuthItem with the Manager. The events changing the aggregated
+// mappings are enqueued as a single request of the aggregate controller,
+// which renders the mappings once and then triggers the status pass of every
+// item through a channel. The connections to the remote clusters are closed
+// when the Manager stops.
 func (r *AWSAuthItemReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	r.itemEvents = make(chan event.GenericEvent)
+	r.clusterItemEvents = make(chan event.GenericEvent)
+	r.remoteEvents = make(chan event.GenericEvent)
+	r.apiReader = mgr.GetAPIReader()
+
+	if err := metrics.Registry.Register(&itemCollector{reader: mgr.GetClient()}); err != nil {
+		return fmt.Errorf("registering the items metric: %w", err)
+	}
+
+	err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		r.stopRemotes()
+		return nil
+	}))
+	if err != nil {
+		return err
+	}
+
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &awsauthv1alpha1.AWSAuthTarget{}, targetConfigMapField, indexTargetConfigMap)
+	if err != nil {
+		return fmt.Errorf("indexing AWSAuthTargets: %w", err)
+	}
+
+	err = ctrl.NewControllerManagedBy(mgr).
 		For(&awsauthv1alpha1.AWSAuthItem{}).
+		WatchesRawSource(source.Channel(r.itemEvents, &handler.EnqueueRequestForObject{})).
+		Complete(r)
+	if err != nil {
+		return err
+	}
+
+	err = ctrl.NewControllerManagedBy(mgr).
+		For(&awsauthv1alpha1.ClusterAWSAuthItem{}).
+		WatchesRawSource(source.Channel(r.clusterItemEvents, &handler.EnqueueRequestForObject{})).
+		Complete(&clusterItemReconciler{r})
+	if err != nil {
+		return err
+	}
+
+	// Status updates don't change the generation of the items, so they don't
+	// trigger a new rendering. The labels of the items select their targets
+	err = ctrl.NewControllerManagedBy(mgr).
+		Named("aws-auth").
+		Watches(
+			&awsauthv1alpha1.AWSAuthItem{},
+			r.enqueueAggregate(),
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{})),
+		).
+		Watches(
+			&awsauthv1alpha1.ClusterAWSAuthItem{},
+			r.enqueueAggregate(),
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{})),
+		).
 		Watches(
 			&corev1.ConfigMap{},
-			handler.EnqueueRequestsFromMapFunc(r.findObjectsForConfigMap),
-			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+			r.enqueueAggregate(),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}, predicate.NewPredicateFuncs(r.isTargetConfigMap)),
 		).
-		Complete(r)
+		Watches(
+			&awsauthv1alpha1.AWSAuthTarget{},
+			r.enqueueAggregate(),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&awsauthv1alpha1.AWSAuthPolicy{},
+			r.enqueueAggregate(),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&corev1.Namespace{},
+			r.enqueueAggregate(),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		).
+		WatchesRawSource(source.Channel(r.remoteEvents, r.enqueueAggregate())).
+		Complete(&aggregateReconciler{r})
+
+	return err
 }
 
-func (r *AWSAuthItemReconciler) findObjectsForConfigMap(ctx context.Context, obj client.Object) []reconcile.Request {
+// listItems returns all the AWSAuthItems and ClusterAWSAuthItems. The
+// AWSAuthItems exclude the mappings that are not allowed by the AWSAuthPolicies
+// selecting their namespace, and the violations are returned by item.
+func (r *AWSAuthItemReconciler) listItems(ctx context.Context) ([]awsauthv1alpha1.Item, map[client.ObjectKey]field.ErrorList, error) {
+	var clusterItemList awsauthv1alpha1.ClusterAWSAuthItemList
+	if err := r.List(ctx, &clusterItemList); err != nil {
+		return nil, nil, fmt.Errorf("listing ClusterAWSAuthItems: %w", err)
+	}
+
 	var itemList awsauthv1alpha1.AWSAuthItemList
-	err := r.List(ctx, &itemList)
-	if err != nil {
-		return []reconcile.Request{}
+	if err := r.List(ctx, &itemList); err != nil {
+		return nil, nil, fmt.Errorf("listing AWSAuthItems: %w", err)
 	}
 
-	// We are only interested in the aws-auth/kube-system configmap
-	if obj.GetName() != r.AWSAuthConfigMapName || obj.GetNamespace() != r.AWSAuthConfigMapNamespace {
-		return []reconcile.Request{}
+	var policyList awsauthv1alpha1.AWSAuthPolicyList
+	if err := r.List(ctx, &policyList); err != nil {
+		return nil, nil, fmt.Errorf("listing AWSAuthPolicies: %w", err)
 	}
 
-	// Trigger a reconciliation loop for all the AWSAuthItem objects
-	requests := make([]reconcile.Request, len(itemList.Items))
-	for i, item := range itemList.Items {
-		requests[i] = reconcile.Request{
-			NamespacedName: types.NamespacedName{
-				Name:      item.GetName(),
-				Namespace: item.GetNamespace(),
-			},
+	items := make([]awsauthv1alpha1.Item, 0, len(clusterItemList.Items)+len(itemList.Items))
+	for i := range clusterItemList.Items {
+		items = append(items, &clusterItemList.Items[i])
+	}
+
+	violations := map[client.ObjectKey]field.ErrorList{}
+	policies := map[string][]awsauthv1alpha1.AWSAuthPolicy{}
+	for i := range itemList.Items {
+		item := &itemList.Items[i]
+		if len(policyList.Items) == 0 || !item.DeletionTimestamp.IsZero() {
+			items = append(items, item)
+			continue
 		}
+
+		nsPolicies, ok := policies[item.Namespace]
+		if !ok {
+			var ns corev1.Namespace
+			if err := r.Get(ctx, client.ObjectKey{Name: item.Namespace}, &ns); client.IgnoreNotFound(err) != nil {
+				return nil, nil, fmt.Errorf("fetching namespace %s: %w", item.Namespace, err)
+			}
+			var err error
+			if nsPolicies, err = awsauthv1alpha1.SelectPolicies(policyList.Items, ns.Labels); err != nil {
+				return nil, nil, err
+			}
+			policies[item.Namespace] = nsPolicies
+		}
+
+		allowed, errs := awsauthv1alpha1.EnforcePolicies(nsPolicies, &item.Spec)
+		if len(errs) > 0 {
+			violations[client.ObjectKeyFromObject(item)] = errs
+			item.Spec = allowed
+		}
+		items = append(items, item)
 	}
 
-	return requests
+	return items, violations, nil
 }
 
-func (r *AWSAuthItemReconciler) reconcile(ctx context.Context, item awsauthv1alpha1.AWSAuthItem) (ctrl.Result, error) {
+// reconcileStatus updates the status of item from the last aggregate
+// reconciliation. The status is left untouched until the current generation of
+// item is rendered, as the aggregate reconciliation is already enqueued.
+func (r *AWSAuthItemReconciler) reconcileStatus(ctx context.Context, item awsauthv1alpha1.Item) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
+	before := item.GetStatus().DeepCopy()
+
+	result := r.lastResult()
+	key := client.ObjectKeyFromObject(item)
+	var generation int64
+	var rendered bool
+	var view *targetResult
+	if result != nil {
+		generation, rendered = result.generations[key]
+		view = result.of(key)
+	}
 
-	// Handle suspension
-	if item.Spec.Suspend {
-		log.Info("reconciliation is suspended for this resource")
-		r.Recorder.Eventf(&item, nil, corev1.EventTypeNormal, awsauthv1alpha1.SuspendedReason,
-			"Suspended", "Reconciliation is suspended")
+	switch {
+	case item.GetSpec().Suspend:
+		// Handle suspension
+		ready := apimeta.FindStatusCondition(before.Conditions, awsauthv1alpha1.ReadyCondition)
+		if ready == nil || ready.Reason != awsauthv1alpha1.SuspendedReason {
+			log.Info("reconciliation is suspended for this resource")
+			r.Recorder.Eventf(item, nil, corev1.EventTypeNormal, awsauthv1alpha1.SuspendedReason,
+				"Suspended", "Reconciliation is suspended")
+		}
 		item.AWSAuthItemSuspended()
-		if err := r.patchStatus(ctx, item); err != nil {
-			return ctrl.Result{}, fmt.Errorf("patching status for suspended: %w", err)
+
+	case view != nil && view.failure != nil:
+		failure := view.failure
+		ready := apimeta.FindStatusCondition(before.Conditions, awsauthv1alpha1.ReadyCondition)
+		if ready == nil || ready.Reason != failure.reason || ready.Message != failure.err.Error() {
+			r.Recorder.Eventf(item, nil, corev1.EventTypeWarning, failure.reason,
+				failure.action, "%s: %s", failure.note, failure.err.Error())
+		}
+		item.AWSAuthItemNotReady(failure.reason, failure.err.Error())
+		setConflictingManagerCondition(item, view)
+		setSafetyCheckCondition(item, view)
+		r.setAppliedTargets(item, result)
+
+	case view != nil && view.pinned != "":
+		message := fmt.Sprintf("aws-auth ConfigMap is pinned to revision %s until the %s annotation is removed",
+			view.pinned, render.PinnedRevisionAnnotation)
+		ready := apimeta.FindStatusCondition(before.Conditions, awsauthv1alpha1.ReadyCondition)
+		if ready == nil || ready.Reason != awsauthv1alpha1.PinnedRevisionReason || ready.Message != message {
+			r.Recorder.Eventf(item, nil, corev1.EventTypeWarning, awsauthv1alpha1.PinnedRevisionReason,
+				"Pinned", "%s", message)
 		}
+		item.AWSAuthItemNotReady(awsauthv1alpha1.PinnedRevisionReason, message)
+		setConflictingManagerCondition(item, view)
+		setSafetyCheckCondition(item, view)
+		r.setAppliedTargets(item, result)
 
+	case !rendered || generation != item.GetGeneration():
+		log.V(1).Info("waiting for the aggregate reconciliation")
 		return ctrl.Result{}, nil
-	}
 
-	// Get the aws-auth configMap
-	var authCm corev1.ConfigMap
-	err := r.Get(ctx, types.NamespacedName{Name: r.AWSAuthConfigMapName, Namespace: r.AWSAuthConfigMapNamespace}, &authCm)
-
-	// Create the aws-auth configmap if it doesn't exist
-	if errors.IsNotFound(err) {
-		authCm = corev1.ConfigMap{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      r.AWSAuthConfigMapName,
-				Namespace: r.AWSAuthConfigMapNamespace,
-				Annotations: map[string]string{
-					awsauthv1alpha1.AWSAuthAnnotationKey: awsauthv1alpha1.AWSAuthAnnotationValue,
-				},
-			},
-			Data: map[string]string{
-				"mapUsers": "",
-				"mapRoles": "",
-			},
+	default:
+		if r.Backend == BackendAccessEntries || r.Backend == BackendDualWrite {
+			setAccessEntriesCompatibleCondition(item)
 		}
-
-		err = r.Create(ctx, &authCm)
-		if err != nil {
-			r.Recorder.Eventf(&item, nil, corev1.EventTypeWarning, awsauthv1alpha1.CreateAwsAuthConfigMapFailedReason,
-				"CreateFailed", "Failed to create aws-auth ConfigMap: %s", err.Error())
-			item.AWSAuthItemNotReady(awsauthv1alpha1.CreateAwsAuthConfigMapFailedReason, err.Error())
-			if statusErr := r.patchStatus(ctx, item); statusErr != nil {
-				log.Error(statusErr, "failed to patch status after ConfigMap creation failure")
-			}
-
-			return ctrl.Result{}, fmt.Errorf("creating aws-auth ConfigMap: %w", err)
+		if before.ObservedGeneration != generation {
+			r.Recorder.Eventf(item, nil, corev1.EventTypeNormal, awsauthv1alpha1.ReconciliationSucceededReason,
+				"Reconciled", "%s", view.message)
 		}
+		item.GetStatus().ObservedGeneration = generation
+		r.setPolicyViolationCondition(item, result.violations[key])
+		setConflictingManagerCondition(item, view)
+		setSafetyCheckCondition(item, view)
+		r.setReadyCondition(item, view.agg)
+		r.setPendingChanges(item, before.PendingChanges, view.pending)
+		r.setAppliedTargets(item, result)
+	}
 
-		return ctrl.Result{Requeue: true}, nil
+	if equality.Semantic.DeepEqual(before, item.GetStatus()) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.patchStatus(ctx, item); err != nil {
+		return ctrl.Result{}, fmt.Errorf("patching status: %w", err)
 	}
 
-	// Return if there is an error fetching the aws auth configmap
-	if err != nil {
-		r.Recorder.Eventf(&item, nil, corev1.EventTypeWarning, awsauthv1alpha1.GetAwsAuthConfigMapFailedReason,
-			"GetFailed", "Failed to fetch aws-auth ConfigMap: %s", err.Error())
-		item.AWSAuthItemNotReady(awsauthv1alpha1.GetAwsAuthConfigMapFailedReason, err.Error())
-		if statusErr := r.patchStatus(ctx, item); statusErr != nil {
-			log.Error(statusErr, "failed to patch status after ConfigMap fetch failure")
-		}
+	return ctrl.Result{}, nil
+}
 
-		return ctrl.Result{}, fmt.Errorf("fetching aws-auth ConfigMap: %w", err)
-	}
+// reconcileDelete removes the finalizer of item once the last aggregate
+// reconciliation succeeded without its mappings. In dry run, nothing is
+// written, so the finalizer is removed right away.
+func (r *AWSAuthItemReconciler) reconcileDelete(ctx context.Context, item awsauthv1alpha1.Item) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
 
-	// Get all the AWSAuthItem
-	var itemList awsauthv1alpha1.AWSAuthItemList
-	err = r.List(ctx, &itemList)
-	if err != nil {
-		item.AWSAuthItemNotReady(awsauthv1alpha1.ListAWSAuthItemFailedReason, err.Error())
-		if statusErr := r.patchStatus(ctx, item); statusErr != nil {
-			log.Error(statusErr, "failed to patch status after listing AWSAuthItems failure")
+	if r.DryRun {
+		log.Info("removing finalizer without changing aws-auth in dry run")
+	} else {
+		// The mappings of item may still be written while the ConfigMap of
+		// one of its targets is pinned to a previous revision or in dry run
+		result := r.lastResult()
+		key := client.ObjectKeyFromObject(item)
+		if result == nil {
+			log.V(1).Info("waiting for the aggregate reconciliation to remove the item data")
+			return ctrl.Result{}, nil
+		}
+		if view := result.of(key); view.failure != nil || view.pinned != "" {
+			log.V(1).Info("waiting for the aggregate reconciliation to remove the item data")
+			return ctrl.Result{}, nil
+		}
+		if _, rendered := result.generations[key]; rendered {
+			log.V(1).Info("waiting for the aggregate reconciliation to remove the item data")
+			return ctrl.Result{}, nil
 		}
 
-		return ctrl.Result{Requeue: true}, fmt.Errorf("listing AWSAuthItems: %w", err)
+		log.Info("removed item data from aws-auth")
 	}
 
-	// Get all the mapRoles and mapUsers, excluding items being deleted
-	var mapRoles []awsauthv1alpha1.MapRoleItem
-	var mapUsers []awsauthv1alpha1.MapUserItem
-	for _, i := range itemList.Items {
-		// Skip items that are being deleted
-		if !i.DeletionTimestamp.IsZero() {
-			continue
-		}
-		mapRoles = append(mapRoles, i.Spec.MapRoles...)
-		mapUsers = append(mapUsers, i.Spec.MapUsers...)
+	controllerutil.RemoveFinalizer(item, awsauthv1alpha1.AWSAuthFinalizer)
+	if err := r.Update(ctx, item); err != nil {
+		return ctrl.Result{}, fmt.Errorf("removing finalizer: %w", err)
 	}
 
-	// Marshal the objects
-	mapRolesYaml, err := yaml.Marshal(mapRoles)
-	if err != nil {
-		item.AWSAuthItemNotReady(awsauthv1alpha1.MarshalMapRolesFailedReason, err.Error())
-		if statusErr := r.patchStatus(ctx, item); statusErr != nil {
-			log.Error(statusErr, "failed to patch status after mapRoles marshal failure")
-		}
+	return ctrl.Result{}, nil
+}
+
+// applyAccessEntries translates the aggregated mappings into access entries and
+// applies them. Mappings that cannot be expressed as access entries are skipped.
+func (r *AWSAuthItemReconciler) applyAccessEntries(ctx context.Context, agg render.Aggregation) error {
+	log := log.FromContext(ctx)
 
-		return ctrl.Result{Requeue: true}, fmt.Errorf("marshaling mapRoles: %w", err)
+	entries, unsupported := accessentry.Translate(agg.MapRoles, agg.MapUsers, agg.MapAccounts)
+	for _, u := range unsupported {
+		log.Info("skipping mapping not supported by EKS access entries", "principal", u.PrincipalARN, "reason", u.Reason)
 	}
 
-	mapUsersYaml, err := yaml.Marshal(mapUsers)
-	if err != nil {
-		item.AWSAuthItemNotReady(awsauthv1alpha1.MarshalMapUsersFailedReason, err.Error())
-		if statusErr := r.patchStatus(ctx, item); statusErr != nil {
-			log.Error(statusErr, "failed to patch status after mapUsers marshal failure")
-		}
+	return r.AccessEntries.Apply(ctx, entries)
+}
 
-		return ctrl.Result{Requeue: true}, fmt.Errorf("marshaling mapUsers: %w", err)
+// setReadyCondition marks item as ready unless the conflict policy rejected it,
+// and records the conflicts it lost, if any, in the Conflicted condition.
+func (r *AWSAuthItemReconciler) setReadyCondition(item awsauthv1alpha1.Item, agg render.Aggregation) {
+	conflicts := agg.ConflictsOf(client.ObjectKeyFromObject(item))
+	if len(conflicts) == 0 {
+		item.AWSAuthItemNotConflicted()
+		item.AWSAuthItemReady()
+		return
 	}
 
-	// Update the configmap using Patch to avoid conflicts
-	patch := client.MergeFrom(authCm.DeepCopy())
-	authCm.Data["mapRoles"] = string(mapRolesYaml)
-	authCm.Data["mapUsers"] = string(mapUsersYaml)
+	message := render.ConflictMessage(conflicts, r.conflictPolicy())
+	conditions := *item.GetStatusConditions()
+	if !apimeta.IsStatusConditionTrue(conditions, awsauthv1alpha1.ConflictedCondition) ||
+		apimeta.FindStatusCondition(conditions, awsauthv1alpha1.ConflictedCondition).Message != message {
+		r.Recorder.Eventf(item, nil, corev1.EventTypeWarning, awsauthv1alpha1.DuplicateARNReason,
+			"ResolveConflict", "%s", message)
+	}
+	item.AWSAuthItemConflicted(message)
 
-	if err := r.Patch(ctx, &authCm, patch); err != nil {
-		r.Recorder.Eventf(&item, nil, corev1.EventTypeWarning, awsauthv1alpha1.UpdateAwsAuthConfigMapFailedReason,
-			"UpdateFailed", "Failed to update aws-auth ConfigMap: %s", err.Error())
-		item.AWSAuthItemNotReady(awsauthv1alpha1.UpdateAwsAuthConfigMapFailedReason, err.Error())
-		if statusErr := r.patchStatus(ctx, item); statusErr != nil {
-			log.Error(statusErr, "failed to patch status after ConfigMap update failure")
-		}
+	if agg.Rejected[client.ObjectKeyFromObject(item)] {
+		item.AWSAuthItemNotReady(awsauthv1alpha1.DuplicateARNReason, message)
+		return
+	}
+	item.AWSAuthItemReady()
+}
 
-		return ctrl.Result{Requeue: true}, fmt.Errorf("patching aws-auth ConfigMap: %w", err)
+// setPolicyViolationCondition records on item the mappings excluded from
+// aws-auth because the AWSAuthPolicies selecting its namespace forbid them.
+// ClusterAWSAuthItems are never restricted by policies.
+func (r *AWSAuthItemReconciler) setPolicyViolationCondition(item awsauthv1alpha1.Item, violations field.ErrorList) {
+	nsItem, ok := item.(*awsauthv1alpha1.AWSAuthItem)
+	if !ok {
+		return
+	}
+	if len(violations) == 0 {
+		nsItem.AWSAuthItemPolicyCompliant()
+		return
 	}
 
-	// Update status only after successful reconciliation
-	r.Recorder.Eventf(&item, nil, corev1.EventTypeNormal, awsauthv1alpha1.ReconciliationSucceededReason,
-		"Reconciled", "aws-auth ConfigMap updated successfully")
-	item.Status.ObservedGeneration = item.Generation
-	item.AWSAuthItemReady()
-	if err := r.patchStatus(ctx, item); err != nil {
-		return ctrl.Result{Requeue: true}, fmt.Errorf("patching status: %w", err)
+	message := "Mappings excluded from aws-auth: " + violations.ToAggregate().Error()
+	if !apimeta.IsStatusConditionTrue(nsItem.Status.Conditions, awsauthv1alpha1.PolicyViolationCondition) ||
+		apimeta.FindStatusCondition(nsItem.Status.Conditions, awsauthv1alpha1.PolicyViolationCondition).Message != message {
+		r.Recorder.Eventf(item, nil, corev1.EventTypeWarning, awsauthv1alpha1.ForbiddenMappingsReason,
+			"EnforcePolicy", "%s", message)
 	}
+	nsItem.AWSAuthItemPolicyViolated(message)
+}
 
-	return ctrl.Result{}, nil
+// conflictPolicy returns the configured conflict policy, defaulting to
+// render.ConflictPolicyOldestWins.
+func (r *AWSAuthItemReconciler) conflictPolicy() string {
+	if r.ConflictPolicy == "" {
+		return render.ConflictPolicyOldestWins
+	}
+
+	return r.ConflictPolicy
 }
 
-func (r *AWSAuthItemReconciler) reconcileDelete(ctx context.Context, item awsauthv1alpha1.AWSAuthItem) (ctrl.Result, error) {
-	log := log.FromContext(ctx)
+// setAccessEntriesCompatibleCondition records on item whether all of its own
+// mappings can be expressed as EKS access entries.
+func setAccessEntriesCompatibleCondition(item awsauthv1alpha1.Item) {
+	spec := item.GetSpec()
+	_, unsupported := accessentry.Translate(spec.MapRoles, spec.MapUsers, spec.MapAccounts)
+	if len(unsupported) == 0 {
+		item.AWSAuthItemAccessEntriesCompatible()
+		return
+	}
 
-	// Get the aws-auth ConfigMap
-	var authCm corev1.ConfigMap
-	if err := r.Get(ctx, types.NamespacedName{Name: r.AWSAuthConfigMapName, Namespace: r.AWSAuthConfigMapNamespace}, &authCm); err != nil {
-		return ctrl.Result{}, fmt.Errorf("fetching aws-auth ConfigMap during deletion: %w", err)
+	reasons := make([]string, len(unsupported))
+	for i, u := range unsupported {
+		reasons[i] = fmt.Sprintf("%s: %s", u.PrincipalARN, u.Reason)
 	}
+	item.AWSAuthItemAccessEntriesIncompatible(fmt.Sprintf("%d mapping(s) cannot be expressed as EKS access entries: %s",
+		len(unsupported), strings.Join(reasons, "; ")))
+}
 
-	// Get all remaining AWSAuthItems (excluding this one and any being deleted)
-	var itemList awsauthv1alpha1.AWSAuthItemList
-	if err := r.List(ctx, &itemList); err != nil {
-		return ctrl.Result{}, fmt.Errorf("listing AWSAuthItems during deletion: %w", err)
+// setConflictingManagerCondition records on item the field managers
+// conflicting with the last apply of the ConfigMaps of its targets, if any.
+func setConflictingManagerCondition(item awsauthv1alpha1.Item, result *targetResult) {
+	if len(result.conflicts) == 0 {
+		item.AWSAuthItemNoConflictingManager()
+		return
 	}
 
-	// Aggregate data from all remaining items, excluding items being deleted
-	var mapRoles []awsauthv1alpha1.MapRoleItem
-	var mapUsers []awsauthv1alpha1.MapUserItem
-	for _, i := range itemList.Items {
-		// Skip this item and any others being deleted
-		if !i.DeletionTimestamp.IsZero() {
-			continue
-		}
-		mapRoles = append(mapRoles, i.Spec.MapRoles...)
-		mapUsers = append(mapUsers, i.Spec.MapUsers...)
+	message := "aws-auth ConfigMap fields are also managed by " + strings.Join(result.conflicts, ", ")
+	if result.forced {
+		message += "; their ownership was forced"
+	} else {
+		message += "; the aws-auth ConfigMap was not applied"
 	}
+	item.AWSAuthItemConflictingManager(message)
+}
 
-	// Marshal the objects
-	mapRolesYaml, err := yaml.Marshal(mapRoles)
-	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("marshaling mapRoles during deletion: %w", err)
+// setPendingChanges records on item the changes of its aws-auth ConfigMap
+// entries not written because of a dry run, and marks it as not ready when
+// there are any. An event lists the changes when they differ from before.
+func (r *AWSAuthItemReconciler) setPendingChanges(item awsauthv1alpha1.Item, before []awsauthv1alpha1.PendingChange, changes []render.Change) {
+	status := item.GetStatus()
+	status.PendingChanges = nil
+	for _, change := range changes {
+		status.PendingChanges = append(status.PendingChanges, awsauthv1alpha1.PendingChange{
+			Type:    change.Type,
+			Key:     change.Key,
+			ID:      change.ID,
+			Live:    pendingMapping(change.Live),
+			Desired: pendingMapping(change.Desired),
+		})
+	}
+	if len(changes) == 0 {
+		return
 	}
 
-	mapUsersYaml, err := yaml.Marshal(mapUsers)
-	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("marshaling mapUsers during deletion: %w", err)
+	cause := "spec.dryRun"
+	if r.DryRun {
+		cause = "the controller dry-run mode"
+	}
+	if !equality.Semantic.DeepEqual(before, status.PendingChanges) {
+		r.Recorder.Eventf(item, nil, corev1.EventTypeNormal, awsauthv1alpha1.DryRunReason,
+			"Plan", "Dry run, %d change(s) not applied: %s", len(changes), describeChanges(changes))
 	}
+	item.AWSAuthItemDryRun(fmt.Sprintf("%d change(s) of the aws-auth ConfigMap not applied because of %s, see status.pendingChanges",
+		len(changes), cause))
+}
 
-	// Update the ConfigMap with the aggregated data (excluding deleted item)
-	patch := client.MergeFrom(authCm.DeepCopy())
-	authCm.Data["mapRoles"] = string(mapRolesYaml)
-	authCm.Data["mapUsers"] = string(mapUsersYaml)
+// pendingMapping returns the PendingMapping of mapping, or nil.
+func pendingMapping(mapping *render.Mapping) *awsauthv1alpha1.PendingMapping {
+	if mapping == nil {
+		return nil
+	}
 
-	if err := r.Patch(ctx, &authCm, patch); err != nil {
-		return ctrl.Result{}, fmt.Errorf("patching aws-auth ConfigMap during deletion: %w", err)
+	return &awsauthv1alpha1.PendingMapping{Username: mapping.Username, Groups: mapping.Groups}
+}
+
+// setAppliedTargets records on item the ConfigMaps its mappings were written
+// to by the last aggregate reconciliation. The mappings of an item are not
+// written to a target that failed, is pinned to a revision or rejected them,
+// nor in dry run.
+func (r *AWSAuthItemReconciler) setAppliedTargets(item awsauthv1alpha1.Item, result *aggregateResult) {
+	if result.failure != nil {
+		return
 	}
 
-	log.Info("removed item data from aws-auth ConfigMap")
+	key := client.ObjectKeyFromObject(item)
+	var applied []awsauthv1alpha1.AppliedTarget
+	for _, t := range result.targets {
+		if !t.routed[key] || t.failure != nil || t.pinned != "" || t.agg.Rejected[key] || r.DryRun {
+			continue
+		}
+		// The aws-auth ConfigMap is not written with the access entries backend
+		if t.target.name == "" && r.Backend == BackendAccessEntries {
+			continue
+		}
+		applied = append(applied, awsauthv1alpha1.AppliedTarget{
+			Name:      t.target.name,
+			ConfigMap: t.target.configMap.String(),
+			Cluster:   t.target.cluster(),
+		})
+	}
+	item.GetStatus().AppliedTargets = applied
+}
 
-	controllerutil.RemoveFinalizer(&item, awsauthv1alpha1.AWSAuthFinalizer)
-	if err := r.Update(ctx, &item); err != nil {
-		return ctrl.Result{}, fmt.Errorf("removing finalizer: %w", err)
+// setSafetyCheckCondition records on item the safety guards tripped by the
+// last rendering of the ConfigMaps of its targets, if any.
+func setSafetyCheckCondition(item awsauthv1alpha1.Item, result *targetResult) {
+	if result.safetyCheck == "" {
+		item.AWSAuthItemSafetyCheckPassed()
+		return
 	}
+	item.AWSAuthItemSafetyCheckFailed(result.safetyCheck)
+}
 
-	return ctrl.Result{}, nil
+// renderFailedReason returns the condition reason of an error returned by
+// render.ConfigMap.
+func renderFailedReason(err error) string {
+	var marshalErr *render.MarshalError
+	if !errors.As(err, &marshalErr) {
+		return awsauthv1alpha1.ParseAwsAuthConfigMapFailedReason
+	}
+
+	switch marshalErr.Key {
+	case "mapUsers":
+		return awsauthv1alpha1.MarshalMapUsersFailedReason
+	case "mapAccounts":
+		return awsauthv1alpha1.MarshalMapAccountsFailedReason
+	default:
+		return awsauthv1alpha1.MarshalMapRolesFailedReason
+	}
 }
 
-// patchStatus updates the AWSAuthItem status using a MergeFrom strategy.
-func (r *AWSAuthItemReconciler) patchStatus(ctx context.Context, item awsauthv1alpha1.AWSAuthItem) error {
-	var latest awsauthv1alpha1.AWSAuthItem
+// patchStatus updates the status of an AWSAuthItem or ClusterAWSAuthItem using
+// a MergeFrom strategy.
+func (r *AWSAuthItemReconciler) patchStatus(ctx context.Context, item awsauthv1alpha1.Item) error {
+	latest, ok := item.DeepCopyObject().(awsauthv1alpha1.Item)
+	if !ok {
+		return fmt.Errorf("copying %T for status patch", item)
+	}
 
-	if err := r.Get(ctx, client.ObjectKeyFromObject(&item), &latest); err != nil {
-		return fmt.Errorf("fetching latest AWSAuthItem for status patch: %w", err)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(item), latest); err != nil {
+		return fmt.Errorf("fetching latest item for status patch: %w", err)
 	}
 
-	patch := client.MergeFrom(latest.DeepCopy())
-	latest.Status = item.Status
+	patch := client.MergeFrom(latest.DeepCopyObject().(client.Object))
+	*latest.GetStatus() = *item.GetStatus()
 
-	if err := r.Client.Status().Patch(ctx, &latest, patch); err != nil {
-		return fmt.Errorf("patching AWSAuthItem status: %w", err)
+	if err := r.Client.Status().Patch(ctx, latest, patch); err != nil {
+		return fmt.Errorf("patching item status: %w", err)
 	}
 
 	return nil
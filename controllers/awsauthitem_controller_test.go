@@ -1,18 +1,25 @@
 package controllers
 
 import (
+	"regexp"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/render"
 )
 
 // cleanupAWSAuthItem deletes the item and waits for deletion to complete.
@@ -307,6 +314,20 @@ var _ = Describe("AWSAuthItem controller", func() {
 						Username: "both-role-user",
 						Groups:   []string{"edit"},
 					}))
+					g.Expect(cm.Annotations).To(HaveKey(MapRolesAnnotation))
+					g.Expect(cm.Annotations).To(HaveKey(MapUsersAnnotation))
+				},
+			),
+			Entry("mapAccounts only",
+				func() awsauthv1alpha1.AWSAuthItemSpec {
+					return awsauthv1alpha1.AWSAuthItemSpec{
+						MapAccounts: []string{"444455556666"},
+					}
+				},
+				func(g Gomega, cm *corev1.ConfigMap) {
+					accounts, err := getMapAccountsFromConfigMap(cm)
+					g.Expect(err).NotTo(HaveOccurred())
+					g.Expect(accounts).To(ContainElement("444455556666"))
 				},
 			),
 		)
@@ -603,8 +624,8 @@ var _ = Describe("AWSAuthItem controller", func() {
 
 	Context("when deleting an AWSAuthItem", func() {
 		It("should remove entries from ConfigMap and remove finalizer", func() {
-			// Create a remaining item to ensure cleanup reconciliation triggers
-			// (the controller relies on other items' reconciliation to clean up ConfigMap)
+			// Create a remaining item to ensure the deletion keeps the mappings
+			// of the other items
 			remainingItem := &awsauthv1alpha1.AWSAuthItem{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      uniqueName("remaining-item"),
@@ -799,9 +820,445 @@ var _ = Describe("AWSAuthItem controller", func() {
 		})
 	})
 
-	// This test implicitly verifies the findObjectsForConfigMap watch handler
-	// by confirming that external ConfigMap modifications trigger reconciliation
-	// of all AWSAuthItems that reference it.
+	Context("when two AWSAuthItems map the same ARN", func() {
+		It("should keep the oldest mapping and mark the newer item as Conflicted", func() {
+			drainEvents()
+
+			oldest := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("conflict-oldest"),
+					Namespace: reconciler.AWSAuthConfigMapNamespace,
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapRoles: []awsauthv1alpha1.MapRoleItem{
+						{
+							RoleArn:  "arn:aws:iam::111122223333:role/conflict-role",
+							Username: "oldest-user",
+							Groups:   []string{"view"},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, oldest)).To(Succeed())
+			DeferCleanup(cleanupAWSAuthItem, oldest)
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(oldest), &fetched)).To(Succeed())
+				g.Expect(apimeta.IsStatusConditionTrue(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)).To(BeTrue())
+			}).Should(Succeed())
+
+			// Creation timestamps have a one second resolution
+			time.Sleep(time.Second)
+
+			newest := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("conflict-newest"),
+					Namespace: reconciler.AWSAuthConfigMapNamespace,
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapRoles: []awsauthv1alpha1.MapRoleItem{
+						{
+							RoleArn:  "arn:aws:iam::111122223333:role/conflict-role",
+							Username: "newest-user",
+							Groups:   []string{"system:masters"},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, newest)).To(Succeed())
+			DeferCleanup(cleanupAWSAuthItem, newest)
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(newest), &fetched)).To(Succeed())
+				cond := apimeta.FindStatusCondition(fetched.Status.Conditions, awsauthv1alpha1.ConflictedCondition)
+				g.Expect(cond).NotTo(BeNil())
+				g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+				g.Expect(cond.Reason).To(Equal(awsauthv1alpha1.DuplicateARNReason))
+				g.Expect(cond.Message).To(ContainSubstring(client.ObjectKeyFromObject(oldest).String()))
+			}).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				cm, err := getAWSAuthConfigMap()
+				g.Expect(err).NotTo(HaveOccurred())
+				roles, err := getMapRolesFromConfigMap(cm)
+				g.Expect(err).NotTo(HaveOccurred())
+				var matching []awsauthv1alpha1.MapRoleItem
+				for _, role := range roles {
+					if role.RoleArn == "arn:aws:iam::111122223333:role/conflict-role" {
+						matching = append(matching, role)
+					}
+				}
+				g.Expect(matching).To(ConsistOf(oldest.Spec.MapRoles[0]))
+			}).Should(Succeed())
+
+			// The oldest item is not conflicted
+			var fetched awsauthv1alpha1.AWSAuthItem
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(oldest), &fetched)).To(Succeed())
+			Expect(apimeta.FindStatusCondition(fetched.Status.Conditions, awsauthv1alpha1.ConflictedCondition)).To(BeNil())
+
+			// Verify event was emitted
+			Eventually(func() bool {
+				select {
+				case event := <-fakeRecorder.Events:
+					return strings.Contains(event, awsauthv1alpha1.DuplicateARNReason)
+				default:
+					return false
+				}
+			}).Should(BeTrue())
+		})
+	})
+
+	Context("when an AWSAuthPolicy restricts the namespace", func() {
+		It("should exclude the forbidden mappings and set PolicyViolation", func() {
+			drainEvents()
+
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   uniqueName("restricted"),
+				Labels: map[string]string{"aws-auth-manager-test": "restricted"},
+			}}
+			Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+			policy := &awsauthv1alpha1.AWSAuthPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: uniqueName("restricted")},
+				Spec: awsauthv1alpha1.AWSAuthPolicySpec{
+					NamespaceSelector: metav1.LabelSelector{
+						MatchLabels: map[string]string{"aws-auth-manager-test": "restricted"},
+					},
+					ForbiddenGroups: []string{"system:masters"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, policy)
+
+			allowed := awsauthv1alpha1.MapRoleItem{
+				RoleArn:  "arn:aws:iam::111122223333:role/restricted-viewer",
+				Username: "viewer",
+				Groups:   []string{"view"},
+			}
+			forbidden := awsauthv1alpha1.MapRoleItem{
+				RoleArn:  "arn:aws:iam::111122223333:role/restricted-admin",
+				Username: "admin",
+				Groups:   []string{"system:masters"},
+			}
+			item := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("restricted"),
+					Namespace: ns.Name,
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapRoles: []awsauthv1alpha1.MapRoleItem{allowed, forbidden},
+				},
+			}
+			Expect(k8sClient.Create(ctx, item)).To(Succeed())
+			DeferCleanup(cleanupAWSAuthItem, item)
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+				cond := apimeta.FindStatusCondition(fetched.Status.Conditions, awsauthv1alpha1.PolicyViolationCondition)
+				g.Expect(cond).NotTo(BeNil())
+				g.Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+				g.Expect(cond.Reason).To(Equal(awsauthv1alpha1.ForbiddenMappingsReason))
+				g.Expect(cond.Message).To(ContainSubstring("spec.mapRoles[1].groups[0]"))
+			}).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				cm, err := getAWSAuthConfigMap()
+				g.Expect(err).NotTo(HaveOccurred())
+				roles, err := getMapRolesFromConfigMap(cm)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(roles).To(ContainElement(allowed))
+				g.Expect(roles).NotTo(ContainElement(forbidden))
+			}).Should(Succeed())
+		})
+	})
+
+	Context("when an AWSAuthTarget selects an item", func() {
+		It("should render the item to the ConfigMap of the target only", func() {
+			labels := map[string]string{"aws-auth-manager-test": uniqueName("staging")}
+			target := &awsauthv1alpha1.AWSAuthTarget{
+				ObjectMeta: metav1.ObjectMeta{Name: uniqueName("staging")},
+				Spec: awsauthv1alpha1.AWSAuthTargetSpec{
+					ConfigMap: awsauthv1alpha1.ConfigMapReference{
+						Name:      uniqueName("aws-auth-staging"),
+						Namespace: reconciler.AWSAuthConfigMapNamespace,
+					},
+					ItemSelector: metav1.LabelSelector{MatchLabels: labels},
+				},
+			}
+			Expect(k8sClient.Create(ctx, target)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, target)
+			DeferCleanup(k8sClient.Delete, ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:      target.Spec.ConfigMap.Name,
+				Namespace: target.Spec.ConfigMap.Namespace,
+			}})
+
+			role := awsauthv1alpha1.MapRoleItem{
+				RoleArn:  "arn:aws:iam::111122223333:role/staging-deployer",
+				Username: "staging-deployer",
+				Groups:   []string{"edit"},
+			}
+			item := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("target-test"),
+					Namespace: reconciler.AWSAuthConfigMapNamespace,
+					Labels:    labels,
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapRoles: []awsauthv1alpha1.MapRoleItem{role},
+				},
+			}
+			Expect(k8sClient.Create(ctx, item)).To(Succeed())
+			DeferCleanup(cleanupAWSAuthItem, item)
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+				g.Expect(apimeta.IsStatusConditionTrue(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)).To(BeTrue())
+				g.Expect(fetched.Status.AppliedTargets).To(Equal([]awsauthv1alpha1.AppliedTarget{{
+					Name:      target.Name,
+					ConfigMap: target.Spec.ConfigMap.Namespace + "/" + target.Spec.ConfigMap.Name,
+				}}))
+
+				var staging corev1.ConfigMap
+				g.Expect(k8sClient.Get(ctx, client.ObjectKey{
+					Name:      target.Spec.ConfigMap.Name,
+					Namespace: target.Spec.ConfigMap.Namespace,
+				}, &staging)).To(Succeed())
+				roles, err := getMapRolesFromConfigMap(&staging)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(roles).To(ConsistOf(role))
+			}).Should(Succeed())
+
+			cm, err := getAWSAuthConfigMap()
+			Expect(err).NotTo(HaveOccurred())
+			roles, err := getMapRolesFromConfigMap(cm)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(roles).NotTo(ContainElement(role))
+
+			// Removing the labels routes the item back to the aws-auth ConfigMap
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), item)).To(Succeed())
+			item.Labels = nil
+			Expect(k8sClient.Update(ctx, item)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				cm, err := getAWSAuthConfigMap()
+				g.Expect(err).NotTo(HaveOccurred())
+				roles, err := getMapRolesFromConfigMap(cm)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(roles).To(ContainElement(role))
+
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+				g.Expect(fetched.Status.AppliedTargets).To(Equal([]awsauthv1alpha1.AppliedTarget{{ConfigMap: cm.Namespace + "/" + cm.Name}}))
+			}).Should(Succeed())
+		})
+
+		It("should keep the items in the aws-auth ConfigMap without a valid selector", func() {
+			empty := &awsauthv1alpha1.AWSAuthTarget{
+				ObjectMeta: metav1.ObjectMeta{Name: uniqueName("empty-selector")},
+				Spec: awsauthv1alpha1.AWSAuthTargetSpec{
+					ConfigMap: awsauthv1alpha1.ConfigMapReference{
+						Name:      uniqueName("aws-auth-empty"),
+						Namespace: reconciler.AWSAuthConfigMapNamespace,
+					},
+				},
+			}
+			invalid := &awsauthv1alpha1.AWSAuthTarget{
+				ObjectMeta: metav1.ObjectMeta{Name: uniqueName("invalid-selector")},
+				Spec: awsauthv1alpha1.AWSAuthTargetSpec{
+					ConfigMap: awsauthv1alpha1.ConfigMapReference{
+						Name:      uniqueName("aws-auth-invalid"),
+						Namespace: reconciler.AWSAuthConfigMapNamespace,
+					},
+					ItemSelector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+						Key:      "aws-auth-manager-test",
+						Operator: metav1.LabelSelectorOpIn,
+					}}},
+				},
+			}
+			for _, target := range []*awsauthv1alpha1.AWSAuthTarget{empty, invalid} {
+				Expect(k8sClient.Create(ctx, target)).To(Succeed())
+				DeferCleanup(k8sClient.Delete, ctx, target)
+				DeferCleanup(k8sClient.Delete, ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+					Name:      target.Spec.ConfigMap.Name,
+					Namespace: target.Spec.ConfigMap.Namespace,
+				}})
+			}
+
+			role := awsauthv1alpha1.MapRoleItem{
+				RoleArn:  "arn:aws:iam::111122223333:role/unselected",
+				Username: "unselected",
+				Groups:   []string{"view"},
+			}
+			item := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("unselected-test"),
+					Namespace: reconciler.AWSAuthConfigMapNamespace,
+					Labels:    map[string]string{"aws-auth-manager-test": "unselected"},
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapRoles: []awsauthv1alpha1.MapRoleItem{role},
+				},
+			}
+			Expect(k8sClient.Create(ctx, item)).To(Succeed())
+			DeferCleanup(cleanupAWSAuthItem, item)
+
+			Eventually(func(g Gomega) {
+				cm, err := getAWSAuthConfigMap()
+				g.Expect(err).NotTo(HaveOccurred())
+				roles, err := getMapRolesFromConfigMap(cm)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(roles).To(ContainElement(role))
+
+				var fetched awsauthv1alpha1.AWSAuthTarget
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(invalid), &fetched)).To(Succeed())
+				ready := apimeta.FindStatusCondition(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)
+				g.Expect(ready).NotTo(BeNil())
+				g.Expect(ready.Reason).To(Equal(awsauthv1alpha1.InvalidItemSelectorReason))
+			}).Should(Succeed())
+		})
+	})
+
+	Context("when an AWSAuthTarget has a kubeconfig", func() {
+		It("should render the item to the ConfigMap of the remote cluster", func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("remote-kubeconfig"),
+					Namespace: reconciler.AWSAuthConfigMapNamespace,
+				},
+				Data: map[string][]byte{DefaultKubeConfigKey: remoteKubeConfig},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, secret)
+
+			labels := map[string]string{"aws-auth-manager-test": uniqueName("remote")}
+			target := &awsauthv1alpha1.AWSAuthTarget{
+				ObjectMeta: metav1.ObjectMeta{Name: uniqueName("remote")},
+				Spec: awsauthv1alpha1.AWSAuthTargetSpec{
+					ConfigMap: awsauthv1alpha1.ConfigMapReference{
+						Name:      "aws-auth",
+						Namespace: "kube-system",
+					},
+					ItemSelector: metav1.LabelSelector{MatchLabels: labels},
+					KubeConfig: &awsauthv1alpha1.KubeConfigReference{
+						SecretRef: awsauthv1alpha1.SecretKeyReference{Name: secret.Name, Namespace: secret.Namespace},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, target)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, target)
+			remoteKey := client.ObjectKey{Name: target.Spec.ConfigMap.Name, Namespace: target.Spec.ConfigMap.Namespace}
+			DeferCleanup(remoteK8sClient.Delete, ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:      remoteKey.Name,
+				Namespace: remoteKey.Namespace,
+			}})
+
+			role := awsauthv1alpha1.MapRoleItem{
+				RoleArn:  "arn:aws:iam::111122223333:role/remote-deployer",
+				Username: "remote-deployer",
+				Groups:   []string{"edit"},
+			}
+			item := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("remote-test"),
+					Namespace: reconciler.AWSAuthConfigMapNamespace,
+					Labels:    labels,
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapRoles: []awsauthv1alpha1.MapRoleItem{role},
+				},
+			}
+			Expect(k8sClient.Create(ctx, item)).To(Succeed())
+			DeferCleanup(cleanupAWSAuthItem, item)
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+				g.Expect(apimeta.IsStatusConditionTrue(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)).To(BeTrue())
+				g.Expect(fetched.Status.AppliedTargets).To(Equal([]awsauthv1alpha1.AppliedTarget{{
+					Name:      target.Name,
+					ConfigMap: remoteKey.String(),
+					Cluster:   secret.Namespace + "/" + secret.Name,
+				}}))
+
+				var fetchedTarget awsauthv1alpha1.AWSAuthTarget
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(target), &fetchedTarget)).To(Succeed())
+				g.Expect(apimeta.IsStatusConditionTrue(fetchedTarget.Status.Conditions, awsauthv1alpha1.ReadyCondition)).To(BeTrue())
+				g.Expect(fetchedTarget.Status.ObservedGeneration).To(Equal(fetchedTarget.Generation))
+
+				var remote corev1.ConfigMap
+				g.Expect(remoteK8sClient.Get(ctx, remoteKey, &remote)).To(Succeed())
+				roles, err := getMapRolesFromConfigMap(&remote)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(roles).To(ConsistOf(role))
+			}).Should(Succeed())
+
+			// The ConfigMap of the same name in this cluster is not rendered
+			var local corev1.ConfigMap
+			err := k8sClient.Get(ctx, remoteKey, &local)
+			if err == nil {
+				roles, err := getMapRolesFromConfigMap(&local)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(roles).NotTo(ContainElement(role))
+			} else {
+				Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			}
+
+			// A drift of the remote ConfigMap is reverted
+			var remote corev1.ConfigMap
+			Expect(remoteK8sClient.Get(ctx, remoteKey, &remote)).To(Succeed())
+			patch := client.MergeFrom(remote.DeepCopy())
+			remote.Data["mapRoles"] = ""
+			Expect(remoteK8sClient.Patch(ctx, &remote, patch)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				var remote corev1.ConfigMap
+				g.Expect(remoteK8sClient.Get(ctx, remoteKey, &remote)).To(Succeed())
+				roles, err := getMapRolesFromConfigMap(&remote)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(roles).To(ConsistOf(role))
+			}).Should(Succeed())
+		})
+
+		It("should report a missing kubeconfig in the target status", func() {
+			target := &awsauthv1alpha1.AWSAuthTarget{
+				ObjectMeta: metav1.ObjectMeta{Name: uniqueName("unreachable")},
+				Spec: awsauthv1alpha1.AWSAuthTargetSpec{
+					ConfigMap: awsauthv1alpha1.ConfigMapReference{
+						Name:      "aws-auth",
+						Namespace: "kube-system",
+					},
+					ItemSelector: metav1.LabelSelector{MatchLabels: map[string]string{
+						"aws-auth-manager-test": uniqueName("unreachable"),
+					}},
+					KubeConfig: &awsauthv1alpha1.KubeConfigReference{
+						SecretRef: awsauthv1alpha1.SecretKeyReference{
+							Name:      uniqueName("missing"),
+							Namespace: reconciler.AWSAuthConfigMapNamespace,
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, target)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, target)
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthTarget
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(target), &fetched)).To(Succeed())
+				ready := apimeta.FindStatusCondition(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)
+				g.Expect(ready).NotTo(BeNil())
+				g.Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+				g.Expect(ready.Reason).To(Equal(awsauthv1alpha1.GetKubeConfigFailedReason))
+			}).Should(Succeed())
+		})
+	})
+
+	// This test implicitly verifies the ConfigMap watch of the aggregate
+	// controller by confirming that external ConfigMap modifications trigger
+	// a new rendering.
 	Context("when ConfigMap is modified externally", func() {
 		It("should reconcile back to desired state", func() {
 			expectedUser := awsauthv1alpha1.MapUserItem{
@@ -837,18 +1294,380 @@ var _ = Describe("AWSAuthItem controller", func() {
 			// Externally modify ConfigMap
 			cm, err := getAWSAuthConfigMap()
 			Expect(err).NotTo(HaveOccurred())
+			corrections := driftCorrectionsTotal.WithLabelValues(client.ObjectKeyFromObject(cm).String(), "")
+			before := testutil.ToFloat64(corrections)
 			patch := client.MergeFrom(cm.DeepCopy())
 			cm.Data["mapUsers"] = "corrupted-data"
 			Expect(k8sClient.Patch(ctx, cm, patch)).To(Succeed())
 
-			// Verify ConfigMap is reconciled back to desired state
+			// Verify ConfigMap is reconciled back to desired state, as a drift
+			// correction
 			Eventually(func(g Gomega) {
 				cm, err := getAWSAuthConfigMap()
 				g.Expect(err).NotTo(HaveOccurred())
 				users, err := getMapUsersFromConfigMap(cm)
 				g.Expect(err).NotTo(HaveOccurred())
 				g.Expect(users).To(ContainElement(expectedUser))
+				g.Expect(testutil.ToFloat64(corrections)).To(BeNumerically(">", before))
 			}).Should(Succeed())
+
+			lastWrite := lastWriteGauge.WithLabelValues(client.ObjectKeyFromObject(cm).String(), "")
+			Expect(testutil.ToFloat64(lastWrite)).To(BeNumerically(">", 0))
+		})
+
+		It("should report who changed it and what was reverted", func() {
+			item := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("drift-test"),
+					Namespace: reconciler.AWSAuthConfigMapNamespace,
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapUsers: []awsauthv1alpha1.MapUserItem{{
+						UserArn:  "arn:aws:iam::111122223333:user/drift-user",
+						Username: "drift-user",
+						Groups:   []string{"view"},
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, item)).To(Succeed())
+			DeferCleanup(cleanupAWSAuthItem, item)
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+				g.Expect(apimeta.IsStatusConditionTrue(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)).To(BeTrue())
+			}).Should(Succeed())
+			drainEvents()
+
+			// Map an intruder by hand
+			intruderArn := "arn:aws:iam::111122223333:user/drift-intruder"
+			cm, err := getAWSAuthConfigMap()
+			Expect(err).NotTo(HaveOccurred())
+			patch := client.MergeFrom(cm.DeepCopy())
+			cm.Data["mapUsers"] += "- userarn: " + intruderArn + "\n  username: intruder\n  groups:\n    - system:masters\n"
+			Expect(k8sClient.Patch(ctx, cm, patch)).To(Succeed())
+
+			var detected, corrected bool
+			Eventually(func() bool {
+				select {
+				case event := <-fakeRecorder.Events:
+					detected = detected || strings.Contains(event, awsauthv1alpha1.DriftDetectedReason) &&
+						strings.Contains(event, "(Update)") && strings.Contains(event, intruderArn)
+					corrected = corrected || strings.Contains(event, awsauthv1alpha1.DriftCorrectedReason) &&
+						strings.Contains(event, "- mapUsers "+intruderArn)
+				default:
+				}
+				return detected && corrected
+			}).Should(BeTrue())
+
+			Eventually(func(g Gomega) {
+				cm, err := getAWSAuthConfigMap()
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(cm.Data["mapUsers"]).NotTo(ContainSubstring(intruderArn))
+			}).Should(Succeed())
+		})
+	})
+
+	Context("when another field manager owns the ConfigMap data", func() {
+		It("should force its ownership and report the conflict", func() {
+			expectedUser := awsauthv1alpha1.MapUserItem{
+				UserArn:  "arn:aws:iam::111122223333:user/field-manager-user",
+				Username: "field-manager-user",
+				Groups:   []string{"view"},
+			}
+			item := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("field-manager-test"),
+					Namespace: reconciler.AWSAuthConfigMapNamespace,
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapUsers: []awsauthv1alpha1.MapUserItem{expectedUser},
+				},
+			}
+			Expect(k8sClient.Create(ctx, item)).To(Succeed())
+			DeferCleanup(cleanupAWSAuthItem, item)
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+				g.Expect(apimeta.IsStatusConditionTrue(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)).To(BeTrue())
+			}).Should(Succeed())
+			drainEvents()
+
+			// Take over mapUsers as another tool would
+			applied := corev1ac.ConfigMap(reconciler.AWSAuthConfigMapName, reconciler.AWSAuthConfigMapNamespace).
+				WithData(map[string]string{"mapUsers": "[]\n"})
+			Expect(k8sClient.Apply(ctx, applied, client.FieldOwner("eksctl"), client.ForceOwnership)).To(Succeed())
+
+			Eventually(func() bool {
+				select {
+				case event := <-fakeRecorder.Events:
+					return strings.Contains(event, awsauthv1alpha1.FieldManagerConflictReason) && strings.Contains(event, `"eksctl"`)
+				default:
+					return false
+				}
+			}).Should(BeTrue())
+
+			Eventually(func(g Gomega) {
+				cm, err := getAWSAuthConfigMap()
+				g.Expect(err).NotTo(HaveOccurred())
+				users, err := getMapUsersFromConfigMap(cm)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(users).To(ContainElement(expectedUser))
+
+				var managers []string
+				for _, entry := range cm.ManagedFields {
+					if strings.Contains(string(entry.FieldsV1.Raw), `"f:mapUsers"`) {
+						managers = append(managers, entry.Manager)
+					}
+				}
+				g.Expect(managers).To(ConsistOf(FieldManager))
+			}).Should(Succeed())
+		})
+	})
+
+	Context("when the ConfigMap is pinned to a revision", func() {
+		It("should write the mappings of the revision until released", func() {
+			newItem := func(prefix string) (*awsauthv1alpha1.AWSAuthItem, awsauthv1alpha1.MapUserItem) {
+				name := uniqueName(prefix)
+				user := awsauthv1alpha1.MapUserItem{
+					UserArn:  "arn:aws:iam::111122223333:user/" + name,
+					Username: name,
+					Groups:   []string{"view"},
+				}
+				item := &awsauthv1alpha1.AWSAuthItem{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: reconciler.AWSAuthConfigMapNamespace},
+					Spec:       awsauthv1alpha1.AWSAuthItemSpec{MapUsers: []awsauthv1alpha1.MapUserItem{user}},
+				}
+				Expect(k8sClient.Create(ctx, item)).To(Succeed())
+				DeferCleanup(cleanupAWSAuthItem, item)
+
+				return item, user
+			}
+			expectReady := func(item *awsauthv1alpha1.AWSAuthItem, reason string) {
+				Eventually(func(g Gomega) {
+					var fetched awsauthv1alpha1.AWSAuthItem
+					g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+					ready := apimeta.FindStatusCondition(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)
+					g.Expect(ready).NotTo(BeNil())
+					g.Expect(ready.Reason).To(Equal(reason))
+				}).Should(Succeed())
+			}
+			expectMapped := func(user awsauthv1alpha1.MapUserItem, mapped bool) {
+				Eventually(func(g Gomega) {
+					cm, err := getAWSAuthConfigMap()
+					g.Expect(err).NotTo(HaveOccurred())
+					users, err := getMapUsersFromConfigMap(cm)
+					g.Expect(err).NotTo(HaveOccurred())
+					if mapped {
+						g.Expect(users).To(ContainElement(user))
+					} else {
+						g.Expect(users).NotTo(ContainElement(user))
+					}
+				}).Should(Succeed())
+			}
+			pin := func(revision *string) {
+				annotateAWSAuthConfigMap(render.PinnedRevisionAnnotation, revision)
+			}
+
+			first, firstUser := newItem("pinned-first")
+			expectReady(first, awsauthv1alpha1.ReconciliationSucceededReason)
+
+			// The revision of the first item only
+			var revision string
+			Eventually(func(g Gomega) {
+				var revisions corev1.ConfigMapList
+				g.Expect(k8sClient.List(ctx, &revisions, client.InNamespace(reconciler.AWSAuthConfigMapNamespace),
+					client.MatchingLabels{render.RevisionLabel: reconciler.AWSAuthConfigMapName})).To(Succeed())
+				render.SortRevisions(revisions.Items)
+				g.Expect(revisions.Items).NotTo(BeEmpty())
+				g.Expect(len(revisions.Items)).To(BeNumerically("<=", reconciler.RevisionHistoryLimit))
+				parsed, err := render.ParseRevision(&revisions.Items[0])
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(parsed.Items).To(ContainElement("AWSAuthItem " + first.Namespace + "/" + first.Name))
+				revision = parsed.Name
+			}).Should(Succeed())
+
+			second, secondUser := newItem("pinned-second")
+			expectReady(second, awsauthv1alpha1.ReconciliationSucceededReason)
+			expectMapped(secondUser, true)
+
+			pin(&revision)
+			DeferCleanup(pin, (*string)(nil))
+			expectMapped(secondUser, false)
+			expectMapped(firstUser, true)
+			expectReady(second, awsauthv1alpha1.PinnedRevisionReason)
+
+			pin(nil)
+			expectMapped(secondUser, true)
+			expectReady(second, awsauthv1alpha1.ReconciliationSucceededReason)
+		})
+	})
+
+	Context("when a change trips a safety guard", func() {
+		It("should not apply it until overridden", func() {
+			expectedRole := awsauthv1alpha1.MapRoleItem{
+				RoleArn:  lockoutRoleArn,
+				Username: "system:node:{{EC2PrivateDNSName}}",
+				Groups:   []string{"system:bootstrappers", "system:nodes"},
+			}
+			item := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("lockout-test"),
+					Namespace: reconciler.AWSAuthConfigMapNamespace,
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapRoles: []awsauthv1alpha1.MapRoleItem{expectedRole},
+				},
+			}
+			Expect(k8sClient.Create(ctx, item)).To(Succeed())
+			DeferCleanup(cleanupAWSAuthItem, item)
+			DeferCleanup(annotateAWSAuthConfigMap, render.OverrideSafetyChecksAnnotation, (*string)(nil))
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+				g.Expect(apimeta.IsStatusConditionTrue(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)).To(BeTrue())
+			}).Should(Succeed())
+			drainEvents()
+
+			// Deleting the item removes the required role
+			Expect(k8sClient.Delete(ctx, item)).To(Succeed())
+
+			var hash string
+			overrideRe := regexp.MustCompile(`to ([0-9a-f]{64}) to apply it anyway`)
+			Eventually(func() bool {
+				select {
+				case event := <-fakeRecorder.Events:
+					match := overrideRe.FindStringSubmatch(event)
+					if !strings.Contains(event, awsauthv1alpha1.SafetyCheckFailedReason) || match == nil {
+						return false
+					}
+					hash = match[1]
+					return true
+				default:
+					return false
+				}
+			}).Should(BeTrue())
+
+			cm, err := getAWSAuthConfigMap()
+			Expect(err).NotTo(HaveOccurred())
+			roles, err := getMapRolesFromConfigMap(cm)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(roles).To(ContainElement(expectedRole))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), item)).To(Succeed())
+
+			annotateAWSAuthConfigMap(render.OverrideSafetyChecksAnnotation, &hash)
+			Eventually(func(g Gomega) {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &awsauthv1alpha1.AWSAuthItem{})
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+				cm, err := getAWSAuthConfigMap()
+				g.Expect(err).NotTo(HaveOccurred())
+				roles, err := getMapRolesFromConfigMap(cm)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(roles).NotTo(ContainElement(expectedRole))
+			}).Should(Succeed())
+		})
+	})
+
+	Context("when an item is in dry run", func() {
+		It("should report its changes in status without applying them", func() {
+			role := awsauthv1alpha1.MapRoleItem{
+				RoleArn:  "arn:aws:iam::111122223333:role/dry-run",
+				Username: "dry-run",
+				Groups:   []string{"view"},
+			}
+			item := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      uniqueName("dry-run-test"),
+					Namespace: reconciler.AWSAuthConfigMapNamespace,
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapRoles: []awsauthv1alpha1.MapRoleItem{role},
+				},
+			}
+			Expect(k8sClient.Create(ctx, item)).To(Succeed())
+			DeferCleanup(cleanupAWSAuthItem, item)
+			waitForReady([]*awsauthv1alpha1.AWSAuthItem{item})
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), item)).To(Succeed())
+			item.Spec.DryRun = true
+			item.Spec.MapRoles[0].Groups = []string{"edit"}
+			Expect(k8sClient.Update(ctx, item)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+				g.Expect(fetched.Status.ObservedGeneration).To(Equal(fetched.Generation))
+
+				cond := apimeta.FindStatusCondition(fetched.Status.Conditions, awsauthv1alpha1.ReadyCondition)
+				g.Expect(cond).NotTo(BeNil())
+				g.Expect(cond.Reason).To(Equal(awsauthv1alpha1.DryRunReason))
+				g.Expect(fetched.Status.PendingChanges).To(Equal([]awsauthv1alpha1.PendingChange{{
+					Type:    render.ChangeModified,
+					Key:     "mapRoles",
+					ID:      role.RoleArn,
+					Live:    &awsauthv1alpha1.PendingMapping{Username: "dry-run", Groups: []string{"view"}},
+					Desired: &awsauthv1alpha1.PendingMapping{Username: "dry-run", Groups: []string{"edit"}},
+				}}))
+			}).Should(Succeed())
+
+			cm, err := getAWSAuthConfigMap()
+			Expect(err).NotTo(HaveOccurred())
+			roles, err := getMapRolesFromConfigMap(cm)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(roles).To(ContainElement(role))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), item)).To(Succeed())
+			item.Spec.DryRun = false
+			Expect(k8sClient.Update(ctx, item)).To(Succeed())
+			waitForReady([]*awsauthv1alpha1.AWSAuthItem{item})
+
+			Eventually(func(g Gomega) {
+				var fetched awsauthv1alpha1.AWSAuthItem
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(item), &fetched)).To(Succeed())
+				g.Expect(fetched.Status.PendingChanges).To(BeEmpty())
+
+				cm, err := getAWSAuthConfigMap()
+				g.Expect(err).NotTo(HaveOccurred())
+				roles, err := getMapRolesFromConfigMap(cm)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(roles).To(ContainElement(item.Spec.MapRoles[0]))
+			}).Should(Succeed())
+		})
+	})
+
+	Context("when the controller is in dry run", func() {
+		It("should remove the finalizer of a deleted item", func() {
+			now := metav1.Now()
+			item := &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "dry-run-delete-test",
+					Namespace:         reconciler.AWSAuthConfigMapNamespace,
+					Finalizers:        []string{awsauthv1alpha1.AWSAuthFinalizer},
+					DeletionTimestamp: &now,
+				},
+				Spec: awsauthv1alpha1.AWSAuthItemSpec{
+					MapRoles: []awsauthv1alpha1.MapRoleItem{{
+						RoleArn:  "arn:aws:iam::111122223333:role/dry-run-delete",
+						Username: "dry-run-delete",
+						Groups:   []string{"view"},
+					}},
+				},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(item).Build()
+
+			// No aggregate reconciliation ran, which holds back the finalizer
+			// unless in dry run
+			dryRun := &AWSAuthItemReconciler{Client: c, Scheme: scheme.Scheme, DryRun: true}
+			_, err := (&AWSAuthItemReconciler{Client: c, Scheme: scheme.Scheme}).reconcileItem(ctx, item.DeepCopy())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(item), item)).To(Succeed())
+
+			_, err = dryRun.reconcileItem(ctx, item)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(item), item))).To(BeTrue())
 		})
 	})
 })
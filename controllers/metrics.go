@@ -0,0 +1,190 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/render"
+)
+
+// Types of the conflicts counted by the conflicts metric.
+const (
+	conflictTypeDuplicateARN = "duplicate-arn"
+	conflictTypeFieldManager = "field-manager"
+)
+
+var (
+	mappingsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aws_auth_manager_mappings",
+		Help: "Number of mappings rendered from the items of a namespace, by data key. " +
+			"The mappings of the ClusterAWSAuthItems have an empty namespace.",
+	}, []string{"namespace", "key"})
+
+	driftCorrectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aws_auth_manager_drift_corrections_total",
+		Help: "Number of times the changes of a ConfigMap by another client were reverted.",
+	}, []string{"configmap", "cluster"})
+
+	configMapSizeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aws_auth_manager_configmap_size_bytes",
+		Help: "Size of the data of a ConfigMap as last written.",
+	}, []string{"configmap", "cluster"})
+
+	conflictsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aws_auth_manager_conflicts",
+		Help: "Number of conflicts detected by the last rendering of a ConfigMap: " +
+			"ARNs mapped by more than one item, or fields managed by other field managers.",
+	}, []string{"configmap", "cluster", "type"})
+
+	lastWriteGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aws_auth_manager_last_successful_write_timestamp_seconds",
+		Help: "Unix time of the last rendering of a ConfigMap that was written or already up to date.",
+	}, []string{"configmap", "cluster"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(mappingsGauge, driftCorrectionsTotal, configMapSizeGauge, conflictsGauge, lastWriteGauge)
+}
+
+// itemsDesc describes the number of items by Ready reason, collected from the
+// cache when scraped.
+var itemsDesc = prometheus.NewDesc(
+	"aws_auth_manager_items",
+	"Number of AWSAuthItems and ClusterAWSAuthItems by kind and reason of their Ready condition.",
+	[]string{"kind", "reason"}, nil,
+)
+
+// itemCollector collects the number of items by Ready reason.
+type itemCollector struct {
+	reader client.Reader
+}
+
+// Describe implements prometheus.Collector.
+func (c *itemCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- itemsDesc
+}
+
+// Collect implements prometheus.Collector. Nothing is collected until the
+// cache is started.
+func (c *itemCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+
+	var clusterItemList awsauthv1alpha1.ClusterAWSAuthItemList
+	if err := c.reader.List(ctx, &clusterItemList); err != nil {
+		return
+	}
+	var itemList awsauthv1alpha1.AWSAuthItemList
+	if err := c.reader.List(ctx, &itemList); err != nil {
+		return
+	}
+
+	type kindReason struct{ kind, reason string }
+	counts := map[kindReason]int{}
+	count := func(kind string, conditions []metav1.Condition) {
+		reason := "Unknown"
+		if ready := apimeta.FindStatusCondition(conditions, awsauthv1alpha1.ReadyCondition); ready != nil {
+			reason = ready.Reason
+		}
+		counts[kindReason{kind, reason}]++
+	}
+	for _, item := range clusterItemList.Items {
+		count("ClusterAWSAuthItem", item.Status.Conditions)
+	}
+	for _, item := range itemList.Items {
+		count("AWSAuthItem", item.Status.Conditions)
+	}
+
+	for key, n := range counts {
+		ch <- prometheus.MustNewConstMetric(itemsDesc, prometheus.GaugeValue, float64(n), key.kind, key.reason)
+	}
+}
+
+// recordMappings sets the mappings metric from the renderings of targets.
+func recordMappings(targets []*targetResult) {
+	type namespaceKey struct{ namespace, key string }
+	counts := map[namespaceKey]int{}
+	for _, t := range targets {
+		agg := render.SelectKeys(t.agg, t.target.keys)
+		for _, role := range agg.MapRoles {
+			counts[namespaceKey{agg.Owners[role.RoleArn].Namespace, "mapRoles"}]++
+		}
+		for _, user := range agg.MapUsers {
+			counts[namespaceKey{agg.Owners[user.UserArn].Namespace, "mapUsers"}]++
+		}
+		for _, account := range agg.MapAccounts {
+			counts[namespaceKey{agg.Owners[account].Namespace, "mapAccounts"}]++
+		}
+	}
+
+	mappingsGauge.Reset()
+	for key, n := range counts {
+		mappingsGauge.WithLabelValues(key.namespace, key.key).Set(float64(n))
+	}
+}
+
+// recordConflicts sets the conflicts metric of the ConfigMap of t.
+func recordConflicts(t *targetResult) {
+	configMap, cluster := t.target.configMap.String(), t.target.cluster()
+	conflictsGauge.WithLabelValues(configMap, cluster, conflictTypeDuplicateARN).Set(float64(len(t.agg.Conflicts)))
+	conflictsGauge.WithLabelValues(configMap, cluster, conflictTypeFieldManager).Set(float64(len(t.conflicts)))
+}
+
+// recordWrite sets the size and last write metrics of cm, the ConfigMap of t
+// as written or found up to date.
+func recordWrite(t *targetResult, cm *corev1.ConfigMap) {
+	size := 0
+	for key, value := range cm.Data {
+		size += len(key) + len(value)
+	}
+
+	configMap, cluster := t.target.configMap.String(), t.target.cluster()
+	configMapSizeGauge.WithLabelValues(configMap, cluster).Set(float64(size))
+	lastWriteGauge.WithLabelValues(configMap, cluster).Set(float64(time.Now().Unix()))
+}
+
+// forgetTargets deletes the metrics of the ConfigMaps of previous no longer
+// rendered by a target of current.
+func forgetTargets(previous *aggregateResult, current []target) {
+	if previous == nil {
+		return
+	}
+
+	rendered := map[configMapKey]bool{}
+	for _, t := range current {
+		rendered[t.key()] = true
+	}
+	for _, t := range previous.targets {
+		if rendered[t.target.key()] {
+			continue
+		}
+		labels := prometheus.Labels{"configmap": t.target.configMap.String(), "cluster": t.target.cluster()}
+		driftCorrectionsTotal.DeletePartialMatch(labels)
+		configMapSizeGauge.DeletePartialMatch(labels)
+		conflictsGauge.DeletePartialMatch(labels)
+		lastWriteGauge.DeletePartialMatch(labels)
+	}
+}
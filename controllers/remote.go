@@ -0,0 +1,253 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+)
+
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get
+
+// DefaultKubeConfigKey is the default data key of the kubeconfig Secret of a
+// remote cluster.
+const DefaultKubeConfigKey = "value"
+
+const (
+	// remoteCacheSyncTimeout bounds the wait for the cache of a remote cluster
+	// to sync when connecting to it.
+	remoteCacheSyncTimeout = 15 * time.Second
+
+	// remoteRequestTimeout bounds the requests to a remote cluster, so that an
+	// unreachable cluster doesn't block the rendering of the other targets.
+	remoteRequestTimeout = 30 * time.Second
+)
+
+// remoteCluster is the connection to the remote cluster of an AWSAuthTarget.
+// Its cache watches the namespace of the ConfigMap of the AWSAuthTarget,
+// which holds its revisions too.
+type remoteCluster struct {
+	// hash is the SHA-256 of the kubeconfig and the namespace the cluster was
+	// connected with, so that it is connected again when either changes.
+	hash    string
+	cluster cluster.Cluster
+	cancel  context.CancelFunc
+
+	// informer and registration are the ConfigMap informer of the cluster and
+	// the event handler sending the changes of the ConfigMap to remoteEvents.
+	informer     cache.Informer
+	registration toolscache.ResourceEventHandlerRegistration
+}
+
+// stop removes the event handler of the ConfigMap and disconnects from the
+// remote cluster.
+func (c *remoteCluster) stop() {
+	_ = c.informer.RemoveEventHandler(c.registration)
+	c.cancel()
+}
+
+// remoteClient returns the client of the remote cluster of t, connecting to
+// it unless it is already connected with its current kubeconfig. Once
+// connected, the changes of the ConfigMap of t on the remote cluster trigger a
+// rendering, so that a drift is reverted.
+func (r *aggregateReconciler) remoteClient(ctx context.Context, t target) (client.Client, *aggregateFailure) {
+	log := log.FromContext(ctx).WithValues("target", t.name)
+
+	kubeConfig, err := r.kubeConfig(ctx, t.kubeConfig)
+	if err != nil {
+		return nil, &aggregateFailure{
+			reason: awsauthv1alpha1.GetKubeConfigFailedReason,
+			action: "GetFailed",
+			note:   "Failed to fetch remote cluster kubeconfig",
+			err:    err,
+		}
+	}
+	connectFailure := func(err error) *aggregateFailure {
+		return &aggregateFailure{
+			reason: awsauthv1alpha1.ConnectRemoteClusterFailedReason,
+			action: "ConnectFailed",
+			note:   "Failed to connect to remote cluster",
+			err:    fmt.Errorf("connecting to the remote cluster of kubeconfig Secret %s: %w", t.cluster(), err),
+		}
+	}
+
+	h := sha256.New()
+	h.Write(kubeConfig)
+	fmt.Fprintf(h, "\x00%s", t.configMap.Namespace)
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	r.remotesMu.Lock()
+	defer r.remotesMu.Unlock()
+
+	if remote, ok := r.remotes[t.name]; ok {
+		if remote.hash == hash {
+			return remote.cluster.GetClient(), nil
+		}
+		remote.stop()
+		delete(r.remotes, t.name)
+		log.Info("disconnected from the remote cluster, its kubeconfig or namespace changed")
+	}
+
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeConfig)
+	if err != nil {
+		return nil, connectFailure(fmt.Errorf("parsing kubeconfig: %w", err))
+	}
+	config.Timeout = remoteRequestTimeout
+
+	remote, err := cluster.New(config, func(o *cluster.Options) {
+		o.Scheme = r.Scheme
+		o.Cache.DefaultNamespaces = map[string]cache.Config{t.configMap.Namespace: {}}
+	})
+	if err != nil {
+		return nil, connectFailure(err)
+	}
+
+	// The remote cluster outlives the reconciliation, until its AWSAuthTarget
+	// or kubeconfig changes or the controller stops
+	clusterCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		if err := remote.Start(clusterCtx); err != nil {
+			log.Error(err, "remote cluster stopped")
+		}
+	}()
+
+	syncCtx, cancelSync := context.WithTimeout(ctx, remoteCacheSyncTimeout)
+	defer cancelSync()
+	informer, err := remote.GetCache().GetInformer(syncCtx, &corev1.ConfigMap{})
+	if err != nil {
+		cancel()
+		return nil, connectFailure(fmt.Errorf("watching ConfigMaps: %w", err))
+	}
+	if !remote.GetCache().WaitForCacheSync(syncCtx) {
+		cancel()
+		return nil, connectFailure(fmt.Errorf("timed out after %s waiting for the ConfigMaps to sync", remoteCacheSyncTimeout))
+	}
+
+	// The changes of the ConfigMap are sent to the single channel watched by
+	// the aggregate controller, rather than adding a watch to it for every
+	// connection, which would outlive the connection
+	configMap := t.configMap
+	send := func(obj any) {
+		if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		cm, ok := obj.(client.Object)
+		if !ok || client.ObjectKeyFromObject(cm) != configMap {
+			return
+		}
+		select {
+		case r.remoteEvents <- event.GenericEvent{Object: cm}:
+		case <-clusterCtx.Done():
+		}
+	}
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: send,
+		UpdateFunc: func(oldObj, newObj any) {
+			if oldObj.(client.Object).GetResourceVersion() != newObj.(client.Object).GetResourceVersion() {
+				send(newObj)
+			}
+		},
+		DeleteFunc: send,
+	})
+	if err != nil {
+		cancel()
+		return nil, connectFailure(fmt.Errorf("watching the ConfigMap: %w", err))
+	}
+
+	if r.remotes == nil {
+		r.remotes = map[string]*remoteCluster{}
+	}
+	r.remotes[t.name] = &remoteCluster{
+		hash:         hash,
+		cluster:      remote,
+		cancel:       cancel,
+		informer:     informer,
+		registration: registration,
+	}
+	log.Info("connected to the remote cluster", "host", config.Host)
+
+	return remote.GetClient(), nil
+}
+
+// kubeConfig returns the kubeconfig held by the Secret key ref. The Secret is
+// read from the API server, as the Secrets are not cached.
+func (r *aggregateReconciler) kubeConfig(ctx context.Context, ref *awsauthv1alpha1.SecretKeyReference) ([]byte, error) {
+	var secret corev1.Secret
+	name := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+	if err := r.apiReader.Get(ctx, name, &secret); err != nil {
+		return nil, fmt.Errorf("fetching kubeconfig Secret %s: %w", name, err)
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = DefaultKubeConfigKey
+	}
+	kubeConfig, ok := secret.Data[key]
+	if !ok || len(kubeConfig) == 0 {
+		return nil, fmt.Errorf("kubeconfig Secret %s has no %s key", name, key)
+	}
+
+	return kubeConfig, nil
+}
+
+// pruneRemotes disconnects from the remote clusters no longer targeted by an
+// AWSAuthTarget of targets.
+func (r *aggregateReconciler) pruneRemotes(ctx context.Context, targets []target) {
+	remote := map[string]bool{}
+	for _, t := range targets {
+		if t.kubeConfig != nil {
+			remote[t.name] = true
+		}
+	}
+
+	r.remotesMu.Lock()
+	defer r.remotesMu.Unlock()
+
+	for name, cluster := range r.remotes {
+		if !remote[name] {
+			cluster.stop()
+			delete(r.remotes, name)
+			log.FromContext(ctx).Info("disconnected from the remote cluster, no longer targeted", "target", name)
+		}
+	}
+}
+
+// stopRemotes disconnects from every remote cluster.
+func (r *AWSAuthItemReconciler) stopRemotes() {
+	r.remotesMu.Lock()
+	defer r.remotesMu.Unlock()
+
+	for name, cluster := range r.remotes {
+		cluster.stop()
+		delete(r.remotes, name)
+	}
+}
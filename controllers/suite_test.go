@@ -18,9 +18,13 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -30,6 +34,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -39,6 +44,7 @@ import (
 	"sigs.k8s.io/yaml"
 
 	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/render"
 )
 
 // These tests use Ginkgo (BDD-style Go testing framework). Refer to
@@ -51,8 +57,20 @@ var (
 	cancel       context.CancelFunc
 	reconciler   *AWSAuthItemReconciler
 	fakeRecorder *events.FakeRecorder
+
+	// apiRequests counts the requests sent by the manager to the API server.
+	apiRequests *requestCounter
+
+	// remoteEnv is the remote cluster of the AWSAuthTargets with a
+	// kubeconfig, remoteKubeConfig the kubeconfig of the controller on it.
+	remoteEnv        *envtest.Environment
+	remoteK8sClient  client.Client
+	remoteKubeConfig []byte
 )
 
+// lockoutRoleArn is the role the safety guards of the reconciler require.
+const lockoutRoleArn = "arn:aws:iam::111122223333:role/lockout-nodes"
+
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Controller Suite")
@@ -84,7 +102,24 @@ var _ = BeforeSuite(func(suiteCtx SpecContext) {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
-	k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
+	By("bootstrapping the remote cluster")
+	remoteEnv = &envtest.Environment{}
+	remoteCfg, err := remoteEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+
+	remoteK8sClient, err = client.New(remoteCfg, client.Options{Scheme: scheme.Scheme})
+	Expect(err).NotTo(HaveOccurred())
+
+	remoteUser, err := remoteEnv.AddUser(envtest.User{Name: "aws-auth-manager", Groups: []string{"system:masters"}}, nil)
+	Expect(err).NotTo(HaveOccurred())
+	remoteKubeConfig, err = remoteUser.KubeConfig()
+	Expect(err).NotTo(HaveOccurred())
+
+	apiRequests = &requestCounter{counts: map[string]int{}}
+	mgrCfg := rest.CopyConfig(cfg)
+	mgrCfg.Wrap(apiRequests.wrap)
+
+	k8sManager, err := ctrl.NewManager(mgrCfg, ctrl.Options{
 		Scheme: scheme.Scheme,
 	})
 	Expect(k8sManager).NotTo(BeNil())
@@ -99,6 +134,10 @@ var _ = BeforeSuite(func(suiteCtx SpecContext) {
 		Recorder:                  fakeRecorder,
 		AWSAuthConfigMapName:      "aws-auth-dryrun",
 		AWSAuthConfigMapNamespace: "kube-system",
+		ForceOwnership:            true,
+		AggregateDebounce:         200 * time.Millisecond,
+		SafetyGuards:              render.SafetyGuards{RequiredARNs: []string{lockoutRoleArn}},
+		RevisionHistoryLimit:      5,
 	}
 	err = reconciler.SetupWithManager(k8sManager)
 	Expect(err).NotTo(HaveOccurred())
@@ -115,6 +154,10 @@ var _ = AfterSuite(func() {
 	By("tearing down the test environment")
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
+	if remoteEnv != nil {
+		err = remoteEnv.Stop()
+		Expect(err).NotTo(HaveOccurred())
+	}
 })
 
 // Test timeout constants
@@ -176,6 +219,34 @@ func getMapUsersFromConfigMap(cm *corev1.ConfigMap) ([]awsauthv1alpha1.MapUserIt
 	return users, nil
 }
 
+// getMapAccountsFromConfigMap parses the mapAccounts data from a ConfigMap.
+func getMapAccountsFromConfigMap(cm *corev1.ConfigMap) ([]string, error) {
+	data, ok := cm.Data["mapAccounts"]
+	if !ok {
+		return nil, nil
+	}
+	if data == "" {
+		return nil, nil
+	}
+	var accounts []string
+	if err := yaml.Unmarshal([]byte(data), &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// annotateAWSAuthConfigMap sets the annotation key of the aws-auth ConfigMap to
+// value, or removes it when nil, with a merge patch.
+func annotateAWSAuthConfigMap(key string, value *string) {
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{
+		"annotations": map[string]*string{key: value},
+	}})
+	Expect(err).NotTo(HaveOccurred())
+	cm, err := getAWSAuthConfigMap()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(k8sClient.Patch(ctx, cm, client.RawPatch(types.MergePatchType, patch))).To(Succeed())
+}
+
 // drainEvents removes all events from the fake recorder's channel.
 // Call this before a test that needs to verify events to ensure a clean slate.
 func drainEvents() {
@@ -187,3 +258,75 @@ func drainEvents() {
 		}
 	}
 }
+
+// requestCounter counts the requests sent to the API server by method and
+// resource, such as "PATCH configmaps" or "PATCH awsauthitems/status".
+type requestCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// roundTripperFunc adapts a function to an http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// wrap returns rt counting its requests, to be used as a rest.Config wrapper.
+func (c *requestCounter) wrap(rt http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		c.mu.Lock()
+		c.counts[req.Method+" "+requestResource(req.URL.Path)]++
+		c.mu.Unlock()
+
+		return rt.RoundTrip(req)
+	})
+}
+
+// since returns the number of requests by method and resource sent after
+// snapshot was taken.
+func (c *requestCounter) since(snapshot map[string]int) map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := map[string]int{}
+	for key, count := range c.counts {
+		if delta := count - snapshot[key]; delta > 0 {
+			counts[key] = delta
+		}
+	}
+	return counts
+}
+
+// snapshot returns the number of requests sent so far by method and resource.
+func (c *requestCounter) snapshot() map[string]int {
+	return c.since(nil)
+}
+
+// requestResource returns the resource, and the subresource if any, of an
+// API server request path such as
+// /apis/aws.maruina.k8s/v1alpha1/namespaces/default/awsauthitems/foo/status.
+func requestResource(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		segments = segments[3:]
+	default:
+		return path
+	}
+	if len(segments) >= 3 && segments[0] == "namespaces" {
+		segments = segments[2:]
+	}
+
+	switch len(segments) {
+	case 0:
+		return ""
+	case 1, 2:
+		return segments[0]
+	default:
+		return segments[0] + "/" + segments[2]
+	}
+}
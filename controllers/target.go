@@ -0,0 +1,243 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/render"
+)
+
+//+kubebuilder:rbac:groups=aws.maruina.k8s,resources=awsauthtargets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=aws.maruina.k8s,resources=awsauthtargets/status,verbs=get;update;patch
+
+// target is a ConfigMap the mappings of the items it selects are rendered to:
+// the aws-auth ConfigMap of the controller, or the ConfigMap of an
+// AWSAuthTarget.
+type target struct {
+	// name is the AWSAuthTarget, empty for the aws-auth ConfigMap of the
+	// controller.
+	name      string
+	configMap types.NamespacedName
+
+	// keys are the data keys rendered from the mappings, every key when
+	// empty.
+	keys []string
+
+	// selector selects the items of an AWSAuthTarget, nil when its
+	// itemSelector is invalid.
+	selector labels.Selector
+
+	// selectorErr is set when the itemSelector of the AWSAuthTarget can't be
+	// parsed, so that the target selects no item and is not rendered.
+	selectorErr error
+
+	// kubeConfig is the kubeconfig Secret key of the remote cluster of the
+	// ConfigMap, nil for this cluster.
+	kubeConfig *awsauthv1alpha1.SecretKeyReference
+
+	// object is the AWSAuthTarget, whose status reports the rendering.
+	object *awsauthv1alpha1.AWSAuthTarget
+}
+
+// configMapKey identifies the ConfigMap of a target across clusters.
+type configMapKey struct {
+	cluster   string
+	configMap types.NamespacedName
+}
+
+// String returns the kind and name of the AWSAuthTarget of t, or the name of
+// the aws-auth ConfigMap.
+func (t target) String() string {
+	if t.name == "" {
+		return "aws-auth ConfigMap " + t.configMap.String()
+	}
+
+	return "AWSAuthTarget " + t.name
+}
+
+// cluster returns the namespace/name of the kubeconfig Secret of the remote
+// cluster of t, empty for this cluster.
+func (t target) cluster() string {
+	if t.kubeConfig == nil {
+		return ""
+	}
+
+	return t.kubeConfig.Namespace + "/" + t.kubeConfig.Name
+}
+
+// key returns the key of the ConfigMap of t.
+func (t target) key() configMapKey {
+	return configMapKey{cluster: t.cluster(), configMap: t.configMap}
+}
+
+// listTargets returns the aws-auth ConfigMap of the controller followed by the
+// AWSAuthTargets, sorted by name.
+func (r *AWSAuthItemReconciler) listTargets(ctx context.Context) ([]target, error) {
+	var targetList awsauthv1alpha1.AWSAuthTargetList
+	if err := r.List(ctx, &targetList); err != nil {
+		return nil, fmt.Errorf("listing AWSAuthTargets: %w", err)
+	}
+	sort.Slice(targetList.Items, func(a, b int) bool {
+		return targetList.Items[a].Name < targetList.Items[b].Name
+	})
+
+	targets := []target{{configMap: types.NamespacedName{
+		Name:      r.AWSAuthConfigMapName,
+		Namespace: r.AWSAuthConfigMapNamespace,
+	}}}
+	for i := range targetList.Items {
+		t := &targetList.Items[i]
+		// An invalid selector only fails its own target, so that the other
+		// ConfigMaps are still rendered
+		selector, selectorErr := t.Selector()
+		var kubeConfig *awsauthv1alpha1.SecretKeyReference
+		if t.Spec.KubeConfig != nil {
+			kubeConfig = &t.Spec.KubeConfig.SecretRef
+		}
+		targets = append(targets, target{
+			name: t.Name,
+			configMap: types.NamespacedName{
+				Name:      t.Spec.ConfigMap.Name,
+				Namespace: t.Spec.ConfigMap.Namespace,
+			},
+			keys:        t.Spec.Keys,
+			selector:    selector,
+			selectorErr: selectorErr,
+			kubeConfig:  kubeConfig,
+			object:      t,
+		})
+	}
+
+	return targets, nil
+}
+
+// routeItems returns the items rendered to every target: the items selected
+// by at least one AWSAuthTarget are rendered to the ConfigMaps of their
+// AWSAuthTargets, the others to the aws-auth ConfigMap of the controller,
+// the first target.
+func routeItems(targets []target, items []awsauthv1alpha1.Item) [][]awsauthv1alpha1.Item {
+	routed := make([][]awsauthv1alpha1.Item, len(targets))
+	for _, item := range items {
+		selected := false
+		for i, t := range targets[1:] {
+			if t.selector != nil && t.selector.Matches(labels.Set(item.GetLabels())) {
+				routed[i+1] = append(routed[i+1], item)
+				selected = true
+			}
+		}
+		if !selected {
+			routed[0] = append(routed[0], item)
+		}
+	}
+
+	return routed
+}
+
+// revisionNamespace returns the namespace of the revisions of the ConfigMap of
+// t: the namespace of the ConfigMap for an AWSAuthTarget, RevisionNamespace
+// for the aws-auth ConfigMap.
+func (r *AWSAuthItemReconciler) revisionNamespace(t target) string {
+	if t.name != "" || r.RevisionNamespace == "" {
+		return t.configMap.Namespace
+	}
+	return r.RevisionNamespace
+}
+
+// targetConfigMapField indexes the AWSAuthTargets of this cluster by the
+// namespace/name of their ConfigMap.
+const targetConfigMapField = ".spec.configMap"
+
+// indexTargetConfigMap returns the targetConfigMapField of obj, an
+// AWSAuthTarget. The ConfigMaps of the remote clusters are not indexed.
+func indexTargetConfigMap(obj client.Object) []string {
+	t := obj.(*awsauthv1alpha1.AWSAuthTarget)
+	if t.Spec.KubeConfig != nil {
+		return nil
+	}
+	return []string{types.NamespacedName{Name: t.Spec.ConfigMap.Name, Namespace: t.Spec.ConfigMap.Namespace}.String()}
+}
+
+// isTargetConfigMap reports whether obj is the aws-auth ConfigMap or the
+// ConfigMap of an AWSAuthTarget of this cluster. The ConfigMaps of the remote
+// clusters are watched by their own caches. When the AWSAuthTargets can't be
+// listed, obj is reported as a target ConfigMap, so that its drift is not
+// missed.
+func (r *AWSAuthItemReconciler) isTargetConfigMap(obj client.Object) bool {
+	if obj.GetName() == r.AWSAuthConfigMapName && obj.GetNamespace() == r.AWSAuthConfigMapNamespace {
+		return true
+	}
+
+	key := client.ObjectKeyFromObject(obj)
+	var targetList awsauthv1alpha1.AWSAuthTargetList
+	if err := r.List(context.Background(), &targetList, client.MatchingFields{targetConfigMapField: key.String()}); err != nil {
+		log.Log.Error(err, "listing the AWSAuthTargets of a ConfigMap", "configMap", key)
+		return true
+	}
+
+	return len(targetList.Items) > 0
+}
+
+// setTargetStatus records the outcome of the rendering of t in the status of
+// its AWSAuthTarget, and emits a warning event when the rendering fails with a
+// new reason or message.
+func (r *aggregateReconciler) setTargetStatus(ctx context.Context, t *targetResult) error {
+	object := t.target.object
+	if object == nil {
+		return nil
+	}
+
+	latest := object.DeepCopy()
+	switch {
+	case t.failure != nil:
+		ready := apimeta.FindStatusCondition(object.Status.Conditions, awsauthv1alpha1.ReadyCondition)
+		if ready == nil || ready.Reason != t.failure.reason || ready.Message != t.failure.err.Error() {
+			r.Recorder.Eventf(object, nil, corev1.EventTypeWarning, t.failure.reason,
+				t.failure.action, "%s: %s", t.failure.note, t.failure.err.Error())
+		}
+		latest.AWSAuthTargetNotReady(t.failure.reason, t.failure.err.Error())
+
+	case t.pinned != "":
+		latest.AWSAuthTargetNotReady(awsauthv1alpha1.PinnedRevisionReason,
+			fmt.Sprintf("ConfigMap is pinned to revision %s until the %s annotation is removed",
+				t.pinned, render.PinnedRevisionAnnotation))
+
+	default:
+		latest.AWSAuthTargetReady(t.message)
+	}
+	latest.Status.ObservedGeneration = object.Generation
+
+	if equality.Semantic.DeepEqual(object.Status, latest.Status) {
+		return nil
+	}
+	if err := r.Status().Patch(ctx, latest, client.MergeFrom(object)); err != nil {
+		return fmt.Errorf("patching status of %s: %w", t.target, err)
+	}
+
+	return nil
+}
@@ -17,15 +17,27 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 
 	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
 	"github.com/maruina/aws-auth-manager/controllers"
+	"github.com/maruina/aws-auth-manager/pkg/accessentry"
+	"github.com/maruina/aws-auth-manager/pkg/cli"
+	"github.com/maruina/aws-auth-manager/pkg/render"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -49,8 +61,32 @@ func init() {
 }
 
 func main() {
-	var metricsAddr, probeAddr, AWSAuthConfigMapName, AWSAuthConfigMapNamespace string
-	var enableLeaderElection bool
+	// Run a subcommand instead of the manager when one is given
+	if len(os.Args) > 1 {
+		if command, ok := cli.Commands[os.Args[1]]; ok {
+			err := command(context.Background(), os.Args[2:], os.Stdout)
+			if err == nil || errors.Is(err, flag.ErrHelp) {
+				return
+			}
+
+			code := 1
+			var exitErr *cli.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.Code
+			}
+			if exitErr == nil || exitErr.Err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			os.Exit(code)
+		}
+	}
+
+	var metricsAddr, probeAddr, AWSAuthConfigMapName, AWSAuthConfigMapNamespace, backend, EKSClusterName, conflictPolicy string
+	var configMapMode, driftPolicy, AWSPartition, AWSAccountID, revisionNamespace string
+	var enableLeaderElection, forceOwnership, dryRun bool
+	var aggregateDebounce, resyncInterval time.Duration
+	var revisionHistoryLimit, maxRemovalPercent int
+	var requiredGroups, requiredARNs string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -58,6 +94,46 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&AWSAuthConfigMapName, "aws-auth-configmap-name", "aws-auth", "The name of the aws-auth configmap.")
 	flag.StringVar(&AWSAuthConfigMapNamespace, "aws-auth-configmap-namespace", "kube-system", "The namespace of the aws-auth configmap.")
+	flag.StringVar(&backend, "backend", controllers.BackendConfigMap,
+		"Where to write the aggregated mappings. One of: configmap, access-entries, dual-write. "+
+			"Use dual-write to migrate from the aws-auth configmap to access entries.")
+	flag.StringVar(&EKSClusterName, "eks-cluster-name", "",
+		"The name of the EKS cluster, required by the access-entries and dual-write backends.")
+	flag.StringVar(&conflictPolicy, "conflict-policy", render.ConflictPolicyOldestWins,
+		"How to resolve an IAM ARN mapped by more than one AWSAuthItem. One of: oldest-wins, merge-groups, reject.")
+	flag.StringVar(&configMapMode, "configmap-mode", render.ConfigMapModeStrict,
+		"How to write the aws-auth configmap. One of: strict, to replace its whole content, "+
+			"or merge, to keep the entries not managed by any AWSAuthItem.")
+	flag.StringVar(&AWSPartition, "aws-partition", "",
+		"The AWS partition of the cluster, such as aws, aws-cn or aws-us-gov. "+
+			"When set, the webhooks reject the IAM ARNs of any other partition.")
+	flag.StringVar(&AWSAccountID, "aws-account-id", "",
+		"The AWS account ID of the cluster. When set, the webhooks warn about the IAM ARNs of any other account.")
+	flag.BoolVar(&forceOwnership, "force-ownership", true,
+		"Take over the fields of the aws-auth configmap managed by other field managers, such as eksctl or Terraform. "+
+			"The conflicts are reported either way, but the configmap is not written when false.")
+	flag.StringVar(&driftPolicy, "drift-policy", controllers.DriftPolicyCorrect,
+		"What to do when the aws-auth configmap is changed by another client since it was rendered: "+
+			"correct reverts the changes, report only reports them and stops writing the configmap until they are resolved.")
+	flag.DurationVar(&aggregateDebounce, "aggregate-debounce", controllers.DefaultAggregateDebounce,
+		"How long to wait after a change of the AWSAuthItems before rendering them, "+
+			"so that a burst of changes is written at once.")
+	flag.DurationVar(&resyncInterval, "resync-interval", 10*time.Minute,
+		"How often to render the AWSAuthItems again without any change, "+
+			"to verify the aws-auth configmap and refresh its last write metric. 0 disables the resync.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Compute the changes of the aws-auth configmap without writing them, "+
+			"and report them in the status of the AWSAuthItems and in events.")
+	flag.StringVar(&requiredGroups, "required-groups", "system:nodes,system:masters",
+		"Comma-separated groups whose last mapping can't be removed from the aws-auth configmap.")
+	flag.StringVar(&requiredARNs, "required-arns", "",
+		"Comma-separated IAM role and user ARNs whose mapping can't be removed from the aws-auth configmap.")
+	flag.IntVar(&maxRemovalPercent, "max-removal-percent", 0,
+		"The maximum percentage of the entries of the aws-auth configmap a single rendering can remove. 0 disables the check.")
+	flag.IntVar(&revisionHistoryLimit, "revision-history-limit", 10,
+		"The number of revisions of the aws-auth configmap to keep for rollbacks. 0 disables the revision history.")
+	flag.StringVar(&revisionNamespace, "revision-namespace", "",
+		"The namespace of the revisions of the aws-auth configmap. Defaults to the namespace of the aws-auth configmap.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -80,12 +156,87 @@ func main() {
 
 	// +kubebuilder:docs-gen:collapse=old stuff
 
+	var accessEntries controllers.AccessEntryBackend
+	switch backend {
+	case controllers.BackendConfigMap:
+	case controllers.BackendAccessEntries, controllers.BackendDualWrite:
+		if EKSClusterName == "" {
+			setupLog.Error(nil, "--eks-cluster-name is required by the access-entries and dual-write backends")
+			os.Exit(1)
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			setupLog.Error(err, "unable to load AWS configuration")
+			os.Exit(1)
+		}
+		accessEntries = &accessentry.Backend{
+			API:         eks.NewFromConfig(awsCfg),
+			ClusterName: EKSClusterName,
+		}
+	default:
+		setupLog.Error(nil, "unknown backend", "backend", backend)
+		os.Exit(1)
+	}
+
+	switch conflictPolicy {
+	case render.ConflictPolicyOldestWins, render.ConflictPolicyMergeGroups, render.ConflictPolicyReject:
+	default:
+		setupLog.Error(nil, "unknown conflict policy", "conflictPolicy", conflictPolicy)
+		os.Exit(1)
+	}
+
+	switch configMapMode {
+	case render.ConfigMapModeStrict, render.ConfigMapModeMerge:
+	default:
+		setupLog.Error(nil, "unknown configmap mode", "configMapMode", configMapMode)
+		os.Exit(1)
+	}
+
+	switch driftPolicy {
+	case controllers.DriftPolicyCorrect, controllers.DriftPolicyReport:
+	default:
+		setupLog.Error(nil, "unknown drift policy", "driftPolicy", driftPolicy)
+		os.Exit(1)
+	}
+
+	if AWSPartition != "" && !slices.Contains(awsauthv1alpha1.Partitions, AWSPartition) {
+		setupLog.Error(nil, "unknown AWS partition", "awsPartition", AWSPartition)
+		os.Exit(1)
+	}
+
+	if AWSAccountID != "" && !regexp.MustCompile(`^\d{12}$`).MatchString(AWSAccountID) {
+		setupLog.Error(nil, "invalid AWS account ID, must be 12 digits", "awsAccountID", AWSAccountID)
+		os.Exit(1)
+	}
+
+	if maxRemovalPercent < 0 || maxRemovalPercent > 100 {
+		setupLog.Error(nil, "invalid max removal percent, must be between 0 and 100", "maxRemovalPercent", maxRemovalPercent)
+		os.Exit(1)
+	}
+	safetyGuards := render.SafetyGuards{
+		RequiredGroups:    splitList(requiredGroups),
+		RequiredARNs:      splitList(requiredARNs),
+		MaxRemovalPercent: maxRemovalPercent,
+	}
+
 	if err = (&controllers.AWSAuthItemReconciler{
 		Client:                    mgr.GetClient(),
 		Scheme:                    mgr.GetScheme(),
 		Recorder:                  mgr.GetEventRecorder("awsauthitem-controller"),
 		AWSAuthConfigMapName:      AWSAuthConfigMapName,
 		AWSAuthConfigMapNamespace: AWSAuthConfigMapNamespace,
+		Backend:                   backend,
+		AccessEntries:             accessEntries,
+		ConflictPolicy:            conflictPolicy,
+		ConfigMapMode:             configMapMode,
+		ForceOwnership:            forceOwnership,
+		DriftPolicy:               driftPolicy,
+		AggregateDebounce:         aggregateDebounce,
+		ResyncInterval:            resyncInterval,
+		DryRun:                    dryRun,
+		SafetyGuards:              safetyGuards,
+		RevisionHistoryLimit:      revisionHistoryLimit,
+		RevisionNamespace:         revisionNamespace,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AWSAuthItem")
 		os.Exit(1)
@@ -100,10 +251,15 @@ func main() {
 		We'll just make sure to set `ENABLE_WEBHOOKS=false` when we run locally.
 	*/
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err = (&awsauthv1alpha1.AWSAuthItem{}).SetupWebhookWithManager(mgr); err != nil {
+		webhookOpts := awsauthv1alpha1.WebhookOptions{Partition: AWSPartition, AccountID: AWSAccountID}
+		if err = (&awsauthv1alpha1.AWSAuthItem{}).SetupWebhookWithManager(mgr, webhookOpts); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "AWSAuthItem")
 			os.Exit(1)
 		}
+		if err = (&awsauthv1alpha1.ClusterAWSAuthItem{}).SetupWebhookWithManager(mgr, webhookOpts); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterAWSAuthItem")
+			os.Exit(1)
+		}
 	}
 	//+kubebuilder:scaffold:builder
 
@@ -122,3 +278,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList returns the non-empty elements of a comma-separated list.
+func splitList(list string) []string {
+	var elements []string
+	for _, element := range strings.Split(list, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
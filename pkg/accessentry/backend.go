@@ -0,0 +1,235 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accessentry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+)
+
+// StandardType is the access entry type used for every managed entry.
+const StandardType = "STANDARD"
+
+// EKSAPI is the subset of the EKS API used to manage access entries.
+// It is satisfied by *eks.Client and can be replaced by a fake in tests.
+type EKSAPI interface {
+	ListAccessEntries(ctx context.Context, params *eks.ListAccessEntriesInput, optFns ...func(*eks.Options)) (*eks.ListAccessEntriesOutput, error)
+	DescribeAccessEntry(ctx context.Context, params *eks.DescribeAccessEntryInput, optFns ...func(*eks.Options)) (*eks.DescribeAccessEntryOutput, error)
+	CreateAccessEntry(ctx context.Context, params *eks.CreateAccessEntryInput, optFns ...func(*eks.Options)) (*eks.CreateAccessEntryOutput, error)
+	UpdateAccessEntry(ctx context.Context, params *eks.UpdateAccessEntryInput, optFns ...func(*eks.Options)) (*eks.UpdateAccessEntryOutput, error)
+	DeleteAccessEntry(ctx context.Context, params *eks.DeleteAccessEntryInput, optFns ...func(*eks.Options)) (*eks.DeleteAccessEntryOutput, error)
+	ListAssociatedAccessPolicies(ctx context.Context, params *eks.ListAssociatedAccessPoliciesInput, optFns ...func(*eks.Options)) (*eks.ListAssociatedAccessPoliciesOutput, error)
+	AssociateAccessPolicy(ctx context.Context, params *eks.AssociateAccessPolicyInput, optFns ...func(*eks.Options)) (*eks.AssociateAccessPolicyOutput, error)
+	DisassociateAccessPolicy(ctx context.Context, params *eks.DisassociateAccessPolicyInput, optFns ...func(*eks.Options)) (*eks.DisassociateAccessPolicyOutput, error)
+}
+
+// Backend reconciles the access entries of a single EKS cluster. Only entries
+// tagged with awsauthv1alpha1.AWSAuthAnnotationKey are updated or deleted, so
+// entries created by EKS or other tools are left untouched.
+type Backend struct {
+	API         EKSAPI
+	ClusterName string
+}
+
+// Apply makes the managed access entries of the cluster match entries.
+// It keeps going after a failure and returns all the errors joined together.
+func (b *Backend) Apply(ctx context.Context, entries []Entry) error {
+	log := log.FromContext(ctx).WithValues("cluster", b.ClusterName)
+
+	existing, err := b.listAccessEntries(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	desired := map[string]bool{}
+	for _, entry := range entries {
+		desired[entry.PrincipalARN] = true
+
+		current, ok := existing[entry.PrincipalARN]
+		switch {
+		case !ok:
+			log.Info("creating access entry", "principalArn", entry.PrincipalARN)
+			errs = append(errs, b.createAccessEntry(ctx, entry))
+		case !isManaged(current):
+			log.Info("skipping access entry not managed by aws-auth-manager", "principalArn", entry.PrincipalARN)
+		default:
+			errs = append(errs, b.updateAccessEntry(ctx, entry, current))
+		}
+	}
+
+	for principalARN, current := range existing {
+		if desired[principalARN] || !isManaged(current) {
+			continue
+		}
+
+		log.Info("deleting access entry", "principalArn", principalARN)
+		_, err := b.API.DeleteAccessEntry(ctx, &eks.DeleteAccessEntryInput{
+			ClusterName:  aws.String(b.ClusterName),
+			PrincipalArn: aws.String(principalARN),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deleting access entry %s: %w", principalARN, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// listAccessEntries returns all the access entries of the cluster keyed by principal ARN.
+func (b *Backend) listAccessEntries(ctx context.Context) (map[string]*ekstypes.AccessEntry, error) {
+	entries := map[string]*ekstypes.AccessEntry{}
+
+	input := &eks.ListAccessEntriesInput{ClusterName: aws.String(b.ClusterName)}
+	for {
+		out, err := b.API.ListAccessEntries(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("listing access entries: %w", err)
+		}
+
+		for _, principalARN := range out.AccessEntries {
+			desc, err := b.API.DescribeAccessEntry(ctx, &eks.DescribeAccessEntryInput{
+				ClusterName:  aws.String(b.ClusterName),
+				PrincipalArn: aws.String(principalARN),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("describing access entry %s: %w", principalARN, err)
+			}
+			entries[principalARN] = desc.AccessEntry
+		}
+
+		if aws.ToString(out.NextToken) == "" {
+			return entries, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+func (b *Backend) createAccessEntry(ctx context.Context, entry Entry) error {
+	_, err := b.API.CreateAccessEntry(ctx, &eks.CreateAccessEntryInput{
+		ClusterName:      aws.String(b.ClusterName),
+		PrincipalArn:     aws.String(entry.PrincipalARN),
+		Type:             aws.String(StandardType),
+		Username:         aws.String(entry.Username),
+		KubernetesGroups: entry.KubernetesGroups,
+		Tags: map[string]string{
+			awsauthv1alpha1.AWSAuthAnnotationKey: awsauthv1alpha1.AWSAuthAnnotationValue,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating access entry %s: %w", entry.PrincipalARN, err)
+	}
+
+	return b.reconcilePolicies(ctx, entry)
+}
+
+func (b *Backend) updateAccessEntry(ctx context.Context, entry Entry, current *ekstypes.AccessEntry) error {
+	if aws.ToString(current.Username) != entry.Username || !sameElements(current.KubernetesGroups, entry.KubernetesGroups) {
+		log.FromContext(ctx).Info("updating access entry", "cluster", b.ClusterName, "principalArn", entry.PrincipalARN)
+		_, err := b.API.UpdateAccessEntry(ctx, &eks.UpdateAccessEntryInput{
+			ClusterName:      aws.String(b.ClusterName),
+			PrincipalArn:     aws.String(entry.PrincipalARN),
+			Username:         aws.String(entry.Username),
+			KubernetesGroups: entry.KubernetesGroups,
+		})
+		if err != nil {
+			return fmt.Errorf("updating access entry %s: %w", entry.PrincipalARN, err)
+		}
+	}
+
+	return b.reconcilePolicies(ctx, entry)
+}
+
+// reconcilePolicies associates the cluster-scoped access policies of entry and
+// disassociates every other policy.
+func (b *Backend) reconcilePolicies(ctx context.Context, entry Entry) error {
+	var associated []string
+	input := &eks.ListAssociatedAccessPoliciesInput{
+		ClusterName:  aws.String(b.ClusterName),
+		PrincipalArn: aws.String(entry.PrincipalARN),
+	}
+	for {
+		out, err := b.API.ListAssociatedAccessPolicies(ctx, input)
+		if err != nil {
+			return fmt.Errorf("listing access policies of %s: %w", entry.PrincipalARN, err)
+		}
+		for _, policy := range out.AssociatedAccessPolicies {
+			associated = append(associated, aws.ToString(policy.PolicyArn))
+		}
+		if aws.ToString(out.NextToken) == "" {
+			break
+		}
+		input.NextToken = out.NextToken
+	}
+
+	for _, policyARN := range entry.PolicyARNs {
+		if slices.Contains(associated, policyARN) {
+			continue
+		}
+		_, err := b.API.AssociateAccessPolicy(ctx, &eks.AssociateAccessPolicyInput{
+			ClusterName:  aws.String(b.ClusterName),
+			PrincipalArn: aws.String(entry.PrincipalARN),
+			PolicyArn:    aws.String(policyARN),
+			AccessScope:  &ekstypes.AccessScope{Type: ekstypes.AccessScopeTypeCluster},
+		})
+		if err != nil {
+			return fmt.Errorf("associating access policy %s to %s: %w", policyARN, entry.PrincipalARN, err)
+		}
+	}
+
+	for _, policyARN := range associated {
+		if slices.Contains(entry.PolicyARNs, policyARN) {
+			continue
+		}
+		_, err := b.API.DisassociateAccessPolicy(ctx, &eks.DisassociateAccessPolicyInput{
+			ClusterName:  aws.String(b.ClusterName),
+			PrincipalArn: aws.String(entry.PrincipalARN),
+			PolicyArn:    aws.String(policyARN),
+		})
+		if err != nil {
+			return fmt.Errorf("disassociating access policy %s from %s: %w", policyARN, entry.PrincipalARN, err)
+		}
+	}
+
+	return nil
+}
+
+// isManaged reports whether the access entry was created by aws-auth-manager.
+func isManaged(entry *ekstypes.AccessEntry) bool {
+	return entry != nil && entry.Tags[awsauthv1alpha1.AWSAuthAnnotationKey] == awsauthv1alpha1.AWSAuthAnnotationValue
+}
+
+// sameElements reports whether a and b hold the same strings, ignoring order.
+func sameElements(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	sortedA := slices.Sorted(slices.Values(a))
+	sortedB := slices.Sorted(slices.Values(b))
+
+	return slices.Equal(sortedA, sortedB)
+}
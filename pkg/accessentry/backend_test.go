@@ -0,0 +1,121 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accessentry_test
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/accessentry"
+)
+
+var _ = Describe("Backend", func() {
+	var (
+		ctx     context.Context
+		api     *fakeEKS
+		backend *accessentry.Backend
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		api = newFakeEKS()
+		backend = &accessentry.Backend{API: api, ClusterName: "test"}
+	})
+
+	It("should create missing access entries and associate policies", func() {
+		Expect(backend.Apply(ctx, []accessentry.Entry{{
+			PrincipalARN:     "arn:aws:iam::111122223333:role/admin",
+			Username:         "admin",
+			KubernetesGroups: []string{"ops"},
+			PolicyARNs:       []string{accessentry.ClusterAdminPolicyARN},
+		}})).To(Succeed())
+
+		entry := api.entries["arn:aws:iam::111122223333:role/admin"]
+		Expect(entry).NotTo(BeNil())
+		Expect(aws.ToString(entry.Username)).To(Equal("admin"))
+		Expect(aws.ToString(entry.Type)).To(Equal(accessentry.StandardType))
+		Expect(entry.KubernetesGroups).To(ConsistOf("ops"))
+		Expect(entry.Tags).To(HaveKeyWithValue(awsauthv1alpha1.AWSAuthAnnotationKey, awsauthv1alpha1.AWSAuthAnnotationValue))
+		Expect(api.policies["arn:aws:iam::111122223333:role/admin"]).To(ConsistOf(accessentry.ClusterAdminPolicyARN))
+	})
+
+	It("should update managed access entries that drifted", func() {
+		Expect(backend.Apply(ctx, []accessentry.Entry{{
+			PrincipalARN:     "arn:aws:iam::111122223333:role/dev",
+			Username:         "dev",
+			KubernetesGroups: []string{"view"},
+			PolicyARNs:       []string{accessentry.ClusterAdminPolicyARN},
+		}})).To(Succeed())
+
+		Expect(backend.Apply(ctx, []accessentry.Entry{{
+			PrincipalARN:     "arn:aws:iam::111122223333:role/dev",
+			Username:         "developer",
+			KubernetesGroups: []string{"edit"},
+		}})).To(Succeed())
+
+		entry := api.entries["arn:aws:iam::111122223333:role/dev"]
+		Expect(aws.ToString(entry.Username)).To(Equal("developer"))
+		Expect(entry.KubernetesGroups).To(ConsistOf("edit"))
+		Expect(api.policies["arn:aws:iam::111122223333:role/dev"]).To(BeEmpty())
+	})
+
+	It("should not call UpdateAccessEntry when nothing changed", func() {
+		entries := []accessentry.Entry{{
+			PrincipalARN:     "arn:aws:iam::111122223333:role/dev",
+			Username:         "dev",
+			KubernetesGroups: []string{"view", "edit"},
+		}}
+		Expect(backend.Apply(ctx, entries)).To(Succeed())
+		api.calls = nil
+
+		entries[0].KubernetesGroups = []string{"edit", "view"}
+		Expect(backend.Apply(ctx, entries)).To(Succeed())
+		Expect(api.calls).NotTo(ContainElement("UpdateAccessEntry"))
+		Expect(api.calls).NotTo(ContainElement("CreateAccessEntry"))
+	})
+
+	It("should delete managed access entries that are no longer desired", func() {
+		Expect(backend.Apply(ctx, []accessentry.Entry{{
+			PrincipalARN: "arn:aws:iam::111122223333:user/old",
+			Username:     "old",
+		}})).To(Succeed())
+
+		Expect(backend.Apply(ctx, nil)).To(Succeed())
+		Expect(api.entries).NotTo(HaveKey("arn:aws:iam::111122223333:user/old"))
+	})
+
+	It("should leave access entries it does not manage untouched", func() {
+		api.entries["arn:aws:iam::111122223333:role/creator"] = &ekstypes.AccessEntry{
+			PrincipalArn: aws.String("arn:aws:iam::111122223333:role/creator"),
+			Username:     aws.String("creator"),
+		}
+
+		Expect(backend.Apply(ctx, []accessentry.Entry{{
+			PrincipalARN: "arn:aws:iam::111122223333:role/creator",
+			Username:     "someone-else",
+		}})).To(Succeed())
+		Expect(aws.ToString(api.entries["arn:aws:iam::111122223333:role/creator"].Username)).To(Equal("creator"))
+
+		Expect(backend.Apply(ctx, nil)).To(Succeed())
+		Expect(api.entries).To(HaveKey("arn:aws:iam::111122223333:role/creator"))
+	})
+})
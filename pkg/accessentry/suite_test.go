@@ -0,0 +1,131 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accessentry_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/maruina/aws-auth-manager/pkg/accessentry"
+)
+
+func TestAccessEntry(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "AccessEntry Suite")
+}
+
+// fakeEKS is an in-memory implementation of EKSAPI for a single cluster.
+type fakeEKS struct {
+	entries  map[string]*ekstypes.AccessEntry
+	policies map[string][]string
+	calls    []string
+}
+
+var _ accessentry.EKSAPI = &fakeEKS{}
+
+func newFakeEKS() *fakeEKS {
+	return &fakeEKS{
+		entries:  map[string]*ekstypes.AccessEntry{},
+		policies: map[string][]string{},
+	}
+}
+
+func (f *fakeEKS) ListAccessEntries(_ context.Context, _ *eks.ListAccessEntriesInput, _ ...func(*eks.Options)) (*eks.ListAccessEntriesOutput, error) {
+	f.calls = append(f.calls, "ListAccessEntries")
+	var arns []string
+	for arn := range f.entries {
+		arns = append(arns, arn)
+	}
+	slices.Sort(arns)
+	return &eks.ListAccessEntriesOutput{AccessEntries: arns}, nil
+}
+
+func (f *fakeEKS) DescribeAccessEntry(_ context.Context, in *eks.DescribeAccessEntryInput, _ ...func(*eks.Options)) (*eks.DescribeAccessEntryOutput, error) {
+	f.calls = append(f.calls, "DescribeAccessEntry")
+	entry, ok := f.entries[aws.ToString(in.PrincipalArn)]
+	if !ok {
+		return nil, &ekstypes.ResourceNotFoundException{Message: aws.String("not found")}
+	}
+	return &eks.DescribeAccessEntryOutput{AccessEntry: entry}, nil
+}
+
+func (f *fakeEKS) CreateAccessEntry(_ context.Context, in *eks.CreateAccessEntryInput, _ ...func(*eks.Options)) (*eks.CreateAccessEntryOutput, error) {
+	f.calls = append(f.calls, "CreateAccessEntry")
+	arn := aws.ToString(in.PrincipalArn)
+	if _, ok := f.entries[arn]; ok {
+		return nil, &ekstypes.ResourceInUseException{Message: aws.String(fmt.Sprintf("%s already exists", arn))}
+	}
+	f.entries[arn] = &ekstypes.AccessEntry{
+		PrincipalArn:     in.PrincipalArn,
+		Username:         in.Username,
+		KubernetesGroups: in.KubernetesGroups,
+		Type:             in.Type,
+		Tags:             in.Tags,
+	}
+	return &eks.CreateAccessEntryOutput{AccessEntry: f.entries[arn]}, nil
+}
+
+func (f *fakeEKS) UpdateAccessEntry(_ context.Context, in *eks.UpdateAccessEntryInput, _ ...func(*eks.Options)) (*eks.UpdateAccessEntryOutput, error) {
+	f.calls = append(f.calls, "UpdateAccessEntry")
+	entry, ok := f.entries[aws.ToString(in.PrincipalArn)]
+	if !ok {
+		return nil, &ekstypes.ResourceNotFoundException{Message: aws.String("not found")}
+	}
+	entry.Username = in.Username
+	entry.KubernetesGroups = in.KubernetesGroups
+	return &eks.UpdateAccessEntryOutput{AccessEntry: entry}, nil
+}
+
+func (f *fakeEKS) DeleteAccessEntry(_ context.Context, in *eks.DeleteAccessEntryInput, _ ...func(*eks.Options)) (*eks.DeleteAccessEntryOutput, error) {
+	f.calls = append(f.calls, "DeleteAccessEntry")
+	delete(f.entries, aws.ToString(in.PrincipalArn))
+	delete(f.policies, aws.ToString(in.PrincipalArn))
+	return &eks.DeleteAccessEntryOutput{}, nil
+}
+
+func (f *fakeEKS) ListAssociatedAccessPolicies(_ context.Context, in *eks.ListAssociatedAccessPoliciesInput, _ ...func(*eks.Options)) (*eks.ListAssociatedAccessPoliciesOutput, error) {
+	f.calls = append(f.calls, "ListAssociatedAccessPolicies")
+	var policies []ekstypes.AssociatedAccessPolicy
+	for _, policyARN := range f.policies[aws.ToString(in.PrincipalArn)] {
+		policies = append(policies, ekstypes.AssociatedAccessPolicy{PolicyArn: aws.String(policyARN)})
+	}
+	return &eks.ListAssociatedAccessPoliciesOutput{AssociatedAccessPolicies: policies}, nil
+}
+
+func (f *fakeEKS) AssociateAccessPolicy(_ context.Context, in *eks.AssociateAccessPolicyInput, _ ...func(*eks.Options)) (*eks.AssociateAccessPolicyOutput, error) {
+	f.calls = append(f.calls, "AssociateAccessPolicy")
+	arn := aws.ToString(in.PrincipalArn)
+	f.policies[arn] = append(f.policies[arn], aws.ToString(in.PolicyArn))
+	return &eks.AssociateAccessPolicyOutput{}, nil
+}
+
+func (f *fakeEKS) DisassociateAccessPolicy(_ context.Context, in *eks.DisassociateAccessPolicyInput, _ ...func(*eks.Options)) (*eks.DisassociateAccessPolicyOutput, error) {
+	f.calls = append(f.calls, "DisassociateAccessPolicy")
+	arn := aws.ToString(in.PrincipalArn)
+	f.policies[arn] = slices.DeleteFunc(f.policies[arn], func(p string) bool {
+		return p == aws.ToString(in.PolicyArn)
+	})
+	return &eks.DisassociateAccessPolicyOutput{}, nil
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package accessentry translates aws-auth mappings into EKS access entries
+// and reconciles them against the EKS API.
+package accessentry
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+)
+
+// ClusterAdminPolicyARN is the EKS access policy granting cluster-admin, in
+// the aws partition. The policies of a principal in another partition are
+// moved to the partition of the principal.
+const ClusterAdminPolicyARN = "arn:aws:eks::aws:cluster-access-policy/AmazonEKSClusterAdminPolicy"
+
+// WellKnownGroupPolicies maps reserved Kubernetes groups, which access entries
+// cannot carry as kubernetesGroups, to the equivalent EKS access policy.
+var WellKnownGroupPolicies = map[string]string{
+	"system:masters": ClusterAdminPolicyARN,
+}
+
+// reservedPrefixes are the username and group prefixes rejected by EKS.
+var reservedPrefixes = []string{"system:", "eks:", "aws:", "amazon:", "iam:"}
+
+// templateRegexp matches a username template placeholder such as {{SessionName}}.
+var templateRegexp = regexp.MustCompile(`{{[^}]*}}`)
+
+// supportedTemplates are the placeholders EKS expands in access entry usernames.
+var supportedTemplates = []string{"{{SessionName}}", "{{SessionNameRaw}}"}
+
+// Entry is the desired state of a single EKS access entry.
+type Entry struct {
+	// PrincipalARN is the IAM role or user ARN of the access entry.
+	PrincipalARN string
+
+	// Username is the Kubernetes username of the access entry.
+	Username string
+
+	// KubernetesGroups are the Kubernetes groups of the access entry.
+	KubernetesGroups []string
+
+	// PolicyARNs are the access policies associated with cluster scope.
+	PolicyARNs []string
+}
+
+// Unsupported describes a mapping that cannot be expressed as an access entry.
+type Unsupported struct {
+	// PrincipalARN is the IAM role or user ARN of the mapping, or the account
+	// ID for mapAccounts.
+	PrincipalARN string
+
+	// Reason explains why the mapping cannot be translated.
+	Reason string
+}
+
+// Translate converts aws-auth role and user mappings into access entries.
+// Mappings that cannot be expressed as access entries, including every mapped
+// account, are returned separately and are not part of the entries. When the
+// same principal is mapped more than once, the first mapping wins.
+func Translate(roles []awsauthv1alpha1.MapRoleItem, users []awsauthv1alpha1.MapUserItem, accounts []string) ([]Entry, []Unsupported) {
+	var entries []Entry
+	var unsupported []Unsupported
+	seen := map[string]bool{}
+
+	add := func(principalARN, username string, groups []string) {
+		if seen[principalARN] {
+			unsupported = append(unsupported, Unsupported{
+				PrincipalARN: principalARN,
+				Reason:       "principal is mapped more than once",
+			})
+			return
+		}
+
+		// The first mapping wins even when it can't be translated, as in the
+		// aws-auth ConfigMap
+		seen[principalARN] = true
+		entry, reason := translateMapping(principalARN, username, groups)
+		if reason != "" {
+			unsupported = append(unsupported, Unsupported{PrincipalARN: principalARN, Reason: reason})
+			return
+		}
+
+		entries = append(entries, entry)
+	}
+
+	for _, role := range roles {
+		add(role.RoleArn, role.Username, role.Groups)
+	}
+	for _, user := range users {
+		add(user.UserArn, user.Username, user.Groups)
+	}
+	for _, account := range accounts {
+		unsupported = append(unsupported, Unsupported{
+			PrincipalARN: account,
+			Reason:       "mapAccounts has no access entries equivalent",
+		})
+	}
+
+	return entries, unsupported
+}
+
+// translateMapping converts a single mapping, returning a non-empty reason when
+// the mapping cannot be expressed as an access entry.
+func translateMapping(principalARN, username string, groups []string) (Entry, string) {
+	for _, placeholder := range templateRegexp.FindAllString(username, -1) {
+		if !slices.Contains(supportedTemplates, placeholder) {
+			return Entry{}, fmt.Sprintf("username template %s is not supported by access entries", placeholder)
+		}
+	}
+
+	if prefix := reservedPrefix(username); prefix != "" {
+		return Entry{}, fmt.Sprintf("username %q uses the reserved prefix %q", username, prefix)
+	}
+
+	entry := Entry{PrincipalARN: principalARN, Username: username}
+	for _, group := range groups {
+		if policyARN, ok := WellKnownGroupPolicies[group]; ok {
+			policyARN = inPartitionOf(policyARN, principalARN)
+			if !slices.Contains(entry.PolicyARNs, policyARN) {
+				entry.PolicyARNs = append(entry.PolicyARNs, policyARN)
+			}
+			continue
+		}
+
+		if prefix := reservedPrefix(group); prefix != "" {
+			return Entry{}, fmt.Sprintf("group %q uses the reserved prefix %q", group, prefix)
+		}
+
+		entry.KubernetesGroups = append(entry.KubernetesGroups, group)
+	}
+
+	return entry, ""
+}
+
+// inPartitionOf returns policyARN in the partition of principalARN.
+func inPartitionOf(policyARN, principalARN string) string {
+	principal, err := arn.Parse(principalARN)
+	if err != nil {
+		return policyARN
+	}
+	policy, err := arn.Parse(policyARN)
+	if err != nil {
+		return policyARN
+	}
+	policy.Partition = principal.Partition
+
+	return policy.String()
+}
+
+// reservedPrefix returns the reserved prefix s starts with, if any.
+func reservedPrefix(s string) string {
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return prefix
+		}
+	}
+
+	return ""
+}
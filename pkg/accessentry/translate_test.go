@@ -0,0 +1,162 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accessentry_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/accessentry"
+)
+
+var _ = Describe("Translate", func() {
+	It("should translate roles and users into standard access entries", func() {
+		entries, unsupported := accessentry.Translate(
+			[]awsauthv1alpha1.MapRoleItem{{
+				RoleArn:  "arn:aws:iam::111122223333:role/dev",
+				Username: "dev:{{SessionName}}",
+				Groups:   []string{"edit", "view"},
+			}},
+			[]awsauthv1alpha1.MapUserItem{{
+				UserArn:  "arn:aws:iam::111122223333:user/ci",
+				Username: "ci",
+				Groups:   []string{"deployers"},
+			}},
+			nil,
+		)
+
+		Expect(unsupported).To(BeEmpty())
+		Expect(entries).To(Equal([]accessentry.Entry{
+			{
+				PrincipalARN:     "arn:aws:iam::111122223333:role/dev",
+				Username:         "dev:{{SessionName}}",
+				KubernetesGroups: []string{"edit", "view"},
+			},
+			{
+				PrincipalARN:     "arn:aws:iam::111122223333:user/ci",
+				Username:         "ci",
+				KubernetesGroups: []string{"deployers"},
+			},
+		}))
+	})
+
+	It("should map system:masters to the cluster admin access policy", func() {
+		entries, unsupported := accessentry.Translate([]awsauthv1alpha1.MapRoleItem{{
+			RoleArn:  "arn:aws:iam::111122223333:role/admin",
+			Username: "admin",
+			Groups:   []string{"system:masters", "ops"},
+		}}, nil, nil)
+
+		Expect(unsupported).To(BeEmpty())
+		Expect(entries).To(ConsistOf(accessentry.Entry{
+			PrincipalARN:     "arn:aws:iam::111122223333:role/admin",
+			Username:         "admin",
+			KubernetesGroups: []string{"ops"},
+			PolicyARNs:       []string{accessentry.ClusterAdminPolicyARN},
+		}))
+	})
+
+	It("should map system:masters to the access policy in the partition of the principal", func() {
+		entries, unsupported := accessentry.Translate([]awsauthv1alpha1.MapRoleItem{{
+			RoleArn:  "arn:aws-us-gov:iam::111122223333:role/admin",
+			Username: "admin",
+			Groups:   []string{"system:masters"},
+		}}, nil, nil)
+
+		Expect(unsupported).To(BeEmpty())
+		Expect(entries).To(ConsistOf(accessentry.Entry{
+			PrincipalARN: "arn:aws-us-gov:iam::111122223333:role/admin",
+			Username:     "admin",
+			PolicyARNs:   []string{"arn:aws-us-gov:eks::aws:cluster-access-policy/AmazonEKSClusterAdminPolicy"},
+		}))
+	})
+
+	DescribeTable("should report mappings that cannot be expressed as access entries",
+		func(roles []awsauthv1alpha1.MapRoleItem, reasons ...string) {
+			entries, unsupported := accessentry.Translate(roles, nil, nil)
+
+			expected := make([]accessentry.Unsupported, len(reasons))
+			for i, reason := range reasons {
+				expected[i] = accessentry.Unsupported{PrincipalARN: roles[i].RoleArn, Reason: reason}
+			}
+			Expect(entries).To(BeEmpty())
+			Expect(unsupported).To(Equal(expected))
+		},
+		Entry("templated node username",
+			[]awsauthv1alpha1.MapRoleItem{{
+				RoleArn:  "arn:aws:iam::111122223333:role/node",
+				Username: "system:node:{{EC2PrivateDNSName}}",
+				Groups:   []string{"system:bootstrappers", "system:nodes"},
+			}},
+			"username template {{EC2PrivateDNSName}} is not supported by access entries",
+		),
+		Entry("reserved username prefix",
+			[]awsauthv1alpha1.MapRoleItem{{
+				RoleArn:  "arn:aws:iam::111122223333:role/eks",
+				Username: "eks:operator",
+				Groups:   []string{"ops"},
+			}},
+			`username "eks:operator" uses the reserved prefix "eks:"`,
+		),
+		Entry("reserved group without access policy",
+			[]awsauthv1alpha1.MapRoleItem{{
+				RoleArn:  "arn:aws:iam::111122223333:role/bootstrap",
+				Username: "bootstrap",
+				Groups:   []string{"system:bootstrappers"},
+			}},
+			`group "system:bootstrappers" uses the reserved prefix "system:"`,
+		),
+		Entry("duplicate of an unsupported first mapping",
+			[]awsauthv1alpha1.MapRoleItem{
+				{
+					RoleArn:  "arn:aws:iam::111122223333:role/node",
+					Username: "system:node:{{EC2PrivateDNSName}}",
+					Groups:   []string{"system:bootstrappers", "system:nodes"},
+				},
+				{
+					RoleArn:  "arn:aws:iam::111122223333:role/node",
+					Username: "node",
+					Groups:   []string{"nodes"},
+				},
+			},
+			"username template {{EC2PrivateDNSName}} is not supported by access entries",
+			"principal is mapped more than once",
+		),
+	)
+
+	It("should keep the first mapping of a duplicated principal", func() {
+		entries, unsupported := accessentry.Translate([]awsauthv1alpha1.MapRoleItem{
+			{RoleArn: "arn:aws:iam::111122223333:role/dup", Username: "first", Groups: []string{"a"}},
+			{RoleArn: "arn:aws:iam::111122223333:role/dup", Username: "second", Groups: []string{"b"}},
+		}, nil, nil)
+
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Username).To(Equal("first"))
+		Expect(unsupported).To(HaveLen(1))
+	})
+
+	It("should report mapped accounts as unsupported", func() {
+		entries, unsupported := accessentry.Translate(nil, nil, []string{"444455556666"})
+
+		Expect(entries).To(BeEmpty())
+		Expect(unsupported).To(ConsistOf(accessentry.Unsupported{
+			PrincipalARN: "444455556666",
+			Reason:       "mapAccounts has no access entries equivalent",
+		}))
+	})
+})
@@ -0,0 +1,135 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cli implements the subcommands of the aws-auth-manager binary, run
+// instead of the manager when the first argument is a known command.
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// Command runs a subcommand with its arguments, writing its output to stdout.
+type Command func(ctx context.Context, args []string, stdout io.Writer) error
+
+// Commands are the subcommands of the aws-auth-manager binary, by name.
+var Commands = map[string]Command{
+	"diff":     Diff,
+	"history":  History,
+	"import":   Import,
+	"release":  Release,
+	"render":   Render,
+	"rollback": Rollback,
+}
+
+// ExitError is returned by a command to exit with a specific status. Err,
+// when set, is printed before exiting.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// configMapSource locates an aws-auth ConfigMap in a file or in a cluster.
+type configMapSource struct {
+	file       string
+	kubeconfig string
+	context    string
+	name       string
+	namespace  string
+}
+
+// bindFlags registers the flags locating the aws-auth ConfigMap on fs.
+func (s *configMapSource) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.file, "file", "", "Read the aws-auth configmap from a YAML file instead of the cluster.")
+	s.bindClusterFlags(fs)
+}
+
+// bindClusterFlags registers the flags locating the aws-auth ConfigMap in a
+// cluster on fs.
+func (s *configMapSource) bindClusterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file. Defaults to $KUBECONFIG or ~/.kube/config.")
+	fs.StringVar(&s.context, "context", "", "The kubeconfig context to use.")
+	fs.StringVar(&s.name, "aws-auth-configmap-name", "aws-auth", "The name of the aws-auth configmap.")
+	fs.StringVar(&s.namespace, "aws-auth-configmap-namespace", "kube-system", "The namespace of the aws-auth configmap.")
+}
+
+// load reads the aws-auth ConfigMap from the file, when set, or from the cluster.
+func (s configMapSource) load(ctx context.Context) (*corev1.ConfigMap, error) {
+	var cm corev1.ConfigMap
+
+	if s.file != "" {
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", s.file, err)
+		}
+		if err := yaml.Unmarshal(data, &cm); err != nil {
+			return nil, fmt.Errorf("unmarshaling %s: %w", s.file, err)
+		}
+
+		return &cm, nil
+	}
+
+	c, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Get(ctx, types.NamespacedName{Name: s.name, Namespace: s.namespace}, &cm); err != nil {
+		return nil, fmt.Errorf("getting ConfigMap %s/%s: %w", s.namespace, s.name, err)
+	}
+
+	return &cm, nil
+}
+
+// client returns a client for the cluster of the kubeconfig and context.
+func (s configMapSource) client() (client.Client, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = s.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: s.context}
+
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+
+	c, err := client.New(cfg, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+
+	return c, nil
+}
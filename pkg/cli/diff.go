@@ -0,0 +1,114 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/maruina/aws-auth-manager/pkg/render"
+)
+
+// Exit statuses of the diff command, following diff(1).
+const (
+	// DiffExitNoChanges is returned when the live ConfigMap is up to date.
+	DiffExitNoChanges = 0
+
+	// DiffExitChanges is returned when applying the manifests changes the live ConfigMap.
+	DiffExitChanges = 1
+
+	// DiffExitError is returned when the diff could not be computed.
+	DiffExitError = 2
+)
+
+// Diff compares the aws-auth ConfigMap rendered from a directory of
+// AWSAuthItem manifests with the live one, entry by entry. It exits with
+// DiffExitChanges when they differ.
+func Diff(ctx context.Context, args []string, stdout io.Writer) error {
+	if err := diff(ctx, args, stdout); err != nil {
+		var exitErr *ExitError
+		if errors.Is(err, flag.ErrHelp) || errors.As(err, &exitErr) {
+			return err
+		}
+
+		return &ExitError{Code: DiffExitError, Err: err}
+	}
+
+	return nil
+}
+
+func diff(ctx context.Context, args []string, stdout io.Writer) error {
+	var opts renderOptions
+
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [flags] DIR\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "AWSAuthItems without namespace are rendered in the default namespace. "+
+			"Only the AWSAuthPolicies and AWSAuthTargets of DIR are applied.")
+		fs.PrintDefaults()
+	}
+	opts.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("diff takes exactly one directory, got %d arguments", fs.NArg())
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	// A missing aws-auth ConfigMap is created empty by the controller
+	live, err := opts.source.load(ctx)
+	if apierrors.IsNotFound(err) {
+		live, err = render.NewConfigMap(opts.source.name, opts.source.namespace), nil
+	}
+	if err != nil {
+		return err
+	}
+
+	desired, err := opts.render(fs.Arg(0), live, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	changes, err := render.Diff(live, desired)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(stdout, "No changes.")
+		return nil
+	}
+
+	counts := map[string]int{}
+	for _, change := range changes {
+		fmt.Fprintln(stdout, change)
+		counts[change.Type]++
+	}
+	fmt.Fprintf(stdout, "\n%d to add, %d to change, %d to remove.\n",
+		counts[render.ChangeAdded], counts[render.ChangeModified], counts[render.ChangeRemoved])
+
+	return &ExitError{Code: DiffExitChanges}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/maruina/aws-auth-manager/pkg/importer"
+)
+
+// Import generates AWSAuthItem manifests from an existing aws-auth ConfigMap.
+func Import(ctx context.Context, args []string, stdout io.Writer) error {
+	var source configMapSource
+	var opts importer.Options
+	var output string
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	source.bindFlags(fs)
+	fs.StringVar(&opts.Name, "name", "aws-auth", "The name of the AWSAuthItem, or the prefix of the names when splitting.")
+	fs.StringVar(&opts.Namespace, "namespace", "", "The namespace of the generated AWSAuthItems.")
+	fs.StringVar(&opts.Split, "split", importer.SplitNone,
+		"How to split the mappings into AWSAuthItems. One of: none, account, group.")
+	fs.StringVar(&output, "output", "", "Write the manifests to a file instead of stdout.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cm, err := source.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	items, err := importer.Import(cm, opts)
+	if err != nil {
+		return fmt.Errorf("importing aws-auth ConfigMap: %w", err)
+	}
+
+	return writeOutput(output, stdout, func(w io.Writer) error {
+		return importer.WriteYAML(w, items)
+	})
+}
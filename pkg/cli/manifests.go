@@ -0,0 +1,258 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/render"
+)
+
+// DefaultNamespace is the namespace of the AWSAuthItem manifests without
+// one, as when applied with kubectl to the default namespace.
+const DefaultNamespace = "default"
+
+// manifests are the objects of a directory of manifests the rendering of the
+// aws-auth ConfigMap depends on.
+type manifests struct {
+	items    []awsauthv1alpha1.Item
+	policies []awsauthv1alpha1.AWSAuthPolicy
+	targets  []awsauthv1alpha1.AWSAuthTarget
+
+	// namespaceLabels are the labels of the Namespaces, by name.
+	namespaceLabels map[string]map[string]string
+}
+
+// readManifests returns the AWSAuthItems, ClusterAWSAuthItems,
+// AWSAuthPolicies, AWSAuthTargets and Namespaces of the YAML and JSON
+// manifests found in dir and its subdirectories. Documents of any other kind
+// are ignored. The AWSAuthItems without namespace are in DefaultNamespace.
+// The role ARNs of every item are normalized and every item must pass the
+// validation, as by the webhooks, with the IAM ARNs in partition when it is
+// not empty.
+func readManifests(dir, partition string) (*manifests, error) {
+	m := &manifests{namespaceLabels: map[string]map[string]string{}}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		return m.read(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, item := range m.items {
+		if item, ok := item.(*awsauthv1alpha1.AWSAuthItem); ok && item.Namespace == "" {
+			item.Namespace = DefaultNamespace
+		}
+		awsauthv1alpha1.NormalizeRoleARNs(item.GetSpec())
+		if err := item.Validate(partition); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// read adds the objects of a multi-document manifest to m.
+func (m *manifests) read(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		var typeMeta metav1.TypeMeta
+		if err := yaml.Unmarshal(doc, &typeMeta); err != nil {
+			return fmt.Errorf("unmarshaling %s: %w", path, err)
+		}
+
+		var obj any
+		switch typeMeta.GroupVersionKind() {
+		case awsauthv1alpha1.GroupVersion.WithKind("AWSAuthItem"):
+			obj = &awsauthv1alpha1.AWSAuthItem{}
+		case awsauthv1alpha1.GroupVersion.WithKind("ClusterAWSAuthItem"):
+			obj = &awsauthv1alpha1.ClusterAWSAuthItem{}
+		case awsauthv1alpha1.GroupVersion.WithKind("AWSAuthPolicy"):
+			obj = &awsauthv1alpha1.AWSAuthPolicy{}
+		case awsauthv1alpha1.GroupVersion.WithKind("AWSAuthTarget"):
+			obj = &awsauthv1alpha1.AWSAuthTarget{}
+		case corev1.SchemeGroupVersion.WithKind("Namespace"):
+			obj = &corev1.Namespace{}
+		default:
+			continue
+		}
+		if err := yaml.UnmarshalStrict(doc, obj); err != nil {
+			return fmt.Errorf("unmarshaling %s in %s: %w", typeMeta.Kind, path, err)
+		}
+
+		switch obj := obj.(type) {
+		case awsauthv1alpha1.Item:
+			m.items = append(m.items, obj)
+		case *awsauthv1alpha1.AWSAuthPolicy:
+			m.policies = append(m.policies, *obj)
+		case *awsauthv1alpha1.AWSAuthTarget:
+			m.targets = append(m.targets, *obj)
+		case *corev1.Namespace:
+			m.namespaceLabels[obj.Name] = obj.Labels
+		}
+	}
+}
+
+// awsAuthItems returns the items rendered to the aws-auth ConfigMap, as by the
+// controller: the items selected by an AWSAuthTarget are left out, and the
+// mappings of an AWSAuthItem not allowed by the AWSAuthPolicies selecting its
+// namespace are removed. A namespace without manifest has no labels. Both are
+// reported to stderr.
+func (m *manifests) awsAuthItems(stderr io.Writer) ([]awsauthv1alpha1.Item, error) {
+	selectors := make([]labels.Selector, len(m.targets))
+	for i := range m.targets {
+		selector, err := m.targets[i].Selector()
+		if err != nil {
+			fmt.Fprintf(stderr, "warning: AWSAuthTarget %s: %s, selecting no item\n", m.targets[i].Name, err)
+			continue
+		}
+		selectors[i] = selector
+	}
+
+	var items []awsauthv1alpha1.Item
+	policies := map[string][]awsauthv1alpha1.AWSAuthPolicy{}
+	for _, item := range m.items {
+		key := client.ObjectKeyFromObject(item)
+
+		var targets []string
+		for i, selector := range selectors {
+			if selector != nil && selector.Matches(labels.Set(item.GetLabels())) {
+				targets = append(targets, m.targets[i].Name)
+			}
+		}
+		if len(targets) > 0 {
+			fmt.Fprintf(stderr, "warning: %s: rendered to AWSAuthTarget %s instead\n",
+				render.ItemName(key), strings.Join(targets, ", "))
+			continue
+		}
+
+		namespaced, ok := item.(*awsauthv1alpha1.AWSAuthItem)
+		if !ok || len(m.policies) == 0 || !namespaced.DeletionTimestamp.IsZero() {
+			items = append(items, item)
+			continue
+		}
+
+		nsPolicies, ok := policies[namespaced.Namespace]
+		if !ok {
+			var err error
+			if nsPolicies, err = awsauthv1alpha1.SelectPolicies(m.policies, m.namespaceLabels[namespaced.Namespace]); err != nil {
+				return nil, err
+			}
+			policies[namespaced.Namespace] = nsPolicies
+		}
+
+		allowed, errs := awsauthv1alpha1.EnforcePolicies(nsPolicies, &namespaced.Spec)
+		if len(errs) > 0 {
+			fmt.Fprintf(stderr, "warning: %s: mappings not allowed by AWSAuthPolicies are excluded: %s\n",
+				render.ItemName(key), errs.ToAggregate())
+			namespaced.Spec = allowed
+		}
+		items = append(items, namespaced)
+	}
+
+	return items, nil
+}
+
+// writeConfigMap writes cm to w as a YAML manifest.
+func writeConfigMap(w io.Writer, cm *corev1.ConfigMap) error {
+	cm = cm.DeepCopy()
+	cm.APIVersion = corev1.SchemeGroupVersion.String()
+	cm.Kind = "ConfigMap"
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cm)
+	if err != nil {
+		return fmt.Errorf("converting ConfigMap %s: %w", cm.Name, err)
+	}
+	unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("marshaling ConfigMap %s: %w", cm.Name, err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("writing ConfigMap %s: %w", cm.Name, err)
+	}
+
+	return nil
+}
+
+// writeOutput calls write with stdout, or with the file at path when set.
+func writeOutput(path string, stdout io.Writer, write func(io.Writer) error) error {
+	if path == "" {
+		return write(stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/render"
+)
+
+// renderOptions configures how local AWSAuthItem manifests are rendered.
+type renderOptions struct {
+	source         configMapSource
+	conflictPolicy string
+	configMapMode  string
+	partition      string
+}
+
+// bindFlags registers the rendering flags on fs.
+func (o *renderOptions) bindFlags(fs *flag.FlagSet) {
+	o.source.bindFlags(fs)
+	fs.StringVar(&o.conflictPolicy, "conflict-policy", render.ConflictPolicyOldestWins,
+		"How to resolve an IAM ARN mapped by more than one AWSAuthItem. One of: oldest-wins, merge-groups, reject.")
+	fs.StringVar(&o.configMapMode, "configmap-mode", render.ConfigMapModeStrict,
+		"How to render the aws-auth configmap. One of: strict, or merge, to keep the entries of the "+
+			"current configmap not managed by any AWSAuthItem.")
+	fs.StringVar(&o.partition, "aws-partition", "",
+		"The AWS partition of the cluster, such as aws, aws-cn or aws-us-gov. "+
+			"When set, the IAM ARNs of any other partition are rejected.")
+}
+
+// validate returns an error when a rendering flag has an unknown value.
+func (o *renderOptions) validate() error {
+	switch o.conflictPolicy {
+	case render.ConflictPolicyOldestWins, render.ConflictPolicyMergeGroups, render.ConflictPolicyReject:
+	default:
+		return fmt.Errorf("unknown conflict policy %q", o.conflictPolicy)
+	}
+
+	switch o.configMapMode {
+	case render.ConfigMapModeStrict, render.ConfigMapModeMerge:
+	default:
+		return fmt.Errorf("unknown configmap mode %q", o.configMapMode)
+	}
+
+	if o.partition != "" && !slices.Contains(awsauthv1alpha1.Partitions, o.partition) {
+		return fmt.Errorf("unknown AWS partition %q", o.partition)
+	}
+
+	return nil
+}
+
+// render returns the aws-auth ConfigMap the controller would write for the
+// manifests in dir. current is the ConfigMap in the cluster and is only used,
+// and required, in merge mode. The conflicts between the items, and the items
+// and mappings left out by the AWSAuthTargets and AWSAuthPolicies of the
+// manifests, are reported to stderr.
+func (o *renderOptions) render(dir string, current *corev1.ConfigMap, stderr io.Writer) (*corev1.ConfigMap, error) {
+	m, err := readManifests(dir, o.partition)
+	if err != nil {
+		return nil, err
+	}
+	items, err := m.awsAuthItems(stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	agg := render.Aggregate(items, o.conflictPolicy)
+	for _, item := range items {
+		key := client.ObjectKeyFromObject(item)
+		if conflicts := agg.ConflictsOf(key); len(conflicts) > 0 {
+			fmt.Fprintf(stderr, "warning: %s: %s\n", render.ItemName(key),
+				render.ConflictMessage(conflicts, o.conflictPolicy))
+		}
+	}
+
+	cm := render.NewConfigMap(o.source.name, o.source.namespace)
+	if o.configMapMode == render.ConfigMapModeMerge {
+		cm = current.DeepCopy()
+	}
+	if err := render.ConfigMap(cm, agg, o.configMapMode); err != nil {
+		return nil, fmt.Errorf("rendering aws-auth ConfigMap: %w", err)
+	}
+
+	return cm, nil
+}
+
+// Render prints the aws-auth ConfigMap the controller would write for a
+// directory of AWSAuthItem manifests, without a cluster. The AWSAuthPolicies
+// and AWSAuthTargets of the directory are applied, but not the ones only in
+// the cluster.
+func Render(ctx context.Context, args []string, stdout io.Writer) error {
+	var opts renderOptions
+	var output string
+
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s render [flags] DIR\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "AWSAuthItems without namespace are rendered in the default namespace. "+
+			"Only the AWSAuthPolicies and AWSAuthTargets of DIR are applied.")
+		fs.PrintDefaults()
+	}
+	opts.bindFlags(fs)
+	fs.StringVar(&output, "output", "", "Write the configmap to a file instead of stdout.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("render takes exactly one directory, got %d arguments", fs.NArg())
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	var current *corev1.ConfigMap
+	if opts.configMapMode == render.ConfigMapModeMerge {
+		var err error
+		if current, err = opts.source.load(ctx); err != nil {
+			return err
+		}
+	}
+
+	cm, err := opts.render(fs.Arg(0), current, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(output, stdout, func(w io.Writer) error {
+		return writeConfigMap(w, cm)
+	})
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/maruina/aws-auth-manager/pkg/render"
+)
+
+// revisionOptions locate the aws-auth ConfigMap and its revisions in a cluster.
+type revisionOptions struct {
+	source    configMapSource
+	namespace string
+}
+
+// bindFlags registers the flags locating the revisions on fs.
+func (o *revisionOptions) bindFlags(fs *flag.FlagSet) {
+	o.source.bindClusterFlags(fs)
+	fs.StringVar(&o.namespace, "revision-namespace", "",
+		"The namespace of the revisions. Defaults to the namespace of the aws-auth configmap.")
+}
+
+// revisionNamespace returns the namespace of the revisions.
+func (o revisionOptions) revisionNamespace() string {
+	if o.namespace == "" {
+		return o.source.namespace
+	}
+	return o.namespace
+}
+
+// parse parses args, which must hold exactly nargs positional arguments.
+func (o *revisionOptions) parse(name, usage string, nargs int, args []string) (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags]%s\n", os.Args[0], name, usage)
+		fs.PrintDefaults()
+	}
+	o.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", name, nargs, fs.NArg())
+	}
+
+	return fs, nil
+}
+
+// History lists the revisions of the aws-auth ConfigMap recorded by the
+// controller, from the most recent, marking the one it is pinned to.
+func History(ctx context.Context, args []string, stdout io.Writer) error {
+	var opts revisionOptions
+	if _, err := opts.parse("history", "", 0, args); err != nil {
+		return err
+	}
+
+	c, err := opts.source.client()
+	if err != nil {
+		return err
+	}
+	cm, err := opts.source.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	var revisions corev1.ConfigMapList
+	if err := c.List(ctx, &revisions, client.InNamespace(opts.revisionNamespace()),
+		client.MatchingLabels{render.RevisionLabel: cm.Name}); err != nil {
+		return fmt.Errorf("listing revisions: %w", err)
+	}
+	render.SortRevisions(revisions.Items)
+
+	pinned := cm.Annotations[render.PinnedRevisionAnnotation]
+	current := render.RevisionHash(cm)
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tRENDERED AT\tHASH\tITEMS\tSTATUS")
+	for i := range revisions.Items {
+		revision, err := render.ParseRevision(&revisions.Items[i])
+		if err != nil {
+			return err
+		}
+
+		var status string
+		switch {
+		case revision.Name == pinned:
+			status = "pinned"
+		case revision.Hash == current:
+			status = "live"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.10s\t%d\t%s\n", revision.Name, revision.RenderedAt.Format(time.RFC3339),
+			revision.Hash, len(revision.Items), status)
+	}
+
+	return w.Flush()
+}
+
+// Rollback pins the aws-auth ConfigMap to a revision: the controller writes
+// its mappings instead of the mappings of the AWSAuthItems until released.
+func Rollback(ctx context.Context, args []string, stdout io.Writer) error {
+	var opts revisionOptions
+	fs, err := opts.parse("rollback", " REVISION", 1, args)
+	if err != nil {
+		return err
+	}
+	name := fs.Arg(0)
+
+	c, err := opts.source.client()
+	if err != nil {
+		return err
+	}
+
+	var revision corev1.ConfigMap
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: opts.revisionNamespace()}, &revision); err != nil {
+		return fmt.Errorf("getting revision %s: %w", name, err)
+	}
+	if revision.Labels[render.RevisionLabel] != opts.source.name {
+		return fmt.Errorf("%s is not a revision of the %s configmap", name, opts.source.name)
+	}
+
+	if err := opts.pin(ctx, c, &name); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "ConfigMap %s/%s pinned to revision %s.\n", opts.source.namespace, opts.source.name, name)
+
+	return nil
+}
+
+// Release removes the revision pin of the aws-auth ConfigMap, so that the
+// controller writes the mappings of the AWSAuthItems again.
+func Release(ctx context.Context, args []string, stdout io.Writer) error {
+	var opts revisionOptions
+	if _, err := opts.parse("release", "", 0, args); err != nil {
+		return err
+	}
+
+	c, err := opts.source.client()
+	if err != nil {
+		return err
+	}
+
+	if err := opts.pin(ctx, c, nil); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "ConfigMap %s/%s released.\n", opts.source.namespace, opts.source.name)
+
+	return nil
+}
+
+// pin sets the PinnedRevisionAnnotation of the aws-auth ConfigMap to
+// revision, or removes it when nil, with a merge patch.
+func (o revisionOptions) pin(ctx context.Context, c client.Client, revision *string) error {
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]*string{render.PinnedRevisionAnnotation: revision},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{}
+	cm.Name, cm.Namespace = o.source.name, o.source.namespace
+	if err := c.Patch(ctx, cm, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return fmt.Errorf("patching ConfigMap %s/%s: %w", o.source.namespace, o.source.name, err)
+	}
+
+	return nil
+}
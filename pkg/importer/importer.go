@@ -0,0 +1,203 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package importer converts an existing aws-auth ConfigMap into AWSAuthItem
+// objects, to onboard a cluster to aws-auth-manager.
+package importer
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+	"github.com/maruina/aws-auth-manager/pkg/render"
+)
+
+// Ways to split the mappings of the aws-auth ConfigMap into AWSAuthItems.
+const (
+	// SplitNone puts all the mappings in a single AWSAuthItem.
+	SplitNone = "none"
+
+	// SplitAccount creates an AWSAuthItem per AWS account ID.
+	SplitAccount = "account"
+
+	// SplitGroup creates an AWSAuthItem per Kubernetes group, using the first
+	// group of every mapping.
+	SplitGroup = "group"
+)
+
+const (
+	// ungroupedKey is the split key of the mappings without groups.
+	ungroupedKey = "ungrouped"
+
+	// accountsKey is the split key of mapAccounts when splitting by group.
+	accountsKey = "accounts"
+)
+
+// invalidNameChars matches the characters not allowed in an object name.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Options configures how the AWSAuthItems are generated.
+type Options struct {
+	// Name is the name of the AWSAuthItem, or the prefix of the names when
+	// the mappings are split.
+	Name string
+
+	// Namespace is the namespace of the AWSAuthItems. Left empty, the
+	// AWSAuthItems are created in the namespace of the kubectl context.
+	Namespace string
+
+	// Split selects how the mappings are split into AWSAuthItems. Defaults to
+	// SplitNone when empty.
+	Split string
+}
+
+// Import converts the mappings of an aws-auth ConfigMap into AWSAuthItems,
+// sorted by name.
+func Import(cm *corev1.ConfigMap, opts Options) ([]awsauthv1alpha1.AWSAuthItem, error) {
+	switch opts.Split {
+	case "", SplitNone, SplitAccount, SplitGroup:
+	default:
+		return nil, fmt.Errorf("unknown split %q", opts.Split)
+	}
+
+	parsed, err := render.ParseConfigMap(cm)
+	if err != nil {
+		return nil, err
+	}
+
+	items := map[string]*awsauthv1alpha1.AWSAuthItem{}
+	itemFor := func(key string) *awsauthv1alpha1.AWSAuthItem {
+		name := itemName(opts.Name, key)
+		if _, ok := items[name]; !ok {
+			items[name] = &awsauthv1alpha1.AWSAuthItem{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: opts.Namespace},
+			}
+		}
+
+		return items[name]
+	}
+
+	for _, role := range parsed.MapRoles {
+		key, err := splitKey(opts.Split, role.RoleArn, role.Groups)
+		if err != nil {
+			return nil, err
+		}
+		item := itemFor(key)
+		item.Spec.MapRoles = append(item.Spec.MapRoles, role)
+	}
+
+	for _, user := range parsed.MapUsers {
+		key, err := splitKey(opts.Split, user.UserArn, user.Groups)
+		if err != nil {
+			return nil, err
+		}
+		item := itemFor(key)
+		item.Spec.MapUsers = append(item.Spec.MapUsers, user)
+	}
+
+	for _, account := range parsed.MapAccounts {
+		var key string
+		switch opts.Split {
+		case SplitAccount:
+			key = account
+		case SplitGroup:
+			key = accountsKey
+		}
+		item := itemFor(key)
+		item.Spec.MapAccounts = append(item.Spec.MapAccounts, account)
+	}
+
+	result := make([]awsauthv1alpha1.AWSAuthItem, 0, len(items))
+	for _, item := range items {
+		result = append(result, *item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// WriteYAML writes items to w as a multi-document YAML stream, ready to be
+// applied with kubectl.
+func WriteYAML(w io.Writer, items []awsauthv1alpha1.AWSAuthItem) error {
+	for _, item := range items {
+		item.APIVersion = awsauthv1alpha1.GroupVersion.String()
+		item.Kind = "AWSAuthItem"
+
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&item)
+		if err != nil {
+			return fmt.Errorf("converting AWSAuthItem %s: %w", item.Name, err)
+		}
+		unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+		unstructured.RemoveNestedField(obj, "status")
+
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("marshaling AWSAuthItem %s: %w", item.Name, err)
+		}
+
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return fmt.Errorf("writing AWSAuthItem %s: %w", item.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// splitKey returns the key of the AWSAuthItem a mapping belongs to.
+func splitKey(split, arn string, groups []string) (string, error) {
+	switch split {
+	case "", SplitNone:
+		return "", nil
+	case SplitAccount:
+		// arn:partition:iam::account-id:resource
+		parts := strings.SplitN(arn, ":", 6)
+		if len(parts) != 6 || parts[4] == "" {
+			return "", fmt.Errorf("parsing account ID of %q", arn)
+		}
+
+		return parts[4], nil
+	case SplitGroup:
+		if len(groups) == 0 {
+			return ungroupedKey, nil
+		}
+
+		return groups[0], nil
+	default:
+		return "", fmt.Errorf("unknown split %q", split)
+	}
+}
+
+// itemName returns the name of the AWSAuthItem holding the mappings of key.
+func itemName(prefix, key string) string {
+	if key == "" {
+		return prefix
+	}
+	suffix := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(key), "-"), "-")
+
+	return prefix + "-" + suffix
+}
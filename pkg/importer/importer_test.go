@@ -0,0 +1,126 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package importer
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+)
+
+var _ = Describe("Import", func() {
+	var cm *corev1.ConfigMap
+
+	BeforeEach(func() {
+		cm = &corev1.ConfigMap{
+			Data: map[string]string{
+				"mapRoles": `- rolearn: arn:aws:iam::111122223333:role/nodes
+  username: system:node:{{EC2PrivateDNSName}}
+  groups:
+    - system:bootstrappers
+    - system:nodes
+- rolearn: arn:aws:iam::444455556666:role/admin
+  username: admin
+  groups:
+    - system:masters
+`,
+				"mapUsers": `- userarn: arn:aws:iam::111122223333:user/ops
+  username: ops
+  groups:
+    - system:masters
+`,
+				"mapAccounts": `- "777788889999"
+`,
+			},
+		}
+	})
+
+	It("should put all the mappings in a single item by default", func() {
+		items, err := Import(cm, Options{Name: "imported", Namespace: "kube-system"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items).To(HaveLen(1))
+		Expect(items[0].Name).To(Equal("imported"))
+		Expect(items[0].Namespace).To(Equal("kube-system"))
+		Expect(items[0].Spec.MapRoles).To(HaveLen(2))
+		Expect(items[0].Spec.MapUsers).To(Equal([]awsauthv1alpha1.MapUserItem{{
+			UserArn:  "arn:aws:iam::111122223333:user/ops",
+			Username: "ops",
+			Groups:   []string{"system:masters"},
+		}}))
+		Expect(items[0].Spec.MapAccounts).To(Equal([]string{"777788889999"}))
+	})
+
+	It("should split the mappings by account ID", func() {
+		items, err := Import(cm, Options{Name: "imported", Split: SplitAccount})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items).To(HaveLen(3))
+		Expect(items[0].Name).To(Equal("imported-111122223333"))
+		Expect(items[0].Spec.MapRoles).To(HaveLen(1))
+		Expect(items[0].Spec.MapUsers).To(HaveLen(1))
+		Expect(items[1].Name).To(Equal("imported-444455556666"))
+		Expect(items[1].Spec.MapRoles).To(HaveLen(1))
+		Expect(items[2].Name).To(Equal("imported-777788889999"))
+		Expect(items[2].Spec.MapAccounts).To(Equal([]string{"777788889999"}))
+	})
+
+	It("should split the mappings by their first group", func() {
+		items, err := Import(cm, Options{Name: "imported", Split: SplitGroup})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items).To(HaveLen(3))
+		Expect(items[0].Name).To(Equal("imported-accounts"))
+		Expect(items[1].Name).To(Equal("imported-system-bootstrappers"))
+		Expect(items[2].Name).To(Equal("imported-system-masters"))
+		Expect(items[2].Spec.MapRoles).To(HaveLen(1))
+		Expect(items[2].Spec.MapUsers).To(HaveLen(1))
+	})
+
+	It("should fail on an unknown split", func() {
+		_, err := Import(cm, Options{Name: "imported", Split: "region"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail on a malformed ConfigMap", func() {
+		cm.Data["mapRoles"] = "not: a list"
+		_, err := Import(cm, Options{Name: "imported"})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("WriteYAML", func() {
+	It("should write ready-to-apply manifests", func() {
+		items, err := Import(&corev1.ConfigMap{Data: map[string]string{
+			"mapAccounts": `- "777788889999"`,
+		}}, Options{Name: "accounts"})
+		Expect(err).NotTo(HaveOccurred())
+
+		var buf bytes.Buffer
+		Expect(WriteYAML(&buf, items)).To(Succeed())
+		Expect(buf.String()).To(Equal(`---
+apiVersion: aws.maruina.k8s/v1alpha1
+kind: AWSAuthItem
+metadata:
+  name: accounts
+spec:
+  mapAccounts:
+  - "777788889999"
+`))
+	})
+})
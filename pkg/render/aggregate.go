@@ -0,0 +1,394 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render builds the aws-auth ConfigMap from AWSAuthItems. It is shared
+// by the controller and the offline commands, so that both render the same
+// mappings.
+package render
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+)
+
+// Policies to resolve an IAM ARN mapped by more than one item. ClusterAWSAuthItems
+// rank before AWSAuthItems, then items are ranked by creation timestamp,
+// namespace and name, and the first item always keeps its mapping.
+const (
+	// ConflictPolicyOldestWins keeps the mapping of the oldest item and drops
+	// the conflicting mappings of the other items.
+	ConflictPolicyOldestWins = "oldest-wins"
+
+	// ConflictPolicyMergeGroups keeps the username of the oldest item and
+	// merges the groups of all the conflicting mappings.
+	ConflictPolicyMergeGroups = "merge-groups"
+
+	// ConflictPolicyReject drops every mapping of an item that conflicts with
+	// an older item.
+	ConflictPolicyReject = "reject"
+)
+
+// Conflict records an IAM ARN mapped by more than one item.
+type Conflict struct {
+	// ARN is the IAM role or user ARN mapped more than once.
+	ARN string
+
+	// Winner is the item whose mapping is kept.
+	Winner client.ObjectKey
+
+	// Loser is the item whose mapping is dropped or merged.
+	Loser client.ObjectKey
+}
+
+// Aggregation holds the mappings of all the items after conflicts
+// have been resolved.
+type Aggregation struct {
+	MapRoles    []awsauthv1alpha1.MapRoleItem
+	MapUsers    []awsauthv1alpha1.MapUserItem
+	MapAccounts []string
+
+	// Conflicts are the ARNs mapped by more than one item.
+	Conflicts []Conflict
+
+	// Rejected are the items dropped by ConflictPolicyReject.
+	Rejected map[client.ObjectKey]bool
+
+	// Owners are the items whose mappings are kept, by ARN and account ID.
+	// An account mapped by several items is owned by the first one.
+	Owners map[string]client.ObjectKey
+}
+
+// Aggregate returns the mappings of all the items, skipping the items that are
+// being deleted and resolving duplicated ARNs according to policy. Suspended
+// items keep contributing their mappings: suspending an item only stops its
+// own reconciliation.
+//
+// The mappings are sorted by the namespace and name of the item owning them,
+// then by ARN, with sorted groups, and the accounts are sorted, so that the
+// same items always render the same aws-auth ConfigMap whatever their order.
+func Aggregate(items []awsauthv1alpha1.Item, policy string) Aggregation {
+	agg := Aggregation{Rejected: map[client.ObjectKey]bool{}}
+
+	var ranked []awsauthv1alpha1.Item
+	for _, i := range items {
+		if i.GetDeletionTimestamp().IsZero() {
+			ranked = append(ranked, i)
+		}
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return ranksBefore(ranked[a], ranked[b])
+	})
+
+	// owners and positions track, for every ARN, the item that owns it and
+	// its index in mapRoles or mapUsers.
+	owners := map[string]client.ObjectKey{}
+	positions := map[string]int{}
+	accounts := map[string]bool{}
+
+	for _, i := range ranked {
+		key := client.ObjectKeyFromObject(i)
+		spec := i.GetSpec()
+
+		if policy == ConflictPolicyReject {
+			var conflicts []Conflict
+			for _, arn := range itemARNs(spec) {
+				if owner, ok := owners[arn]; ok && owner != key {
+					conflicts = append(conflicts, Conflict{ARN: arn, Winner: owner, Loser: key})
+				}
+			}
+			if len(conflicts) > 0 {
+				agg.Conflicts = append(agg.Conflicts, conflicts...)
+				agg.Rejected[key] = true
+				continue
+			}
+		}
+
+		for _, role := range spec.MapRoles {
+			owner, ok := owners[role.RoleArn]
+			switch {
+			case !ok:
+				owners[role.RoleArn] = key
+				positions[role.RoleArn] = len(agg.MapRoles)
+				agg.MapRoles = append(agg.MapRoles, role)
+				continue
+			case owner != key:
+				agg.Conflicts = append(agg.Conflicts, Conflict{ARN: role.RoleArn, Winner: owner, Loser: key})
+			}
+			if policy == ConflictPolicyMergeGroups {
+				merged := &agg.MapRoles[positions[role.RoleArn]]
+				merged.Groups = mergeGroups(merged.Groups, role.Groups)
+			}
+		}
+
+		for _, user := range spec.MapUsers {
+			owner, ok := owners[user.UserArn]
+			switch {
+			case !ok:
+				owners[user.UserArn] = key
+				positions[user.UserArn] = len(agg.MapUsers)
+				agg.MapUsers = append(agg.MapUsers, user)
+				continue
+			case owner != key:
+				agg.Conflicts = append(agg.Conflicts, Conflict{ARN: user.UserArn, Winner: owner, Loser: key})
+			}
+			if policy == ConflictPolicyMergeGroups {
+				merged := &agg.MapUsers[positions[user.UserArn]]
+				merged.Groups = mergeGroups(merged.Groups, user.Groups)
+			}
+		}
+
+		for _, account := range spec.MapAccounts {
+			if !accounts[account] {
+				accounts[account] = true
+				owners[account] = key
+				agg.MapAccounts = append(agg.MapAccounts, account)
+			}
+		}
+	}
+	agg.Owners = owners
+
+	sort.SliceStable(agg.MapRoles, func(a, b int) bool {
+		return mappingBefore(owners, agg.MapRoles[a].RoleArn, agg.MapRoles[b].RoleArn)
+	})
+	for i := range agg.MapRoles {
+		agg.MapRoles[i].Groups = sortedGroups(agg.MapRoles[i].Groups)
+	}
+	sort.SliceStable(agg.MapUsers, func(a, b int) bool {
+		return mappingBefore(owners, agg.MapUsers[a].UserArn, agg.MapUsers[b].UserArn)
+	})
+	for i := range agg.MapUsers {
+		agg.MapUsers[i].Groups = sortedGroups(agg.MapUsers[i].Groups)
+	}
+	sort.Strings(agg.MapAccounts)
+
+	return agg
+}
+
+// Freeze returns agg with the mappings of the frozen items replaced by their
+// mappings in live, the aggregation of the aws-auth ConfigMap, so that the
+// changes of the frozen items are not rendered. The entries of live are
+// attributed by its Owners or, when unknown, by the Owners of agg. An entry of
+// a frozen item now mapped by another item is rendered as mapped by the other
+// item.
+func Freeze(agg, live Aggregation, frozen map[client.ObjectKey]bool) Aggregation {
+	ownerOf := func(id string) (client.ObjectKey, bool) {
+		if owner, ok := live.Owners[id]; ok {
+			return owner, true
+		}
+		owner, ok := agg.Owners[id]
+		return owner, ok
+	}
+	keep := func(id string) bool {
+		owner, ok := agg.Owners[id]
+		return ok && !frozen[owner]
+	}
+	keepLive := func(id string) bool {
+		owner, ok := ownerOf(id)
+		return ok && frozen[owner] && !keep(id)
+	}
+
+	frozenAgg := agg
+	frozenAgg.MapRoles, frozenAgg.MapUsers, frozenAgg.MapAccounts = nil, nil, nil
+	frozenAgg.Owners = map[string]client.ObjectKey{}
+
+	for _, role := range agg.MapRoles {
+		if keep(role.RoleArn) {
+			frozenAgg.MapRoles = append(frozenAgg.MapRoles, role)
+			frozenAgg.Owners[role.RoleArn] = agg.Owners[role.RoleArn]
+		}
+	}
+	for _, role := range live.MapRoles {
+		if keepLive(role.RoleArn) {
+			role.Groups = sortedGroups(role.Groups)
+			frozenAgg.MapRoles = append(frozenAgg.MapRoles, role)
+			frozenAgg.Owners[role.RoleArn], _ = ownerOf(role.RoleArn)
+		}
+	}
+
+	for _, user := range agg.MapUsers {
+		if keep(user.UserArn) {
+			frozenAgg.MapUsers = append(frozenAgg.MapUsers, user)
+			frozenAgg.Owners[user.UserArn] = agg.Owners[user.UserArn]
+		}
+	}
+	for _, user := range live.MapUsers {
+		if keepLive(user.UserArn) {
+			user.Groups = sortedGroups(user.Groups)
+			frozenAgg.MapUsers = append(frozenAgg.MapUsers, user)
+			frozenAgg.Owners[user.UserArn], _ = ownerOf(user.UserArn)
+		}
+	}
+
+	for _, account := range agg.MapAccounts {
+		if keep(account) {
+			frozenAgg.MapAccounts = append(frozenAgg.MapAccounts, account)
+			frozenAgg.Owners[account] = agg.Owners[account]
+		}
+	}
+	for _, account := range live.MapAccounts {
+		if keepLive(account) {
+			frozenAgg.MapAccounts = append(frozenAgg.MapAccounts, account)
+			frozenAgg.Owners[account], _ = ownerOf(account)
+		}
+	}
+
+	sort.SliceStable(frozenAgg.MapRoles, func(a, b int) bool {
+		return mappingBefore(frozenAgg.Owners, frozenAgg.MapRoles[a].RoleArn, frozenAgg.MapRoles[b].RoleArn)
+	})
+	sort.SliceStable(frozenAgg.MapUsers, func(a, b int) bool {
+		return mappingBefore(frozenAgg.Owners, frozenAgg.MapUsers[a].UserArn, frozenAgg.MapUsers[b].UserArn)
+	})
+	sort.Strings(frozenAgg.MapAccounts)
+
+	return frozenAgg
+}
+
+// SelectKeys returns agg with only the mappings of the given data keys of the
+// aws-auth ConfigMap, among mapRoles, mapUsers and mapAccounts. Every mapping
+// is kept when keys is empty.
+func SelectKeys(agg Aggregation, keys []string) Aggregation {
+	if len(keys) == 0 {
+		return agg
+	}
+
+	selected := agg
+	selected.Owners = map[string]client.ObjectKey{}
+	if !slices.Contains(keys, "mapRoles") {
+		selected.MapRoles = nil
+	}
+	if !slices.Contains(keys, "mapUsers") {
+		selected.MapUsers = nil
+	}
+	if !slices.Contains(keys, "mapAccounts") {
+		selected.MapAccounts = nil
+	}
+
+	for _, role := range selected.MapRoles {
+		selected.Owners[role.RoleArn] = agg.Owners[role.RoleArn]
+	}
+	for _, user := range selected.MapUsers {
+		selected.Owners[user.UserArn] = agg.Owners[user.UserArn]
+	}
+	for _, account := range selected.MapAccounts {
+		selected.Owners[account] = agg.Owners[account]
+	}
+
+	return selected
+}
+
+// ConflictsOf returns the conflicts lost by the item with the given key.
+func (a Aggregation) ConflictsOf(key client.ObjectKey) []Conflict {
+	var conflicts []Conflict
+	for _, c := range a.Conflicts {
+		if c.Loser == key {
+			conflicts = append(conflicts, c)
+		}
+	}
+
+	return conflicts
+}
+
+// ConflictMessage describes the conflicts lost by an item under policy.
+func ConflictMessage(conflicts []Conflict, policy string) string {
+	descriptions := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		descriptions[i] = fmt.Sprintf("%s is already mapped by %s", c.ARN, ItemName(c.Winner))
+	}
+
+	return fmt.Sprintf("%s (conflict policy %s)", strings.Join(descriptions, "; "), policy)
+}
+
+// ItemName returns the kind and name of the item with the given key.
+func ItemName(key client.ObjectKey) string {
+	if key.Namespace == "" {
+		return "ClusterAWSAuthItem " + key.Name
+	}
+
+	return "AWSAuthItem " + key.String()
+}
+
+// ranksBefore reports whether a ranks before b when resolving conflicts.
+// Cluster-scoped items, which have no namespace, rank before namespaced ones.
+func ranksBefore(a, b awsauthv1alpha1.Item) bool {
+	if clusterA, clusterB := a.GetNamespace() == "", b.GetNamespace() == ""; clusterA != clusterB {
+		return clusterA
+	}
+	createdA, createdB := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+	if !createdA.Equal(&createdB) {
+		return createdA.Before(&createdB)
+	}
+	if a.GetNamespace() != b.GetNamespace() {
+		return a.GetNamespace() < b.GetNamespace()
+	}
+
+	return a.GetName() < b.GetName()
+}
+
+// mappingBefore reports whether the mapping of ARN a renders before the
+// mapping of ARN b: by the namespace, then the name, of their owners, then by
+// ARN. The mappings of ClusterAWSAuthItems, which have no namespace, render
+// first.
+func mappingBefore(owners map[string]client.ObjectKey, a, b string) bool {
+	ownerA, ownerB := owners[a], owners[b]
+	if ownerA.Namespace != ownerB.Namespace {
+		return ownerA.Namespace < ownerB.Namespace
+	}
+	if ownerA.Name != ownerB.Name {
+		return ownerA.Name < ownerB.Name
+	}
+
+	return a < b
+}
+
+// sortedGroups returns a sorted copy of groups, leaving the groups of the
+// item spec untouched.
+func sortedGroups(groups []string) []string {
+	sorted := slices.Clone(groups)
+	slices.Sort(sorted)
+
+	return sorted
+}
+
+// itemARNs returns all the role and user ARNs mapped by an item spec.
+func itemARNs(spec *awsauthv1alpha1.AWSAuthItemSpec) []string {
+	arns := make([]string, 0, len(spec.MapRoles)+len(spec.MapUsers))
+	for _, role := range spec.MapRoles {
+		arns = append(arns, role.RoleArn)
+	}
+	for _, user := range spec.MapUsers {
+		arns = append(arns, user.UserArn)
+	}
+
+	return arns
+}
+
+// mergeGroups appends to groups the elements of other it doesn't already hold.
+func mergeGroups(groups, other []string) []string {
+	merged := slices.Clone(groups)
+	for _, group := range other {
+		if !slices.Contains(merged, group) {
+			merged = append(merged, group)
+		}
+	}
+
+	return merged
+}
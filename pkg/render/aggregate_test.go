@@ -0,0 +1,221 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+)
+
+// newItem returns an AWSAuthItem created age ago mapping a single role.
+func newItem(name string, age time.Duration, role awsauthv1alpha1.MapRoleItem) *awsauthv1alpha1.AWSAuthItem {
+	return &awsauthv1alpha1.AWSAuthItem{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		},
+		Spec: awsauthv1alpha1.AWSAuthItemSpec{
+			MapRoles: []awsauthv1alpha1.MapRoleItem{role},
+		},
+	}
+}
+
+var _ = Describe("Aggregate", func() {
+	var older, newer *awsauthv1alpha1.AWSAuthItem
+
+	BeforeEach(func() {
+		older = newItem("older", time.Hour, awsauthv1alpha1.MapRoleItem{
+			RoleArn:  "arn:aws:iam::111122223333:role/admin",
+			Username: "admin",
+			Groups:   []string{"system:masters"},
+		})
+		newer = newItem("newer", time.Minute, awsauthv1alpha1.MapRoleItem{
+			RoleArn:  "arn:aws:iam::111122223333:role/admin",
+			Username: "other",
+			Groups:   []string{"view"},
+		})
+		newer.Spec.MapAccounts = []string{"444455556666"}
+	})
+
+	It("should keep the mapping of the oldest item", func() {
+		agg := Aggregate([]awsauthv1alpha1.Item{newer, older}, ConflictPolicyOldestWins)
+		Expect(agg.MapRoles).To(Equal(older.Spec.MapRoles))
+		Expect(agg.MapAccounts).To(Equal([]string{"444455556666"}))
+		Expect(agg.ConflictsOf(client.ObjectKeyFromObject(newer))).To(Equal([]Conflict{{
+			ARN:    "arn:aws:iam::111122223333:role/admin",
+			Winner: client.ObjectKeyFromObject(older),
+			Loser:  client.ObjectKeyFromObject(newer),
+		}}))
+		Expect(agg.ConflictsOf(client.ObjectKeyFromObject(older))).To(BeEmpty())
+	})
+
+	It("should merge the groups of the conflicting mappings", func() {
+		agg := Aggregate([]awsauthv1alpha1.Item{newer, older}, ConflictPolicyMergeGroups)
+		Expect(agg.MapRoles).To(Equal([]awsauthv1alpha1.MapRoleItem{{
+			RoleArn:  "arn:aws:iam::111122223333:role/admin",
+			Username: "admin",
+			Groups:   []string{"system:masters", "view"},
+		}}))
+	})
+
+	It("should drop every mapping of a rejected item", func() {
+		agg := Aggregate([]awsauthv1alpha1.Item{newer, older}, ConflictPolicyReject)
+		Expect(agg.MapRoles).To(Equal(older.Spec.MapRoles))
+		Expect(agg.MapAccounts).To(BeEmpty())
+		Expect(agg.Rejected).To(HaveKey(client.ObjectKeyFromObject(newer)))
+	})
+
+	It("should rank ClusterAWSAuthItems before AWSAuthItems", func() {
+		cluster := &awsauthv1alpha1.ClusterAWSAuthItem{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "cluster",
+				CreationTimestamp: metav1.Now(),
+			},
+			Spec: newer.Spec,
+		}
+		agg := Aggregate([]awsauthv1alpha1.Item{older, cluster}, ConflictPolicyOldestWins)
+		Expect(agg.MapRoles).To(Equal(cluster.Spec.MapRoles))
+		Expect(agg.ConflictsOf(client.ObjectKeyFromObject(older))).To(Equal([]Conflict{{
+			ARN:    "arn:aws:iam::111122223333:role/admin",
+			Winner: client.ObjectKeyFromObject(cluster),
+			Loser:  client.ObjectKeyFromObject(older),
+		}}))
+		Expect(ConflictMessage(agg.ConflictsOf(client.ObjectKeyFromObject(older)), ConflictPolicyOldestWins)).
+			To(ContainSubstring("ClusterAWSAuthItem cluster"))
+	})
+
+	It("should skip the items being deleted", func() {
+		now := metav1.Now()
+		older.DeletionTimestamp = &now
+		agg := Aggregate([]awsauthv1alpha1.Item{newer, older}, ConflictPolicyOldestWins)
+		Expect(agg.MapRoles).To(Equal(newer.Spec.MapRoles))
+		Expect(agg.Conflicts).To(BeEmpty())
+	})
+
+	It("should render the same mappings whatever the order of the items", func() {
+		first := newItem("b", time.Hour, awsauthv1alpha1.MapRoleItem{
+			RoleArn:  "arn:aws:iam::111122223333:role/b",
+			Username: "b",
+			Groups:   []string{"view", "edit"},
+		})
+		first.Spec.MapRoles = append(first.Spec.MapRoles, awsauthv1alpha1.MapRoleItem{
+			RoleArn:  "arn:aws:iam::111122223333:role/a",
+			Username: "a",
+			Groups:   []string{"view"},
+		})
+		first.Spec.MapAccounts = []string{"777788889999", "444455556666"}
+		second := newItem("a", time.Minute, awsauthv1alpha1.MapRoleItem{
+			RoleArn:  "arn:aws:iam::111122223333:role/c",
+			Username: "c",
+			Groups:   []string{"view"},
+		})
+
+		agg := Aggregate([]awsauthv1alpha1.Item{first, second}, ConflictPolicyOldestWins)
+		Expect(Aggregate([]awsauthv1alpha1.Item{second, first}, ConflictPolicyOldestWins)).To(Equal(agg))
+		Expect(agg.MapRoles).To(Equal([]awsauthv1alpha1.MapRoleItem{
+			{RoleArn: "arn:aws:iam::111122223333:role/c", Username: "c", Groups: []string{"view"}},
+			{RoleArn: "arn:aws:iam::111122223333:role/a", Username: "a", Groups: []string{"view"}},
+			{RoleArn: "arn:aws:iam::111122223333:role/b", Username: "b", Groups: []string{"edit", "view"}},
+		}))
+		Expect(agg.MapAccounts).To(Equal([]string{"444455556666", "777788889999"}))
+		Expect(first.Spec.MapRoles[0].Groups).To(Equal([]string{"view", "edit"}))
+	})
+
+	It("should keep the mappings of suspended items", func() {
+		older.Spec.Suspend = true
+		agg := Aggregate([]awsauthv1alpha1.Item{older}, ConflictPolicyOldestWins)
+		Expect(agg.MapRoles).To(Equal(older.Spec.MapRoles))
+	})
+})
+
+var _ = Describe("Freeze", func() {
+	It("should render the live mappings of the frozen items", func() {
+		role := func(name string, groups ...string) awsauthv1alpha1.MapRoleItem {
+			return awsauthv1alpha1.MapRoleItem{
+				RoleArn:  "arn:aws:iam::111122223333:role/" + name,
+				Username: name,
+				Groups:   groups,
+			}
+		}
+		frozen := newItem("frozen", time.Hour, role("kept", "view"))
+		frozen.Spec.MapRoles = append(frozen.Spec.MapRoles, role("removed", "view"))
+		other := newItem("other", time.Minute, role("other", "view"))
+
+		live := NewConfigMap("aws-auth", "kube-system")
+		Expect(ConfigMap(live, Aggregate([]awsauthv1alpha1.Item{frozen, other}, ConflictPolicyOldestWins),
+			ConfigMapModeStrict)).To(Succeed())
+		liveAgg, err := ParseConfigMap(live)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(liveAgg.Owners).To(HaveKeyWithValue("arn:aws:iam::111122223333:role/removed", client.ObjectKeyFromObject(frozen)))
+
+		frozen.Spec.MapRoles = []awsauthv1alpha1.MapRoleItem{role("kept", "edit"), role("added", "view")}
+		other.Spec.MapRoles = []awsauthv1alpha1.MapRoleItem{role("other", "edit")}
+		agg := Aggregate([]awsauthv1alpha1.Item{frozen, other}, ConflictPolicyOldestWins)
+
+		frozenAgg := Freeze(agg, liveAgg, map[client.ObjectKey]bool{client.ObjectKeyFromObject(frozen): true})
+		Expect(frozenAgg.MapRoles).To(Equal([]awsauthv1alpha1.MapRoleItem{
+			role("kept", "view"), role("removed", "view"), role("other", "edit"),
+		}))
+
+		// The changes of the frozen item are pending
+		applied, desired := live.DeepCopy(), live.DeepCopy()
+		Expect(ConfigMap(applied, frozenAgg, ConfigMapModeStrict)).To(Succeed())
+		Expect(ConfigMap(desired, agg, ConfigMapModeStrict)).To(Succeed())
+		changes, err := Diff(applied, desired)
+		Expect(err).NotTo(HaveOccurred())
+
+		var pending []string
+		for _, change := range changes {
+			Expect(change.Owner).To(Equal(client.ObjectKeyFromObject(frozen)))
+			pending = append(pending, change.Type+" "+change.ID)
+		}
+		Expect(pending).To(ConsistOf(
+			"added arn:aws:iam::111122223333:role/added",
+			"modified arn:aws:iam::111122223333:role/kept",
+			"removed arn:aws:iam::111122223333:role/removed",
+		))
+	})
+})
+
+var _ = Describe("SelectKeys", func() {
+	It("should only keep the mappings of the selected keys", func() {
+		item := newItem("item", time.Hour, awsauthv1alpha1.MapRoleItem{
+			RoleArn:  "arn:aws:iam::111122223333:role/admin",
+			Username: "admin",
+			Groups:   []string{"system:masters"},
+		})
+		item.Spec.MapAccounts = []string{"444455556666"}
+		agg := Aggregate([]awsauthv1alpha1.Item{item}, ConflictPolicyOldestWins)
+
+		Expect(SelectKeys(agg, nil)).To(Equal(agg))
+
+		selected := SelectKeys(agg, []string{"mapAccounts"})
+		Expect(selected.MapRoles).To(BeEmpty())
+		Expect(selected.MapAccounts).To(Equal([]string{"444455556666"}))
+		Expect(selected.Owners).To(Equal(map[string]client.ObjectKey{
+			"444455556666": client.ObjectKeyFromObject(item),
+		}))
+		Expect(agg.MapRoles).To(HaveLen(1), "the aggregation should not be modified")
+	})
+})
@@ -0,0 +1,349 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+)
+
+// Modes the aws-auth ConfigMap can be rendered with.
+const (
+	// ConfigMapModeStrict replaces the whole content of the aws-auth ConfigMap
+	// with the mappings of the AWSAuthItems.
+	ConfigMapModeStrict = "strict"
+
+	// ConfigMapModeMerge only adds and removes the entries managed by
+	// AWSAuthItems, and keeps the entries created by other tools.
+	ConfigMapModeMerge = "merge"
+)
+
+// ManagedEntriesAnnotation records on the aws-auth ConfigMap the entries
+// written by the controller, so that merge mode can tell them apart from
+// entries created by other tools.
+const ManagedEntriesAnnotation = "aws-auth-manager.maruina.k8s/managed-entries"
+
+// OwnersAnnotation records on the aws-auth ConfigMap the item owning each
+// entry, keyed by ARN and account ID, so that the entries of an item can be
+// told apart from the others.
+const OwnersAnnotation = "aws-auth-manager.maruina.k8s/owners"
+
+// Annotations recording on the aws-auth ConfigMap the SHA-256 of the rendered
+// mapRoles and mapUsers, so that an unchanged ConfigMap is not patched.
+const (
+	MapRolesAnnotation = "aws-auth-manager.maruina.k8s/map-roles-sha256"
+	MapUsersAnnotation = "aws-auth-manager.maruina.k8s/map-users-sha256"
+)
+
+// MarshalError reports a key of the aws-auth ConfigMap data that could not be
+// marshaled.
+type MarshalError struct {
+	// Key is the data key, one of mapRoles, mapUsers or mapAccounts.
+	Key string
+
+	Err error
+}
+
+func (e *MarshalError) Error() string {
+	return fmt.Sprintf("marshaling %s: %v", e.Key, e.Err)
+}
+
+func (e *MarshalError) Unwrap() error {
+	return e.Err
+}
+
+// NewConfigMap returns an empty aws-auth ConfigMap with the given name and
+// namespace, annotated as managed by aws-auth-manager.
+func NewConfigMap(name, namespace string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Annotations: map[string]string{
+				awsauthv1alpha1.AWSAuthAnnotationKey: awsauthv1alpha1.AWSAuthAnnotationValue,
+			},
+		},
+		Data: map[string]string{
+			"mapUsers":    "",
+			"mapRoles":    "",
+			"mapAccounts": "",
+		},
+	}
+}
+
+// ConfigMap writes the mappings of agg to the data of cm. In
+// ConfigMapModeMerge the entries of cm not managed by any AWSAuthItem are
+// kept, in any other mode they are replaced. A *MarshalError is returned when
+// the data cannot be marshaled.
+func ConfigMap(cm *corev1.ConfigMap, agg Aggregation, mode string) error {
+	rendered := agg
+	if mode == ConfigMapModeMerge {
+		var err error
+		if rendered, err = MergeUnmanaged(agg, cm); err != nil {
+			return err
+		}
+	}
+
+	mapRolesYaml, err := yaml.Marshal(rendered.MapRoles)
+	if err != nil {
+		return &MarshalError{Key: "mapRoles", Err: err}
+	}
+
+	mapUsersYaml, err := yaml.Marshal(rendered.MapUsers)
+	if err != nil {
+		return &MarshalError{Key: "mapUsers", Err: err}
+	}
+
+	mapAccountsYaml, err := yaml.Marshal(rendered.MapAccounts)
+	if err != nil {
+		return &MarshalError{Key: "mapAccounts", Err: err}
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data["mapRoles"] = string(mapRolesYaml)
+	cm.Data["mapUsers"] = string(mapUsersYaml)
+	cm.Data["mapAccounts"] = string(mapAccountsYaml)
+
+	if err := setManagedEntries(cm, agg); err != nil {
+		return err
+	}
+	if err := setOwners(cm, agg); err != nil {
+		return err
+	}
+	cm.Annotations[MapRolesAnnotation] = contentHash(cm.Data["mapRoles"])
+	cm.Annotations[MapUsersAnnotation] = contentHash(cm.Data["mapUsers"])
+
+	return nil
+}
+
+// Unchanged reports whether live, the aws-auth ConfigMap in the cluster,
+// already holds the content of rendered, as written by ConfigMap. The mapRoles
+// and mapUsers of live are compared by hash with the MapRolesAnnotation and
+// MapUsersAnnotation of rendered, so that a manual change of live is detected
+// even when its annotations were left untouched.
+func Unchanged(live, rendered *corev1.ConfigMap) bool {
+	if !maps.Equal(live.Annotations, rendered.Annotations) || live.Data["mapAccounts"] != rendered.Data["mapAccounts"] {
+		return false
+	}
+
+	return contentHash(live.Data["mapRoles"]) == rendered.Annotations[MapRolesAnnotation] &&
+		contentHash(live.Data["mapUsers"]) == rendered.Annotations[MapUsersAnnotation]
+}
+
+// ApplyConfiguration returns the server-side apply configuration of cm, as
+// written by ConfigMap. It only holds the data keys and the annotations owned
+// by aws-auth-manager, so that the fields of other managers are left untouched.
+func ApplyConfiguration(cm *corev1.ConfigMap) *corev1ac.ConfigMapApplyConfiguration {
+	annotations := map[string]string{}
+	for _, key := range []string{
+		awsauthv1alpha1.AWSAuthAnnotationKey, ManagedEntriesAnnotation, OwnersAnnotation, MapRolesAnnotation, MapUsersAnnotation,
+	} {
+		if value, ok := cm.Annotations[key]; ok {
+			annotations[key] = value
+		}
+	}
+
+	return corev1ac.ConfigMap(cm.Name, cm.Namespace).
+		WithAnnotations(annotations).
+		WithData(map[string]string{
+			"mapRoles":    cm.Data["mapRoles"],
+			"mapUsers":    cm.Data["mapUsers"],
+			"mapAccounts": cm.Data["mapAccounts"],
+		})
+}
+
+// contentHash returns the hex-encoded SHA-256 of data.
+func contentHash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseConfigMap returns the mapRoles, mapUsers and mapAccounts of an aws-auth
+// ConfigMap, and their owners recorded in its OwnersAnnotation, if any. The
+// conflicts of the returned Aggregation are always empty.
+func ParseConfigMap(cm *corev1.ConfigMap) (Aggregation, error) {
+	var agg Aggregation
+
+	if value, ok := cm.Annotations[OwnersAnnotation]; ok {
+		var owners map[string]string
+		if err := json.Unmarshal([]byte(value), &owners); err != nil {
+			return agg, fmt.Errorf("unmarshaling %s annotation: %w", OwnersAnnotation, err)
+		}
+		agg.Owners = make(map[string]client.ObjectKey, len(owners))
+		for id, owner := range owners {
+			namespace, name, _ := strings.Cut(owner, "/")
+			agg.Owners[id] = client.ObjectKey{Namespace: namespace, Name: name}
+		}
+	}
+
+	if err := yaml.Unmarshal([]byte(cm.Data["mapRoles"]), &agg.MapRoles); err != nil {
+		return agg, fmt.Errorf("unmarshaling mapRoles: %w", err)
+	}
+
+	if err := yaml.Unmarshal([]byte(cm.Data["mapUsers"]), &agg.MapUsers); err != nil {
+		return agg, fmt.Errorf("unmarshaling mapUsers: %w", err)
+	}
+
+	if err := yaml.Unmarshal([]byte(cm.Data["mapAccounts"]), &agg.MapAccounts); err != nil {
+		return agg, fmt.Errorf("unmarshaling mapAccounts: %w", err)
+	}
+
+	return agg, nil
+}
+
+// managedEntries is the content of the ManagedEntriesAnnotation.
+type managedEntries struct {
+	MapRoles    []string `json:"mapRoles,omitempty"`
+	MapUsers    []string `json:"mapUsers,omitempty"`
+	MapAccounts []string `json:"mapAccounts,omitempty"`
+}
+
+// setManagedEntries records the ARNs and accounts of agg in the
+// ManagedEntriesAnnotation of cm.
+func setManagedEntries(cm *corev1.ConfigMap, agg Aggregation) error {
+	var managed managedEntries
+	for _, role := range agg.MapRoles {
+		managed.MapRoles = append(managed.MapRoles, role.RoleArn)
+	}
+	for _, user := range agg.MapUsers {
+		managed.MapUsers = append(managed.MapUsers, user.UserArn)
+	}
+	managed.MapAccounts = agg.MapAccounts
+
+	value, err := json.Marshal(managed)
+	if err != nil {
+		return fmt.Errorf("marshaling managed entries: %w", err)
+	}
+
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[ManagedEntriesAnnotation] = string(value)
+
+	return nil
+}
+
+// setOwners records the owners of the entries of agg in the OwnersAnnotation
+// of cm, as namespace/name.
+func setOwners(cm *corev1.ConfigMap, agg Aggregation) error {
+	owners := make(map[string]string, len(agg.Owners))
+	for id, owner := range agg.Owners {
+		owners[id] = owner.Namespace + "/" + owner.Name
+	}
+
+	value, err := json.Marshal(owners)
+	if err != nil {
+		return fmt.Errorf("marshaling %s annotation: %w", OwnersAnnotation, err)
+	}
+	cm.Annotations[OwnersAnnotation] = string(value)
+
+	return nil
+}
+
+// getManagedEntries returns the entries recorded in the
+// ManagedEntriesAnnotation of cm.
+func getManagedEntries(cm *corev1.ConfigMap) (managedEntries, error) {
+	var managed managedEntries
+
+	value, ok := cm.Annotations[ManagedEntriesAnnotation]
+	if !ok {
+		return managed, nil
+	}
+	if err := json.Unmarshal([]byte(value), &managed); err != nil {
+		return managed, fmt.Errorf("unmarshaling %s annotation: %w", ManagedEntriesAnnotation, err)
+	}
+
+	return managed, nil
+}
+
+// MergeUnmanaged returns agg with the entries of cm that are not managed by
+// any AWSAuthItem. An entry is unmanaged when it was not written by the
+// controller and is not mapped by any AWSAuthItem; an entry mapped by an
+// AWSAuthItem is adopted and replaced by the AWSAuthItem mapping.
+func MergeUnmanaged(agg Aggregation, cm *corev1.ConfigMap) (Aggregation, error) {
+	managed, err := getManagedEntries(cm)
+	if err != nil {
+		return agg, err
+	}
+
+	existing, err := ParseConfigMap(cm)
+	if err != nil {
+		return agg, err
+	}
+
+	owned := map[string]bool{}
+	for _, arn := range managed.MapRoles {
+		owned[arn] = true
+	}
+	for _, arn := range managed.MapUsers {
+		owned[arn] = true
+	}
+	for _, account := range managed.MapAccounts {
+		owned[account] = true
+	}
+	for _, role := range agg.MapRoles {
+		owned[role.RoleArn] = true
+	}
+	for _, user := range agg.MapUsers {
+		owned[user.UserArn] = true
+	}
+	for _, account := range agg.MapAccounts {
+		owned[account] = true
+	}
+
+	merged := agg
+	merged.MapRoles = nil
+	for _, role := range existing.MapRoles {
+		if !owned[role.RoleArn] {
+			merged.MapRoles = append(merged.MapRoles, role)
+		}
+	}
+	merged.MapRoles = append(merged.MapRoles, agg.MapRoles...)
+
+	merged.MapUsers = nil
+	for _, user := range existing.MapUsers {
+		if !owned[user.UserArn] {
+			merged.MapUsers = append(merged.MapUsers, user)
+		}
+	}
+	merged.MapUsers = append(merged.MapUsers, agg.MapUsers...)
+
+	merged.MapAccounts = nil
+	for _, account := range existing.MapAccounts {
+		if !owned[account] {
+			merged.MapAccounts = append(merged.MapAccounts, account)
+		}
+	}
+	merged.MapAccounts = append(merged.MapAccounts, agg.MapAccounts...)
+
+	return merged, nil
+}
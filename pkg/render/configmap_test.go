@@ -0,0 +1,137 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+)
+
+var _ = Describe("ConfigMap", func() {
+	var agg Aggregation
+
+	BeforeEach(func() {
+		agg = Aggregation{
+			MapRoles: []awsauthv1alpha1.MapRoleItem{{
+				RoleArn:  "arn:aws:iam::111122223333:role/admin",
+				Username: "admin",
+				Groups:   []string{"system:masters"},
+			}},
+			MapAccounts: []string{"444455556666"},
+		}
+	})
+
+	It("should replace the whole content in strict mode", func() {
+		cm := NewConfigMap("aws-auth", "kube-system")
+		cm.Data["mapUsers"] = `- userarn: arn:aws:iam::111122223333:user/ops
+  username: ops
+  groups:
+    - system:masters
+`
+		Expect(ConfigMap(cm, agg, ConfigMapModeStrict)).To(Succeed())
+		Expect(cm.Data).To(Equal(map[string]string{
+			"mapRoles": `- groups:
+  - system:masters
+  rolearn: arn:aws:iam::111122223333:role/admin
+  username: admin
+`,
+			"mapUsers": "null\n",
+			"mapAccounts": `- "444455556666"
+`,
+		}))
+		Expect(cm.Annotations).To(HaveKeyWithValue(ManagedEntriesAnnotation,
+			`{"mapRoles":["arn:aws:iam::111122223333:role/admin"],"mapAccounts":["444455556666"]}`))
+	})
+
+	It("should keep the unmanaged entries in merge mode", func() {
+		cm := NewConfigMap("aws-auth", "kube-system")
+		cm.Data["mapRoles"] = `- rolearn: arn:aws:iam::111122223333:role/nodes
+  username: system:node:{{EC2PrivateDNSName}}
+  groups:
+    - system:nodes
+- rolearn: arn:aws:iam::111122223333:role/admin
+  username: old-admin
+  groups:
+    - view
+`
+		Expect(ConfigMap(cm, agg, ConfigMapModeMerge)).To(Succeed())
+		Expect(cm.Data["mapRoles"]).To(Equal(`- groups:
+  - system:nodes
+  rolearn: arn:aws:iam::111122223333:role/nodes
+  username: system:node:{{EC2PrivateDNSName}}
+- groups:
+  - system:masters
+  rolearn: arn:aws:iam::111122223333:role/admin
+  username: admin
+`))
+	})
+
+	It("should record the hashes of the mappings", func() {
+		cm := NewConfigMap("aws-auth", "kube-system")
+		Expect(ConfigMap(cm, agg, ConfigMapModeStrict)).To(Succeed())
+		Expect(cm.Annotations).To(HaveKeyWithValue(MapRolesAnnotation, contentHash(cm.Data["mapRoles"])))
+		Expect(cm.Annotations).To(HaveKeyWithValue(MapUsersAnnotation, contentHash("null\n")))
+	})
+
+	It("should report whether the live ConfigMap holds the rendered content", func() {
+		live := NewConfigMap("aws-auth", "kube-system")
+		Expect(ConfigMap(live, agg, ConfigMapModeStrict)).To(Succeed())
+
+		rendered := live.DeepCopy()
+		Expect(ConfigMap(rendered, agg, ConfigMapModeStrict)).To(Succeed())
+		Expect(Unchanged(live, rendered)).To(BeTrue())
+
+		By("detecting a manual change of the mappings")
+		live.Data["mapRoles"] += "- rolearn: arn:aws:iam::111122223333:role/manual\n"
+		Expect(Unchanged(live, rendered)).To(BeFalse())
+
+		By("detecting a change of the mappings to render")
+		live = rendered.DeepCopy()
+		agg.MapAccounts = append(agg.MapAccounts, "777788889999")
+		Expect(ConfigMap(rendered, agg, ConfigMapModeStrict)).To(Succeed())
+		Expect(Unchanged(live, rendered)).To(BeFalse())
+	})
+
+	It("should only apply the data and the annotations owned by aws-auth-manager", func() {
+		cm := NewConfigMap("aws-auth", "kube-system")
+		cm.Annotations["kubectl.kubernetes.io/last-applied-configuration"] = "{}"
+		cm.Data["other"] = "kept"
+		Expect(ConfigMap(cm, agg, ConfigMapModeStrict)).To(Succeed())
+
+		applied := ApplyConfiguration(cm)
+		Expect(*applied.Name).To(Equal("aws-auth"))
+		Expect(*applied.Namespace).To(Equal("kube-system"))
+		Expect(applied.Data).To(Equal(map[string]string{
+			"mapRoles":    cm.Data["mapRoles"],
+			"mapUsers":    cm.Data["mapUsers"],
+			"mapAccounts": cm.Data["mapAccounts"],
+		}))
+		Expect(applied.Annotations).To(HaveKeyWithValue(awsauthv1alpha1.AWSAuthAnnotationKey, awsauthv1alpha1.AWSAuthAnnotationValue))
+		Expect(applied.Annotations).To(HaveKey(ManagedEntriesAnnotation))
+		Expect(applied.Annotations).To(HaveKey(MapRolesAnnotation))
+		Expect(applied.Annotations).To(HaveKey(MapUsersAnnotation))
+		Expect(applied.Annotations).NotTo(HaveKey("kubectl.kubernetes.io/last-applied-configuration"))
+	})
+
+	It("should fail to merge a malformed ConfigMap", func() {
+		cm := NewConfigMap("aws-auth", "kube-system")
+		cm.Data["mapRoles"] = "not: a list"
+		Expect(ConfigMap(cm, agg, ConfigMapModeMerge)).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,186 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Kinds of changes between two aws-auth ConfigMaps.
+const (
+	// ChangeAdded is an entry only present in the desired ConfigMap.
+	ChangeAdded = "added"
+
+	// ChangeRemoved is an entry only present in the live ConfigMap.
+	ChangeRemoved = "removed"
+
+	// ChangeModified is an entry present in both ConfigMaps with a different
+	// username or groups.
+	ChangeModified = "modified"
+)
+
+// Mapping is the Kubernetes identity an IAM role or user is mapped to.
+type Mapping struct {
+	Username string
+	Groups   []string
+}
+
+func (m Mapping) String() string {
+	return fmt.Sprintf("username=%s groups=%s", m.Username, strings.Join(m.Groups, ","))
+}
+
+// Change is a difference in a single entry of the aws-auth ConfigMap.
+type Change struct {
+	// Type is one of ChangeAdded, ChangeRemoved or ChangeModified.
+	Type string
+
+	// Key is the data key of the entry, one of mapRoles, mapUsers or mapAccounts.
+	Key string
+
+	// ID is the rolearn or userarn of the entry, or the account ID for
+	// mapAccounts.
+	ID string
+
+	// Live and Desired are the mappings of the entry in the live and desired
+	// ConfigMaps. They are nil for mapAccounts and when the entry is missing.
+	Live    *Mapping
+	Desired *Mapping
+
+	// Owner is the item owning the entry in the desired ConfigMap, or in the
+	// live one when it is removed, as recorded in their OwnersAnnotation. It
+	// is empty when the owner is unknown.
+	Owner client.ObjectKey
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Type == ChangeModified:
+		return fmt.Sprintf("~ %s %s: %s -> %s", c.Key, c.ID, c.Live, c.Desired)
+	case c.Type == ChangeAdded && c.Desired != nil:
+		return fmt.Sprintf("+ %s %s: %s", c.Key, c.ID, c.Desired)
+	case c.Type == ChangeRemoved && c.Live != nil:
+		return fmt.Sprintf("- %s %s: %s", c.Key, c.ID, c.Live)
+	case c.Type == ChangeAdded:
+		return fmt.Sprintf("+ %s %s", c.Key, c.ID)
+	default:
+		return fmt.Sprintf("- %s %s", c.Key, c.ID)
+	}
+}
+
+// Diff compares the entries of the live and desired aws-auth ConfigMaps,
+// keyed by rolearn, userarn and account ID. Groups are compared regardless of
+// their order. Changes are sorted by data key and ID.
+func Diff(live, desired *corev1.ConfigMap) ([]Change, error) {
+	liveAgg, err := ParseConfigMap(live)
+	if err != nil {
+		return nil, fmt.Errorf("parsing live ConfigMap: %w", err)
+	}
+
+	desiredAgg, err := ParseConfigMap(desired)
+	if err != nil {
+		return nil, fmt.Errorf("parsing desired ConfigMap: %w", err)
+	}
+
+	var changes []Change
+	changes = append(changes, diffMappings("mapRoles", roleMappings(liveAgg), roleMappings(desiredAgg))...)
+	changes = append(changes, diffMappings("mapUsers", userMappings(liveAgg), userMappings(desiredAgg))...)
+	changes = append(changes, diffAccounts(liveAgg.MapAccounts, desiredAgg.MapAccounts)...)
+	for i := range changes {
+		owners := desiredAgg.Owners
+		if changes[i].Type == ChangeRemoved {
+			owners = liveAgg.Owners
+		}
+		changes[i].Owner = owners[changes[i].ID]
+	}
+
+	return changes, nil
+}
+
+// roleMappings returns the mapRoles of agg keyed by rolearn.
+func roleMappings(agg Aggregation) map[string]Mapping {
+	mappings := map[string]Mapping{}
+	for _, role := range agg.MapRoles {
+		mappings[role.RoleArn] = Mapping{Username: role.Username, Groups: role.Groups}
+	}
+
+	return mappings
+}
+
+// userMappings returns the mapUsers of agg keyed by userarn.
+func userMappings(agg Aggregation) map[string]Mapping {
+	mappings := map[string]Mapping{}
+	for _, user := range agg.MapUsers {
+		mappings[user.UserArn] = Mapping{Username: user.Username, Groups: user.Groups}
+	}
+
+	return mappings
+}
+
+// diffMappings returns the changes between the live and desired mappings of key.
+func diffMappings(key string, live, desired map[string]Mapping) []Change {
+	var changes []Change
+	for id, d := range desired {
+		l, ok := live[id]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Type: ChangeAdded, Key: key, ID: id, Desired: &d})
+		case l.Username != d.Username || !sameGroups(l.Groups, d.Groups):
+			changes = append(changes, Change{Type: ChangeModified, Key: key, ID: id, Live: &l, Desired: &d})
+		}
+	}
+	for id, l := range live {
+		if _, ok := desired[id]; !ok {
+			changes = append(changes, Change{Type: ChangeRemoved, Key: key, ID: id, Live: &l})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ID < changes[j].ID
+	})
+
+	return changes
+}
+
+// diffAccounts returns the changes between the live and desired mapAccounts.
+func diffAccounts(live, desired []string) []Change {
+	var changes []Change
+	for _, account := range desired {
+		if !slices.Contains(live, account) {
+			changes = append(changes, Change{Type: ChangeAdded, Key: "mapAccounts", ID: account})
+		}
+	}
+	for _, account := range live {
+		if !slices.Contains(desired, account) {
+			changes = append(changes, Change{Type: ChangeRemoved, Key: "mapAccounts", ID: account})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ID < changes[j].ID
+	})
+
+	return changes
+}
+
+// sameGroups reports whether a and b hold the same groups, ignoring order.
+func sameGroups(a, b []string) bool {
+	return slices.Equal(slices.Sorted(slices.Values(a)), slices.Sorted(slices.Values(b)))
+}
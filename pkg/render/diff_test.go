@@ -0,0 +1,109 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Diff", func() {
+	var live *corev1.ConfigMap
+
+	BeforeEach(func() {
+		live = &corev1.ConfigMap{Data: map[string]string{
+			"mapRoles": `- rolearn: arn:aws:iam::111122223333:role/nodes
+  username: system:node:{{EC2PrivateDNSName}}
+  groups:
+    - system:bootstrappers
+    - system:nodes
+- rolearn: arn:aws:iam::111122223333:role/admin
+  username: admin
+  groups:
+    - system:masters
+`,
+			"mapAccounts": `- "444455556666"
+`,
+		}}
+	})
+
+	It("should ignore formatting and group order", func() {
+		desired := &corev1.ConfigMap{Data: map[string]string{
+			"mapRoles": `- groups: [system:masters]
+  rolearn: arn:aws:iam::111122223333:role/admin
+  username: admin
+- groups: [system:nodes, system:bootstrappers]
+  rolearn: arn:aws:iam::111122223333:role/nodes
+  username: system:node:{{EC2PrivateDNSName}}
+`,
+			"mapAccounts": `["444455556666"]`,
+		}}
+		Expect(Diff(live, desired)).To(BeEmpty())
+	})
+
+	It("should report added, modified and removed entries", func() {
+		desired := &corev1.ConfigMap{Data: map[string]string{
+			"mapRoles": `- rolearn: arn:aws:iam::111122223333:role/admin
+  username: admin
+  groups:
+    - view
+`,
+			"mapUsers": `- userarn: arn:aws:iam::111122223333:user/ops
+  username: ops
+  groups:
+    - system:masters
+`,
+		}}
+		changes, err := Diff(live, desired)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]Change{
+			{
+				Type:    ChangeModified,
+				Key:     "mapRoles",
+				ID:      "arn:aws:iam::111122223333:role/admin",
+				Live:    &Mapping{Username: "admin", Groups: []string{"system:masters"}},
+				Desired: &Mapping{Username: "admin", Groups: []string{"view"}},
+			},
+			{
+				Type: ChangeRemoved,
+				Key:  "mapRoles",
+				ID:   "arn:aws:iam::111122223333:role/nodes",
+				Live: &Mapping{Username: "system:node:{{EC2PrivateDNSName}}", Groups: []string{"system:bootstrappers", "system:nodes"}},
+			},
+			{
+				Type:    ChangeAdded,
+				Key:     "mapUsers",
+				ID:      "arn:aws:iam::111122223333:user/ops",
+				Desired: &Mapping{Username: "ops", Groups: []string{"system:masters"}},
+			},
+			{
+				Type: ChangeRemoved,
+				Key:  "mapAccounts",
+				ID:   "444455556666",
+			},
+		}))
+		Expect(changes[0].String()).To(Equal("~ mapRoles arn:aws:iam::111122223333:role/admin: " +
+			"username=admin groups=system:masters -> username=admin groups=view"))
+	})
+
+	It("should fail on a malformed ConfigMap", func() {
+		live.Data["mapUsers"] = "not: a list"
+		_, err := Diff(live, &corev1.ConfigMap{})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,99 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DriftedKeys returns the data keys, mapRoles and mapUsers, of the live
+// aws-auth ConfigMap whose content no longer matches the hash recorded in its
+// MapRolesAnnotation and MapUsersAnnotation when it was last rendered. A key
+// without annotation was never rendered, so it can't have drifted.
+func DriftedKeys(live *corev1.ConfigMap) []string {
+	var keys []string
+	for _, key := range []struct{ key, annotation string }{
+		{"mapRoles", MapRolesAnnotation},
+		{"mapUsers", MapUsersAnnotation},
+	} {
+		hash, ok := live.Annotations[key.annotation]
+		if ok && contentHash(live.Data[key.key]) != hash {
+			keys = append(keys, key.key)
+		}
+	}
+
+	return keys
+}
+
+// Drift returns the changes of the drifted keys of the live aws-auth ConfigMap
+// reverted by writing the desired one. The entries of these keys kept by the
+// desired ConfigMap, such as the unmanaged entries in merge mode, are not part
+// of the drift.
+func Drift(live, desired *corev1.ConfigMap) ([]Change, error) {
+	keys := DriftedKeys(live)
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	changes, err := Diff(live, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []Change
+	for _, change := range changes {
+		if slices.Contains(keys, change.Key) {
+			drift = append(drift, change)
+		}
+	}
+
+	return drift, nil
+}
+
+// DataManagers returns the field managers of the given data keys of cm, other
+// than the excluded ones, with their operation, such as
+// `kubectl-edit (Update)`, as recorded in its managed fields. They are sorted
+// and unique.
+func DataManagers(cm *corev1.ConfigMap, keys []string, exclude ...string) ([]string, error) {
+	var managers []string
+	for _, entry := range cm.ManagedFields {
+		if entry.FieldsV1 == nil || slices.Contains(exclude, entry.Manager) {
+			continue
+		}
+
+		var fields struct {
+			Data map[string]json.RawMessage `json:"f:data"`
+		}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			return nil, fmt.Errorf("unmarshaling managed fields of %s: %w", entry.Manager, err)
+		}
+		for _, key := range keys {
+			if _, ok := fields.Data["f:"+key]; ok {
+				managers = append(managers, fmt.Sprintf("%s (%s)", entry.Manager, entry.Operation))
+				break
+			}
+		}
+	}
+	sort.Strings(managers)
+
+	return slices.Compact(managers), nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Drift", func() {
+	const (
+		mapRoles = `- rolearn: arn:aws:iam::111122223333:role/admin
+  username: admin
+  groups:
+    - system:masters
+`
+		mapUsers = `- userarn: arn:aws:iam::111122223333:user/ops
+  username: ops
+  groups:
+    - view
+`
+	)
+
+	var rendered *corev1.ConfigMap
+
+	BeforeEach(func() {
+		rendered = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				MapRolesAnnotation: contentHash(mapRoles),
+				MapUsersAnnotation: contentHash(mapUsers),
+			}},
+			Data: map[string]string{"mapRoles": mapRoles, "mapUsers": mapUsers},
+		}
+	})
+
+	It("should not report a ConfigMap as rendered", func() {
+		Expect(DriftedKeys(rendered)).To(BeEmpty())
+		Expect(Drift(rendered, rendered)).To(BeEmpty())
+	})
+
+	It("should not report a ConfigMap never rendered", func() {
+		live := &corev1.ConfigMap{Data: map[string]string{"mapRoles": mapRoles}}
+		Expect(DriftedKeys(live)).To(BeEmpty())
+	})
+
+	It("should report the changes of the drifted keys reverted by the rendering", func() {
+		live := rendered.DeepCopy()
+		live.Data["mapRoles"] = mapRoles + `- rolearn: arn:aws:iam::111122223333:role/intruder
+  username: intruder
+  groups:
+    - system:masters
+`
+		Expect(DriftedKeys(live)).To(Equal([]string{"mapRoles"}))
+
+		// The change of mapUsers is not a drift but a new rendering
+		desired := rendered.DeepCopy()
+		desired.Data["mapUsers"] = ""
+		Expect(Drift(live, desired)).To(Equal([]Change{{
+			Type: ChangeRemoved,
+			Key:  "mapRoles",
+			ID:   "arn:aws:iam::111122223333:role/intruder",
+			Live: &Mapping{Username: "intruder", Groups: []string{"system:masters"}},
+		}}))
+	})
+
+	It("should ignore a change of formatting kept by the rendering", func() {
+		live := rendered.DeepCopy()
+		live.Data["mapUsers"] = `[{"userarn": "arn:aws:iam::111122223333:user/ops", "username": "ops", "groups": ["view"]}]`
+		Expect(DriftedKeys(live)).To(Equal([]string{"mapUsers"}))
+		Expect(Drift(live, rendered)).To(BeEmpty())
+	})
+
+	It("should return the field managers of the drifted keys", func() {
+		live := rendered.DeepCopy()
+		live.ManagedFields = []metav1.ManagedFieldsEntry{
+			{
+				Manager:   "aws-auth-manager",
+				Operation: metav1.ManagedFieldsOperationApply,
+				FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:data":{"f:mapAccounts":{},"f:mapUsers":{}}}`)},
+			},
+			{
+				Manager:   "kubectl-edit",
+				Operation: metav1.ManagedFieldsOperationUpdate,
+				FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:data":{"f:mapRoles":{}}}`)},
+			},
+			{
+				Manager:   "eksctl",
+				Operation: metav1.ManagedFieldsOperationUpdate,
+				FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:team":{}}}}`)},
+			},
+		}
+		Expect(DataManagers(live, []string{"mapRoles", "mapUsers"}, "aws-auth-manager")).
+			To(Equal([]string{"kubectl-edit (Update)"}))
+		Expect(DataManagers(live, []string{"mapUsers"})).
+			To(Equal([]string{"aws-auth-manager (Apply)"}))
+	})
+})
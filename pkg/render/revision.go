@@ -0,0 +1,184 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Labels and annotations of the revisions of the aws-auth ConfigMap. A
+// revision is a ConfigMap holding the mapRoles, mapUsers and mapAccounts of a
+// rendered aws-auth ConfigMap.
+const (
+	// RevisionLabel labels a revision with the name of its aws-auth ConfigMap.
+	RevisionLabel = "aws-auth-manager.maruina.k8s/revision-of"
+
+	// RenderedAtAnnotation records when a revision was rendered, in RFC 3339
+	// format.
+	RenderedAtAnnotation = "aws-auth-manager.maruina.k8s/rendered-at"
+
+	// RevisionHashAnnotation records the SHA-256 of the mappings of a revision.
+	RevisionHashAnnotation = "aws-auth-manager.maruina.k8s/sha256"
+
+	// PinnedRevisionAnnotation pins the aws-auth ConfigMap to the revision it
+	// names: the controller writes the mappings of the revision instead of the
+	// mappings of the AWSAuthItems until the annotation is removed.
+	PinnedRevisionAnnotation = "aws-auth-manager.maruina.k8s/pinned-revision"
+
+	// RevisionItemsKey is the data key of a revision listing the items whose
+	// mappings were rendered.
+	RevisionItemsKey = "items"
+)
+
+// Revision describes a rendered aws-auth ConfigMap.
+type Revision struct {
+	Name       string
+	RenderedAt time.Time
+	Hash       string
+
+	// Items are the items whose mappings were rendered, such as
+	// "AWSAuthItem team-a/deployers" or "ClusterAWSAuthItem nodes".
+	Items []string
+}
+
+// RevisionHash returns the hex-encoded SHA-256 of the mapRoles, mapUsers and
+// mapAccounts of cm.
+func RevisionHash(cm *corev1.ConfigMap) string {
+	h := sha256.New()
+	for _, key := range []string{"mapRoles", "mapUsers", "mapAccounts"} {
+		fmt.Fprintf(h, "%s\x00%s\x00", key, cm.Data[key])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// RevisionName returns the name of the revision of the aws-auth ConfigMap
+// name with the given hash. Revisions are named after their content, so that
+// rendering the same mappings again updates the same revision.
+func RevisionName(name, hash string) string {
+	return name + "-" + hash[:10]
+}
+
+// NewRevision returns the server-side apply configuration of the revision of
+// cm, the aws-auth ConfigMap as written by ConfigMap, in namespace.
+func NewRevision(cm *corev1.ConfigMap, namespace string, items []string, renderedAt time.Time) (*corev1ac.ConfigMapApplyConfiguration, error) {
+	itemsYaml, err := yaml.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling revision items: %w", err)
+	}
+
+	hash := RevisionHash(cm)
+	annotations := map[string]string{
+		RenderedAtAnnotation:   renderedAt.UTC().Format(time.RFC3339Nano),
+		RevisionHashAnnotation: hash,
+	}
+	for _, key := range []string{ManagedEntriesAnnotation, OwnersAnnotation} {
+		if value, ok := cm.Annotations[key]; ok {
+			annotations[key] = value
+		}
+	}
+
+	return corev1ac.ConfigMap(RevisionName(cm.Name, hash), namespace).
+		WithLabels(map[string]string{RevisionLabel: cm.Name}).
+		WithAnnotations(annotations).
+		WithData(map[string]string{
+			"mapRoles":       cm.Data["mapRoles"],
+			"mapUsers":       cm.Data["mapUsers"],
+			"mapAccounts":    cm.Data["mapAccounts"],
+			RevisionItemsKey: string(itemsYaml),
+		}), nil
+}
+
+// ParseRevision returns the description of a revision ConfigMap.
+func ParseRevision(revision *corev1.ConfigMap) (Revision, error) {
+	parsed := Revision{
+		Name: revision.Name,
+		Hash: revision.Annotations[RevisionHashAnnotation],
+	}
+
+	renderedAt, err := time.Parse(time.RFC3339Nano, revision.Annotations[RenderedAtAnnotation])
+	if err != nil {
+		return parsed, fmt.Errorf("parsing %s annotation of revision %s: %w", RenderedAtAnnotation, revision.Name, err)
+	}
+	parsed.RenderedAt = renderedAt
+
+	if err := yaml.Unmarshal([]byte(revision.Data[RevisionItemsKey]), &parsed.Items); err != nil {
+		return parsed, fmt.Errorf("unmarshaling items of revision %s: %w", revision.Name, err)
+	}
+
+	return parsed, nil
+}
+
+// SortRevisions sorts revisions from the most recently rendered to the
+// oldest. Revisions without a valid RenderedAtAnnotation are the oldest.
+func SortRevisions(revisions []corev1.ConfigMap) {
+	renderedAt := func(revision *corev1.ConfigMap) time.Time {
+		t, _ := time.Parse(time.RFC3339Nano, revision.Annotations[RenderedAtAnnotation])
+		return t
+	}
+
+	sort.SliceStable(revisions, func(a, b int) bool {
+		ta, tb := renderedAt(&revisions[a]), renderedAt(&revisions[b])
+		if !ta.Equal(tb) {
+			return ta.After(tb)
+		}
+		return revisions[a].Name < revisions[b].Name
+	})
+}
+
+// PruneRevisions returns the revisions to delete to keep the limit most
+// recently rendered ones.
+func PruneRevisions(revisions []corev1.ConfigMap, limit int) []corev1.ConfigMap {
+	if len(revisions) <= limit {
+		return nil
+	}
+
+	sorted := append([]corev1.ConfigMap(nil), revisions...)
+	SortRevisions(sorted)
+
+	return sorted[limit:]
+}
+
+// Restore writes the mappings of revision to the data of cm, as ConfigMap
+// would have written them, to pin cm to revision.
+func Restore(cm *corev1.ConfigMap, revision *corev1.ConfigMap) {
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	for _, key := range []string{"mapRoles", "mapUsers", "mapAccounts"} {
+		cm.Data[key] = revision.Data[key]
+	}
+
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	for _, key := range []string{ManagedEntriesAnnotation, OwnersAnnotation} {
+		if value, ok := revision.Annotations[key]; ok {
+			cm.Annotations[key] = value
+		}
+	}
+	cm.Annotations[MapRolesAnnotation] = contentHash(cm.Data["mapRoles"])
+	cm.Annotations[MapUsersAnnotation] = contentHash(cm.Data["mapUsers"])
+}
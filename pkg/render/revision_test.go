@@ -0,0 +1,132 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+
+	awsauthv1alpha1 "github.com/maruina/aws-auth-manager/api/v1alpha1"
+)
+
+// appliedConfigMap returns the ConfigMap an apply configuration creates.
+func appliedConfigMap(applied *corev1ac.ConfigMapApplyConfiguration) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        *applied.Name,
+			Namespace:   *applied.Namespace,
+			Labels:      applied.Labels,
+			Annotations: applied.Annotations,
+		},
+		Data: applied.Data,
+	}
+}
+
+// revisionAt returns a revision ConfigMap named name rendered at renderedAt.
+func revisionAt(name string, renderedAt time.Time) corev1.ConfigMap {
+	return corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:        name,
+		Annotations: map[string]string{RenderedAtAnnotation: renderedAt.Format(time.RFC3339Nano)},
+	}}
+}
+
+var _ = Describe("Revisions", func() {
+	var cm *corev1.ConfigMap
+
+	BeforeEach(func() {
+		cm = NewConfigMap("aws-auth", "kube-system")
+		Expect(ConfigMap(cm, Aggregation{
+			MapRoles: []awsauthv1alpha1.MapRoleItem{{
+				RoleArn:  "arn:aws:iam::111122223333:role/admin",
+				Username: "admin",
+				Groups:   []string{"system:masters"},
+			}},
+		}, ConfigMapModeStrict)).To(Succeed())
+	})
+
+	It("should record the mappings, the hash and the items of a rendering", func() {
+		renderedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		applied, err := NewRevision(cm, "aws-auth-manager", []string{"AWSAuthItem team-a/admins"}, renderedAt)
+		Expect(err).NotTo(HaveOccurred())
+
+		revision := appliedConfigMap(applied)
+		Expect(revision.Name).To(Equal(RevisionName("aws-auth", RevisionHash(cm))))
+		Expect(revision.Namespace).To(Equal("aws-auth-manager"))
+		Expect(revision.Labels).To(HaveKeyWithValue(RevisionLabel, "aws-auth"))
+		Expect(revision.Annotations).To(HaveKeyWithValue(ManagedEntriesAnnotation, cm.Annotations[ManagedEntriesAnnotation]))
+		Expect(revision.Data).To(HaveKeyWithValue("mapRoles", cm.Data["mapRoles"]))
+
+		parsed, err := ParseRevision(revision)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(Revision{
+			Name:       revision.Name,
+			RenderedAt: renderedAt,
+			Hash:       RevisionHash(cm),
+			Items:      []string{"AWSAuthItem team-a/admins"},
+		}))
+	})
+
+	It("should name the revisions after their mappings", func() {
+		other := cm.DeepCopy()
+		other.Data["mapAccounts"] = "- \"444455556666\"\n"
+		Expect(RevisionHash(other)).NotTo(Equal(RevisionHash(cm)))
+
+		other.Annotations["unrelated"] = "value"
+		other.Data["mapAccounts"] = cm.Data["mapAccounts"]
+		Expect(RevisionHash(other)).To(Equal(RevisionHash(cm)))
+	})
+
+	It("should prune the oldest revisions", func() {
+		now := time.Now()
+		revisions := []corev1.ConfigMap{
+			revisionAt("aws-auth-oldest", now.Add(-3*time.Hour)),
+			revisionAt("aws-auth-newest", now),
+			revisionAt("aws-auth-older", now.Add(-2*time.Hour)),
+			revisionAt("aws-auth-newer", now.Add(-time.Hour)),
+		}
+
+		var names []string
+		for _, revision := range PruneRevisions(revisions, 2) {
+			names = append(names, revision.Name)
+		}
+		Expect(names).To(Equal([]string{"aws-auth-older", "aws-auth-oldest"}))
+		Expect(revisions[0].Name).To(Equal("aws-auth-oldest"), "the revisions should not be reordered")
+
+		SortRevisions(revisions)
+		Expect(revisions[0].Name).To(Equal("aws-auth-newest"))
+	})
+
+	It("should restore the mappings of a revision", func() {
+		applied, err := NewRevision(cm, "kube-system", nil, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		revision := appliedConfigMap(applied)
+
+		live := cm.DeepCopy()
+		Expect(ConfigMap(live, Aggregation{MapAccounts: []string{"444455556666"}}, ConfigMapModeStrict)).To(Succeed())
+
+		restored := live.DeepCopy()
+		Restore(restored, revision)
+		Expect(restored.Data).To(Equal(cm.Data))
+		Expect(restored.Annotations).To(Equal(cm.Annotations))
+		Expect(Unchanged(cm, restored)).To(BeTrue())
+	})
+})
@@ -0,0 +1,120 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// OverrideSafetyChecksAnnotation overrides the safety guards for a single
+// rendering of the aws-auth ConfigMap: the rendering whose RevisionHash is the
+// value of the annotation is written even if it trips a guard.
+const OverrideSafetyChecksAnnotation = "aws-auth-manager.maruina.k8s/override-safety-checks"
+
+// SafetyGuards are the checks a rendering of the aws-auth ConfigMap must pass
+// to be written, so that removing an item can't lock the nodes or the
+// administrators out of the cluster.
+type SafetyGuards struct {
+	// RequiredGroups are the groups, such as system:nodes, whose last mapping
+	// can't be removed.
+	RequiredGroups []string
+
+	// RequiredARNs are the role and user ARNs whose mapping can't be removed.
+	RequiredARNs []string
+
+	// MaxRemovalPercent is the maximum percentage of the entries of the
+	// aws-auth ConfigMap a rendering can remove. Disabled when zero.
+	MaxRemovalPercent int
+}
+
+// CheckSafety returns the guards tripped by replacing the live aws-auth
+// ConfigMap with the desired one, as messages. A required group or ARN only
+// trips its guard when the live ConfigMap maps it, so that a guard never
+// prevents the controller from writing a ConfigMap that didn't map it yet.
+func CheckSafety(live, desired *corev1.ConfigMap, guards SafetyGuards) ([]string, error) {
+	liveAgg, err := ParseConfigMap(live)
+	if err != nil {
+		return nil, fmt.Errorf("parsing live ConfigMap: %w", err)
+	}
+
+	desiredAgg, err := ParseConfigMap(desired)
+	if err != nil {
+		return nil, fmt.Errorf("parsing desired ConfigMap: %w", err)
+	}
+
+	var tripped []string
+	for _, group := range guards.RequiredGroups {
+		if mapsGroup(liveAgg, group) && !mapsGroup(desiredAgg, group) {
+			tripped = append(tripped, fmt.Sprintf("removes the last mapping of group %s", group))
+		}
+	}
+	for _, arn := range guards.RequiredARNs {
+		if mapsARN(liveAgg, arn) && !mapsARN(desiredAgg, arn) {
+			tripped = append(tripped, fmt.Sprintf("removes the mapping of %s", arn))
+		}
+	}
+
+	if guards.MaxRemovalPercent > 0 {
+		entries := len(liveAgg.MapRoles) + len(liveAgg.MapUsers) + len(liveAgg.MapAccounts)
+
+		var removed int
+		changes := diffMappings("mapRoles", roleMappings(liveAgg), roleMappings(desiredAgg))
+		changes = append(changes, diffMappings("mapUsers", userMappings(liveAgg), userMappings(desiredAgg))...)
+		changes = append(changes, diffAccounts(liveAgg.MapAccounts, desiredAgg.MapAccounts)...)
+		for _, change := range changes {
+			if change.Type == ChangeRemoved {
+				removed++
+			}
+		}
+
+		if removed*100 > entries*guards.MaxRemovalPercent {
+			tripped = append(tripped, fmt.Sprintf("removes %d of the %d entries, more than %d%%",
+				removed, entries, guards.MaxRemovalPercent))
+		}
+	}
+
+	return tripped, nil
+}
+
+// mapsGroup reports whether a role or a user of agg is mapped to group.
+func mapsGroup(agg Aggregation, group string) bool {
+	for _, role := range agg.MapRoles {
+		if slices.Contains(role.Groups, group) {
+			return true
+		}
+	}
+	for _, user := range agg.MapUsers {
+		if slices.Contains(user.Groups, group) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mapsARN reports whether agg maps the role or user arn.
+func mapsARN(agg Aggregation, arn string) bool {
+	if _, ok := roleMappings(agg)[arn]; ok {
+		return true
+	}
+	_, ok := userMappings(agg)[arn]
+
+	return ok
+}
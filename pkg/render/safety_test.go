@@ -0,0 +1,82 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("CheckSafety", func() {
+	const (
+		nodes = `- rolearn: arn:aws:iam::111122223333:role/nodes
+  username: system:node:{{EC2PrivateDNSName}}
+  groups:
+    - system:bootstrappers
+    - system:nodes
+`
+		admin = `- rolearn: arn:aws:iam::111122223333:role/admin
+  username: admin
+  groups:
+    - system:masters
+`
+	)
+
+	var live *corev1.ConfigMap
+
+	BeforeEach(func() {
+		live = &corev1.ConfigMap{Data: map[string]string{
+			"mapRoles":    nodes + admin,
+			"mapAccounts": `["444455556666"]`,
+		}}
+	})
+
+	It("should trip when the last mapping of a required group or a required ARN is removed", func() {
+		desired := &corev1.ConfigMap{Data: map[string]string{
+			"mapRoles":    admin,
+			"mapAccounts": `["444455556666"]`,
+		}}
+		guards := SafetyGuards{
+			RequiredGroups: []string{"system:nodes", "system:masters"},
+			RequiredARNs:   []string{"arn:aws:iam::111122223333:role/nodes", "arn:aws:iam::111122223333:role/admin"},
+		}
+
+		Expect(CheckSafety(live, desired, guards)).To(Equal([]string{
+			"removes the last mapping of group system:nodes",
+			"removes the mapping of arn:aws:iam::111122223333:role/nodes",
+		}))
+		Expect(CheckSafety(live, live, guards)).To(BeEmpty())
+	})
+
+	It("should not trip for a required group the live ConfigMap doesn't map", func() {
+		desired := &corev1.ConfigMap{Data: map[string]string{"mapRoles": admin}}
+		live.Data["mapRoles"] = admin
+
+		Expect(CheckSafety(live, desired, SafetyGuards{RequiredGroups: []string{"system:nodes"}})).To(BeEmpty())
+	})
+
+	It("should trip when too many entries are removed", func() {
+		desired := &corev1.ConfigMap{Data: map[string]string{"mapRoles": nodes}}
+
+		Expect(CheckSafety(live, desired, SafetyGuards{MaxRemovalPercent: 50})).To(Equal([]string{
+			"removes 2 of the 3 entries, more than 50%",
+		}))
+		Expect(CheckSafety(live, desired, SafetyGuards{MaxRemovalPercent: 70})).To(BeEmpty())
+		Expect(CheckSafety(live, desired, SafetyGuards{})).To(BeEmpty())
+	})
+})